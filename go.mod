@@ -6,12 +6,16 @@ toolchain go1.24.6
 
 require (
 	github.com/go-chi/chi/v5 v5.0.11
+	github.com/graphql-go/graphql v0.8.1
 	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/oschwald/geoip2-golang v1.9.0
+	github.com/oschwald/maxminddb-golang v1.11.0
+	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/crypto v0.42.0
+	golang.org/x/net v0.44.0
 )
 
 require (
-	github.com/oschwald/maxminddb-golang v1.11.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
+	golang.org/x/text v0.29.0 // indirect
 )
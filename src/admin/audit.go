@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/apimgr/zipcodes/src/utils"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxAuditBody caps how much of a request body is captured in the audit log
+const maxAuditBody = 4096
+
+type contextKey string
+
+// principalKey holds the authenticated admin username in the request context
+const principalKey contextKey = "admin.principal"
+
+// withPrincipal returns r with the authenticated admin username attached
+func withPrincipal(r *http.Request, username string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey, username))
+}
+
+// Principal returns the authenticated admin username for the request
+func Principal(r *http.Request) string {
+	username, _ := r.Context().Value(principalKey).(string)
+	return username
+}
+
+// AuditWrites records every non-read admin request in audit_log after the
+// handler runs, with the principal, method, path, a redacted summary of the
+// request body and the response status. Must run after the auth middleware.
+func (m *Middleware) AuditWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Capture the start of the body and hand the full body on to the handler
+		var captured []byte
+		if r.Body != nil {
+			captured, _ = io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(captured), r.Body))
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		entry := database.AuditEntry{
+			Username:  Principal(r),
+			Action:    r.Method,
+			Resource:  r.URL.Path,
+			NewValue:  summarizeBody(r.Header.Get("Content-Type"), captured),
+			IPAddress: utils.ClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   status < http.StatusBadRequest,
+		}
+		if !entry.Success {
+			entry.Error = http.StatusText(status)
+		}
+
+		if err := database.WriteAuditLog(m.db, entry); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	})
+}
+
+// summarizeBody renders a request body for the audit log with secret values
+// (passwords, tokens, keys) redacted
+func summarizeBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for key := range values {
+				if isSecretKey(key) {
+					values.Set(key, "[REDACTED]")
+				}
+			}
+			return values.Encode()
+		}
+	case strings.HasPrefix(contentType, "application/json"):
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err == nil {
+			for key := range data {
+				if isSecretKey(key) {
+					data[key] = "[REDACTED]"
+				}
+			}
+			if out, err := json.Marshal(data); err == nil {
+				return string(out)
+			}
+		}
+	}
+
+	if len(body) >= maxAuditBody {
+		return "[" + contentType + " body, truncated]"
+	}
+	return "[" + contentType + " body]"
+}
+
+// isSecretKey reports whether a field name looks like it holds a credential
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"password", "token", "secret", "key"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,22 +3,53 @@ package admin
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/apimgr/zipcodes/src/database"
 )
 
 // Handler handles admin routes
 type Handler struct {
 	db        *sql.DB
+	settings  *database.Settings
 	templates embed.FS
+	logsDir   string
+	paths     Paths
+
+	// settingsMu serializes settings saves so the updated_at check and the
+	// update happen as one step
+	settingsMu sync.Mutex
+}
+
+// Paths are where the admin web UI and admin API are mounted
+type Paths struct {
+	Web string
+	API string
+}
+
+// templateFuncs are helpers available to admin templates
+var templateFuncs = template.FuncMap{
+	"default": func(def, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
 }
 
 // NewHandler creates admin handler
-func NewHandler(db *sql.DB, templates embed.FS) *Handler {
+func NewHandler(db *sql.DB, settings *database.Settings, templates embed.FS, logsDir string, paths Paths) *Handler {
 	return &Handler{
 		db:        db,
+		settings:  settings,
 		templates: templates,
+		logsDir:   logsDir,
+		paths:     paths,
 	}
 }
 
@@ -33,40 +64,129 @@ func (h *Handler) DashboardHandler(w http.ResponseWriter, r *http.Request) {
 
 // SettingsHandler shows admin settings
 func (h *Handler) SettingsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
 		// Handle settings update
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "Invalid form data", http.StatusBadRequest)
 			return
 		}
 
-		// Update settings in database
-		for key, values := range r.Form {
-			if len(values) > 0 {
-				_, err := h.db.Exec("UPDATE settings SET value = ?, updated_at = CURRENT_TIMESTAMP WHERE key = ?", values[0], key)
-				if err != nil {
-					http.Error(w, "Failed to update settings", http.StatusInternalServerError)
-					return
-				}
-			}
+		version, err := h.saveSettings(r.Form)
+		if err == errSettingsChanged {
+			h.settingsConflict(w, r, version)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update settings", http.StatusInternalServerError)
+			return
+		}
+		h.settings.Invalidate()
+
+		// API clients get JSON, the web UI goes back to the settings page
+		if r.Method == http.MethodPut {
+			respondJSON(w, http.StatusOK, map[string]interface{}{
+				"success":    true,
+				"message":    "Settings updated",
+				"updated_at": version,
+			})
+			return
+		}
+
+		http.Redirect(w, r, h.paths.Web+"/settings", http.StatusSeeOther)
+		return
+	}
+
+	h.renderSettings(w, http.StatusOK, "")
+}
+
+// errSettingsChanged means the settings were saved by someone else after the
+// client loaded them
+var errSettingsChanged = errors.New("settings changed")
+
+// settingsVersion is the newest settings updated_at. The settings form and
+// API echo it back as updated_at so a save based on stale values is refused.
+func settingsVersion(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}) (string, error) {
+	var version sql.NullString
+	err := q.QueryRow("SELECT MAX(updated_at) FROM settings").Scan(&version)
+	return version.String, err
+}
+
+// saveSettings applies the submitted settings and returns the new settings
+// version. If the form carries an updated_at that no longer matches, nothing
+// is saved and errSettingsChanged is returned with the current version.
+func (h *Handler) saveSettings(form url.Values) (string, error) {
+	h.settingsMu.Lock()
+	defer h.settingsMu.Unlock()
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	current, err := settingsVersion(tx)
+	if err != nil {
+		return "", err
+	}
+	if seen := form.Get("updated_at"); seen != "" && seen != current {
+		return current, errSettingsChanged
+	}
+
+	for key, values := range form {
+		if key == "updated_at" || len(values) == 0 {
+			continue
+		}
+		// Millisecond timestamps keep saves within the same second apart
+		_, err := tx.Exec("UPDATE settings SET value = ?, updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE key = ?", values[0], key)
+		if err != nil {
+			return "", err
 		}
+	}
 
-		http.Redirect(w, r, "/admin/settings", http.StatusSeeOther)
+	version, err := settingsVersion(tx)
+	if err != nil {
+		return "", err
+	}
+	return version, tx.Commit()
+}
+
+// settingsConflict answers a save based on stale settings with 409: JSON with
+// the current version for the API, the reloaded form with an error for the UI
+func (h *Handler) settingsConflict(w http.ResponseWriter, r *http.Request, version string) {
+	const message = "Settings were changed by someone else since you loaded them. Reload to see the latest values, then save again."
+	if r.Method == http.MethodPut {
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"success":    false,
+			"error":      map[string]string{"code": "SETTINGS_CHANGED", "message": message},
+			"updated_at": version,
+		})
 		return
 	}
+	h.renderSettings(w, http.StatusConflict, message)
+}
 
-	// Get settings from database
+// renderSettings renders the settings form with the current values and version
+func (h *Handler) renderSettings(w http.ResponseWriter, status int, errMsg string) {
 	settings, err := h.getSettings()
 	if err != nil {
 		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
 		return
 	}
+	version, err := settingsVersion(h.db)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
 
-	h.renderTemplate(w, "admin/settings.html", map[string]interface{}{
+	h.renderTemplateStatus(w, status, "admin/settings.html", map[string]interface{}{
 		"ServerTitle":       "Zipcodes",
 		"ServerDescription": "US Postal Code Lookup API",
 		"PageTitle":         "Server Settings",
 		"Settings":          settings,
+		"UpdatedAt":         version,
+		"Error":             errMsg,
 	})
 }
 
@@ -101,10 +221,20 @@ func (h *Handler) DatabaseTestHandler(w http.ResponseWriter, r *http.Request) {
 
 // LogsHandler shows log viewer
 func (h *Handler) LogsHandler(w http.ResponseWriter, r *http.Request) {
+	name, path, ok := h.logPath(r)
+	if !ok {
+		http.Error(w, "Invalid log file", http.StatusBadRequest)
+		return
+	}
+
+	lines, _ := tailLines(path, defaultLogLines)
+
 	h.renderTemplate(w, "admin/logs.html", map[string]interface{}{
 		"ServerTitle":       "Zipcodes",
 		"ServerDescription": "US Postal Code Lookup API",
 		"PageTitle":         "Log Viewer",
+		"File":              name,
+		"Lines":             lines,
 	})
 }
 
@@ -165,6 +295,11 @@ func (h *Handler) getSettings() (map[string]string, error) {
 
 // renderTemplate renders a template with data
 func (h *Handler) renderTemplate(w http.ResponseWriter, name string, data map[string]interface{}) {
+	h.renderTemplateStatus(w, http.StatusOK, name, data)
+}
+
+// renderTemplateStatus renders a template with data and an HTTP status
+func (h *Handler) renderTemplateStatus(w http.ResponseWriter, status int, name string, data map[string]interface{}) {
 	tmplData, err := h.templates.ReadFile("templates/" + name)
 	if err != nil {
 		http.Error(w, "Template not found: "+name, http.StatusInternalServerError)
@@ -178,7 +313,7 @@ func (h *Handler) renderTemplate(w http.ResponseWriter, name string, data map[st
 		return
 	}
 
-	tmpl, err := template.New("base").Parse(string(baseTmpl))
+	tmpl, err := template.New("base").Funcs(templateFuncs).Parse(string(baseTmpl))
 	if err != nil {
 		http.Error(w, "Template parse error", http.StatusInternalServerError)
 		return
@@ -190,7 +325,15 @@ func (h *Handler) renderTemplate(w http.ResponseWriter, name string, data map[st
 		return
 	}
 
+	// Templates build admin links from the configured mount paths
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["AdminPath"] = h.paths.Web
+	data["AdminAPIPath"] = h.paths.API
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
 	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Template execution error", http.StatusInternalServerError)
 		return
@@ -225,3 +368,25 @@ func (h *Handler) ReloadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"success":true,"message":"Configuration reloaded"}`))
 }
+
+// PurgeCacheHandler drops this instance's in-memory caches and the shared
+// response cache (API). Other instances keep their own in-memory caches; see
+// README "Multiple Instances"
+func (h *Handler) PurgeCacheHandler(w http.ResponseWriter, r *http.Request) {
+	h.settings.Invalidate()
+
+	if _, err := h.db.ExecContext(r.Context(), "DELETE FROM response_cache"); err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INTERNAL_ERROR", "message": "failed to purge the shared response cache"},
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"purged": []string{"settings", "shared_cache"},
+		},
+	})
+}
@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/database"
+)
+
+const (
+	// defaultHistoryLimit and maxHistoryLimit bound ?limit on the history report
+	defaultHistoryLimit = 10
+	maxHistoryLimit     = 100
+
+	// defaultHistoryDays is the report window when ?days is absent
+	defaultHistoryDays = 7
+)
+
+// TopLookupsHandler reports the most looked-up zipcodes and the countries
+// GeoIP lookups resolved to over the last ?days (default 7), ?limit entries
+// each (default 10, max 100) (API). Lookups are only recorded while
+// features.track_lookups is on; the response says whether it is.
+func (h *Handler) TopLookupsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "limit must be a positive integer"},
+			})
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+
+	days := defaultHistoryDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "days must be a positive integer"},
+			})
+			return
+		}
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	zipcodes, err := database.TopLookups(h.db, database.LookupZipcode, since, limit)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INTERNAL_ERROR", "message": "failed to load lookup history"},
+		})
+		return
+	}
+	countries, err := database.GeoIPCountries(h.db, since, limit)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INTERNAL_ERROR", "message": "failed to load lookup history"},
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"tracking":        h.settings.GetBool("features.track_lookups", false),
+			"sample_percent":  h.settings.GetInt("features.track_lookups_sample_percent", 100),
+			"days":            days,
+			"zipcodes":        zipcodes,
+			"geoip_countries": countries,
+		},
+	})
+}
@@ -0,0 +1,160 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// idempotencyTTL is how long a processed Idempotency-Key is remembered
+const idempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKey caps the length of an Idempotency-Key header
+const maxIdempotencyKey = 255
+
+// idempotentResponse is a stored admin write response, replayed for retries
+// carrying the same key
+type idempotentResponse struct {
+	fingerprint string
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore is an in-memory, per-process record of processed keys
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentResponse
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: make(map[string]*idempotentResponse)}
+}
+
+// begin claims key for a request with the given fingerprint. It returns the
+// existing entry if the key is already known, or nil once the caller owns it.
+func (s *idempotencyStore) begin(key, fingerprint string, now time.Time) *idempotentResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, e := range s.entries {
+		if e.done && now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	if e, ok := s.entries[key]; ok {
+		return e
+	}
+	s.entries[key] = &idempotentResponse{fingerprint: fingerprint}
+	return nil
+}
+
+// finish stores the response for key, or forgets the key if the request
+// failed server-side so that a retry runs again
+func (s *idempotencyStore) finish(key string, status int, header http.Header, body []byte, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if status >= http.StatusInternalServerError {
+		delete(s.entries, key)
+		return
+	}
+	e.done = true
+	e.status = status
+	e.header = header
+	e.body = body
+	e.expires = now.Add(idempotencyTTL)
+}
+
+// Idempotent makes admin writes carrying an Idempotency-Key header safe to
+// retry: the first response for a key is stored for 24 hours and replayed
+// (with Idempotent-Replayed: true) instead of running the handler again.
+// Reusing a key for a different request is rejected with 422, and a retry
+// that arrives while the original is still running gets 409. Keys are scoped
+// to the authenticated admin. Must run after the auth middleware.
+func (m *Middleware) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_IDEMPOTENCY_KEY", "message": "Idempotency-Key must be at most 255 characters"},
+			})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_BODY", "message": "failed to read request body"},
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+		fingerprint := hex.EncodeToString(sum[:])
+		storeKey := Principal(r) + "\x00" + key
+
+		if prev := m.idempotency.begin(storeKey, fingerprint, time.Now()); prev != nil {
+			switch {
+			case prev.fingerprint != fingerprint:
+				respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+					"success": false,
+					"error":   map[string]string{"code": "IDEMPOTENCY_KEY_REUSED", "message": "Idempotency-Key was already used for a different request"},
+				})
+			case !prev.done:
+				respondJSON(w, http.StatusConflict, map[string]interface{}{
+					"success": false,
+					"error":   map[string]string{"code": "IDEMPOTENCY_KEY_IN_USE", "message": "a request with this Idempotency-Key is still being processed"},
+				})
+			default:
+				for k, v := range prev.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(prev.status)
+				w.Write(prev.body)
+			}
+			return
+		}
+
+		// A panicking handler releases the key so the retry can run
+		completed := false
+		defer func() {
+			if !completed {
+				m.idempotency.finish(storeKey, http.StatusInternalServerError, nil, nil, time.Now())
+			}
+		}()
+
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&buf)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		completed = true
+		m.idempotency.finish(storeKey, status, w.Header().Clone(), buf.Bytes(), time.Now())
+	})
+}
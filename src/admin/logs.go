@@ -0,0 +1,215 @@
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AccessLogFile receives one line per HTTP request
+	AccessLogFile = "access.log"
+	// ErrorLogFile receives server warnings and errors
+	ErrorLogFile = "error.log"
+
+	defaultLogLines = 200
+	maxLogLines     = 5000
+)
+
+// logPath returns the path of the requested log file (access or error)
+func (h *Handler) logPath(r *http.Request) (string, string, bool) {
+	switch r.URL.Query().Get("file") {
+	case "", "access":
+		return "access", filepath.Join(h.logsDir, AccessLogFile), true
+	case "error":
+		return "error", filepath.Join(h.logsDir, ErrorLogFile), true
+	}
+	return "", "", false
+}
+
+// LogsAPIHandler returns the last N lines of a log file (API)
+func (h *Handler) LogsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	name, path, ok := h.logPath(r)
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "file must be 'access' or 'error'"},
+		})
+		return
+	}
+
+	lines := defaultLogLines
+	if s := r.URL.Query().Get("lines"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxLogLines {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_PARAMETER", "message": fmt.Sprintf("lines must be between 1 and %d", maxLogLines)},
+			})
+			return
+		}
+		lines = n
+	}
+
+	data, err := tailLines(path, lines)
+	if err != nil && !os.IsNotExist(err) {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "READ_FAILED", "message": "failed to read log file"},
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"file":    name,
+		"count":   len(data),
+		"data":    data,
+	})
+}
+
+// LogsStreamHandler streams new log lines as Server-Sent Events (API)
+func (h *Handler) LogsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	_, path, ok := h.logPath(r)
+	if !ok {
+		http.Error(w, "file must be 'access' or 'error'", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Start from the current end of the file
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			lines, newOffset, err := readFrom(path, offset)
+			if err != nil {
+				continue
+			}
+			offset = newOffset
+			for _, line := range lines {
+				fmt.Fprintf(w, "data: %s\n\n", line)
+			}
+			if len(lines) == 0 {
+				// Keep the connection alive through proxies
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// tailLines returns up to n lines from the end of a file
+func tailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return []string{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return []string{}, err
+	}
+
+	// Read backwards in chunks until we have enough newlines
+	const chunkSize = 64 * 1024
+	size := info.Size()
+	var buf []byte
+	for pos := size; pos > 0 && bytes.Count(buf, []byte("\n")) <= n; {
+		readSize := int64(chunkSize)
+		if pos < readSize {
+			readSize = pos
+		}
+		pos -= readSize
+
+		chunk := make([]byte, readSize)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return []string{}, err
+		}
+		buf = append(chunk, buf...)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(buf), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// readFrom returns complete lines written after offset and the new offset
+// A truncated (rotated) file is read from the start
+func readFrom(path string, offset int64) ([]string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() == offset {
+		return nil, offset, nil
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	var lines []string
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave partial lines for the next read
+			break
+		}
+		offset += int64(len(line))
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+
+	return lines, offset, nil
+}
+
+// respondJSON writes a JSON response with the given status
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
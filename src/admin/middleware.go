@@ -6,21 +6,34 @@ import (
 	"strings"
 
 	"github.com/apimgr/zipcodes/src/database"
+	"github.com/apimgr/zipcodes/src/utils"
 )
 
 // Middleware handles admin authentication
 type Middleware struct {
-	db *sql.DB
+	db          *sql.DB
+	settings    *database.Settings
+	idempotency *idempotencyStore
+	// webPath scopes the session cookie to the admin web UI
+	webPath string
 }
 
 // NewMiddleware creates admin middleware
-func NewMiddleware(db *sql.DB) *Middleware {
-	return &Middleware{db: db}
+func NewMiddleware(db *sql.DB, settings *database.Settings, webPath string) *Middleware {
+	return &Middleware{db: db, settings: settings, idempotency: newIdempotencyStore(), webPath: webPath}
 }
 
 // RequireBasicAuth requires Basic Auth for web UI
+// A successful login issues a session cookie so later requests skip Basic Auth
 func (m *Middleware) RequireBasicAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(m.sessionCookieName()); err == nil {
+			if username, valid := database.VerifyAdminSession(m.db, cookie.Value); valid {
+				next.ServeHTTP(w, withPrincipal(r, username))
+				return
+			}
+		}
+
 		username, password, ok := r.BasicAuth()
 		if !ok {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Zipcodes Admin"`)
@@ -34,7 +47,13 @@ func (m *Middleware) RequireBasicAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// Start a session for the authenticated admin
+		lifetime := m.sessionLifetime()
+		if token, err := database.CreateAdminSession(m.db, username, utils.ClientIP(r), r.UserAgent(), lifetime); err == nil {
+			http.SetCookie(w, m.newSessionCookie(r, token, int(lifetime.Seconds())))
+		}
+
+		next.ServeHTTP(w, withPrincipal(r, username))
 	})
 }
 
@@ -53,11 +72,12 @@ func (m *Middleware) RequireBearerToken(next http.Handler) http.Handler {
 		}
 
 		token := strings.TrimPrefix(auth, "Bearer ")
-		if !database.VerifyAdminToken(m.db, token) {
+		username, valid := database.AdminTokenUser(m.db, token)
+		if !valid {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withPrincipal(r, username))
 	})
 }
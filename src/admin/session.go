@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSessionCookieName = "zipcodes_session"
+	defaultSessionTimeout    = 43200 // minutes (30 days)
+)
+
+// sessionLifetime returns the configured admin session lifetime
+func (m *Middleware) sessionLifetime() time.Duration {
+	minutes := m.settings.GetInt("security.session_timeout", defaultSessionTimeout)
+	if minutes <= 0 {
+		minutes = defaultSessionTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// sessionCookieName returns the configured admin session cookie name
+func (m *Middleware) sessionCookieName() string {
+	name := strings.TrimSpace(m.settings.GetString("security.session_cookie_name", defaultSessionCookieName))
+	if name == "" {
+		return defaultSessionCookieName
+	}
+	return name
+}
+
+// isHTTPS reports whether the request arrived over HTTPS
+func (m *Middleware) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if m.settings.GetBool("proxy.trust_headers", true) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		return true
+	}
+	return m.settings.GetBool("server.https_enabled", false)
+}
+
+// newSessionCookie builds the admin session cookie with secure defaults
+func (m *Middleware) newSessionCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.sessionCookieName(),
+		Value:    value,
+		Path:     m.webPath,
+		Domain:   strings.TrimSpace(m.settings.GetString("security.session_cookie_domain", "")),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   m.isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
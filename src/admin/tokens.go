@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// TokensHandler lists API tokens (GET) or issues a new one (POST) (API)
+// The plaintext token is only included in the POST response
+func (h *Handler) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "name is required"},
+			})
+			return
+		}
+
+		id, token, err := database.CreateAPIToken(h.db, name)
+		if err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INTERNAL_ERROR", "message": "failed to create token"},
+			})
+			return
+		}
+
+		respondJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]string{"id": id, "name": name, "token": token},
+		})
+		return
+	}
+
+	tokens, err := database.ListAPITokens(h.db)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INTERNAL_ERROR", "message": "failed to list tokens"},
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"count":   len(tokens),
+		"data":    tokens,
+	})
+}
+
+// RevokeTokenHandler revokes an API token by ID (API)
+func (h *Handler) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	revoked, err := database.RevokeAPIToken(h.db, chi.URLParam(r, "id"))
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INTERNAL_ERROR", "message": "failed to revoke token"},
+		})
+		return
+	}
+	if !revoked {
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no active token with that id"},
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Token revoked",
+	})
+}
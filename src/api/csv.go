@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// csvHeader is the header row of every CSV response
+var csvHeader = []string{"zip_code", "city", "state", "county", "latitude", "longitude"}
+
+// csvRow renders a zipcode as a CSV record. zip_code is written zero-padded,
+// so 01001 stays 01001 when the file is opened as text.
+func csvRow(zc *database.Zipcode) []string {
+	return []string{zc.ZipCode, zc.City, zc.State, zc.County, zc.Latitude, zc.Longitude}
+}
+
+// startCSV sets the CSV headers and writes the header row
+func startCSV(w http.ResponseWriter, filename string) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	return cw
+}
+
+// wantsCSV reports whether the request asked for ?format=csv
+func wantsCSV(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "csv"
+}
+
+// validFormat checks ?format on endpoints offering json (the default) or csv,
+// writing a 400 and returning false for anything else
+func validFormat(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "", "json", "csv":
+		return true
+	}
+	respond(w, r, http.StatusBadRequest, map[string]interface{}{
+		"success": false,
+		"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "format must be json or csv"},
+	})
+	return false
+}
+
+// respondList writes a list response as JSON, or with ?format=csv as CSV
+// rows of its zipcodes; the envelope's other fields (total, has_more, ...)
+// have no place in a CSV and are dropped
+func respondList(w http.ResponseWriter, r *http.Request, response map[string]interface{}, results []database.Zipcode) {
+	if !wantsCSV(r) {
+		respond(w, r, http.StatusOK, response)
+		return
+	}
+
+	cw := startCSV(w, "zipcodes.csv")
+	for i := range results {
+		cw.Write(csvRow(&results[i]))
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("CSV response failed: %v", err)
+	}
+}
+
+// GetByStateCSVHandler handles GET /api/v1/zipcode/state/{state}.csv
+// Streams every zipcode in the state as CSV, one row at a time like the
+// NDJSON variant, so large states are never held in memory
+func GetByStateCSVHandler(w http.ResponseWriter, r *http.Request) {
+	state := chi.URLParam(r, "state")
+	if state == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "state is required"},
+		})
+		return
+	}
+
+	cw := startCSV(w, strings.ToLower(state)+".csv")
+	flusher, _ := w.(http.Flusher)
+	written := 0
+
+	err := Dataset(r).StreamByState(r.Context(), state, queryOptions(r), func(zc *database.Zipcode) error {
+		applyPrecision(r, zc)
+		if err := cw.Write(csvRow(zc)); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return r.Context().Err()
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		// Headers are already sent; the client sees a truncated file
+		log.Printf("CSV stream for state %s ended early: %v", state, err)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/database"
+)
+
+// exportFlushEvery is how many features are written between flushes, so a
+// long export reaches the client steadily without a flush per record
+const exportFlushEvery = 1000
+
+// geoJSONFeature is a zipcode as a GeoJSON Feature. Records without
+// coordinates get a null geometry, as RFC 7946 allows.
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Geometry   *geoJSONPoint     `json:"geometry"`
+	Properties geoJSONProperties `json:"properties"`
+}
+
+// geoJSONPoint is a GeoJSON Point; coordinates are [longitude, latitude]
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// geoJSONProperties are the non-spatial zipcode fields of a feature
+type geoJSONProperties struct {
+	ZipCode  string `json:"zip_code"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	County   string `json:"county,omitempty"`
+	FIPS     string `json:"fips,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Geohash  string `json:"geohash,omitempty"`
+}
+
+// newGeoJSONFeature converts a zipcode to a GeoJSON Feature
+func newGeoJSONFeature(zc *database.Zipcode) geoJSONFeature {
+	code := zc.ZipCode
+	feature := geoJSONFeature{
+		Type: "Feature",
+		ID:   code,
+		Properties: geoJSONProperties{
+			ZipCode:  code,
+			City:     zc.City,
+			State:    zc.State,
+			County:   zc.County,
+			FIPS:     zc.FIPS,
+			Timezone: zc.Timezone,
+			Geohash:  zc.Geohash,
+		},
+	}
+	if lat, lon, ok := zc.Coordinates(); ok {
+		feature.Geometry = &geoJSONPoint{Type: "Point", Coordinates: [2]float64{lon, lat}}
+	}
+	return feature
+}
+
+// ExportHandler handles GET /api/v1/export
+// Streams the whole dataset, or one state with ?state=, as a GeoJSON
+// FeatureCollection (format=geojson, the default) or as NDJSON with one
+// Feature per line (format=ndjson). With ?compress=gzip the stream is gzipped
+// on the fly and served as a .gz download. Rows are read and written one at a
+// time, so memory stays flat however large the export.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "geojson"
+	}
+	if format != "geojson" && format != "ndjson" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "format must be geojson or ndjson"},
+		})
+		return
+	}
+
+	compress := query.Get("compress")
+	if compress != "" && compress != "gzip" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "compress must be gzip"},
+		})
+		return
+	}
+
+	state := strings.ToUpper(strings.TrimSpace(query.Get("state")))
+	if state != "" && !isStateCode(state) {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "state must be a 2-letter state code"},
+		})
+		return
+	}
+
+	filename := "zipcodes"
+	if state != "" {
+		filename += "-" + strings.ToLower(state)
+	}
+	if format == "ndjson" {
+		filename += ".ndjson"
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		filename += ".geojson"
+		w.Header().Set("Content-Type", "application/geo+json")
+	}
+
+	var out io.Writer = w
+	flusher, _ := w.(http.Flusher)
+	if compress == "gzip" {
+		// A .gz download, not Content-Encoding: clients that honor the
+		// encoding would save decompressed bytes under the .gz name
+		filename += ".gz"
+		w.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	flush := func() {
+		if gz, ok := out.(*gzip.Writer); ok {
+			gz.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if format == "geojson" {
+		io.WriteString(out, `{"type":"FeatureCollection","features":[`)
+	}
+
+	encoder := json.NewEncoder(out)
+	written := 0
+	err := Dataset(r).StreamAll(r.Context(), state, queryOptions(r), func(zc *database.Zipcode) error {
+		applyPrecision(r, zc)
+		if format == "geojson" && written > 0 {
+			if _, err := io.WriteString(out, ","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(newGeoJSONFeature(zc)); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers and part of the body are already sent, so the client sees the
+		// failure as a truncated export
+		log.Printf("Export stream failed after %d features: %v", written, err)
+		return
+	}
+
+	if format == "geojson" {
+		io.WriteString(out, "]}\n")
+	}
+}
+
+// isStateCode reports whether s is two ASCII letters
+func isStateCode(s string) bool {
+	return len(s) == 2 && strings.IndexFunc(s, func(c rune) bool {
+		return (c < 'A' || c > 'Z') && (c < 'a' || c > 'z')
+	}) < 0
+}
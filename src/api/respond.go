@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/database"
+)
+
+// Response formats an envelope can be written in
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+	FormatText = "text"
+)
+
+// ResponseFormat returns the format a request's envelope is written in: text
+// for a .txt path, XML for a .xml path or an Accept header whose most
+// preferred producible type is application/xml or text/xml, JSON otherwise.
+// Browsers, which list text/html first, and clients sending */* get JSON.
+func ResponseFormat(r *http.Request) string {
+	switch {
+	case strings.HasSuffix(r.URL.Path, ".txt"):
+		return FormatText
+	case strings.HasSuffix(r.URL.Path, ".xml"):
+		return FormatXML
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				q = 0
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, mr := range ranges {
+		if mr.q <= 0 {
+			continue
+		}
+		switch mr.mediaType {
+		case "application/xml", "text/xml":
+			return FormatXML
+		case "application/json", "text/html", "application/*", "*/*":
+			return FormatJSON
+		}
+	}
+	return FormatJSON
+}
+
+// respond writes a success or error envelope in the request's format (see
+// ResponseFormat), adding its timestamp. Every envelope-shaped response in
+// the api package goes through here, so JSON, XML and text share one set of
+// success/error fields.
+func respond(w http.ResponseWriter, r *http.Request, status int, envelope map[string]interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	switch ResponseFormat(r) {
+	case FormatXML:
+		if _, ok := envelope["timestamp"]; !ok {
+			envelope["timestamp"] = time.Now().Format(time.RFC3339)
+		}
+		writeXML(w, status, envelope)
+	case FormatText:
+		writeText(w, status, envelope)
+	default:
+		respondJSON(w, status, envelope)
+	}
+}
+
+// respondJSON writes data as JSON, adding a timestamp to map envelopes
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// Wrap response with timestamp if not already present
+	if m, ok := data.(map[string]interface{}); ok {
+		if _, hasTimestamp := m["timestamp"]; !hasTimestamp {
+			m["timestamp"] = time.Now().Format(time.RFC3339)
+		}
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeText writes a zipcode envelope as plain text: the record in
+// formatZipcodeText form, or the error message. Envelopes without either
+// fall back to JSON.
+func writeText(w http.ResponseWriter, status int, envelope map[string]interface{}) {
+	var text string
+	if zc, ok := envelope["data"].(*database.Zipcode); ok {
+		text = formatZipcodeText(zc)
+	} else if e, ok := envelope["error"].(map[string]string); ok {
+		text = e["message"] + "\n"
+	} else {
+		respondJSON(w, status, envelope)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, text)
+}
+
+// writeXML writes an envelope as a <response> document. Zipcodes use their
+// xml tags; everything else is encoded from its JSON form, so element names
+// are the JSON keys.
+func writeXML(w http.ResponseWriter, status int, envelope map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	if err := encodeXML(enc, "response", envelope); err != nil {
+		log.Printf("XML response failed: %v", err)
+		return
+	}
+	if err := enc.Flush(); err != nil {
+		log.Printf("XML response failed: %v", err)
+		return
+	}
+	io.WriteString(w, "\n")
+}
+
+// encodeXML writes v as an element called name. Maps become one child per
+// key (sorted, as in JSON), lists one <item> per entry (<zipcode> for
+// zipcodes), and nil values are left out.
+func encodeXML(enc *xml.Encoder, name string, v interface{}) error {
+	start := xmlStart(name)
+
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case database.Zipcode, *database.Zipcode:
+		return enc.EncodeElement(v, start)
+	case []database.Zipcode:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := range v {
+			if err := enc.EncodeElement(v[i], xmlStart("zipcode")); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case map[string]interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXML(enc, k, v[k]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case []interface{}:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := encodeXML(enc, "item", item); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case string, bool, json.Number, int, int64, float64:
+		return enc.EncodeElement(v, start)
+	}
+
+	// Structs, typed maps and slices: go through the JSON encoding so the
+	// XML matches the JSON response field for field
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return err
+	}
+	return encodeXML(enc, name, generic)
+}
+
+// xmlStart returns the start element for a key. Keys that aren't valid XML
+// names (e.g. an area code "212" used as a map key) become <entry key="...">.
+func xmlStart(name string) xml.StartElement {
+	if validXMLName(name) {
+		return xml.StartElement{Name: xml.Name{Local: name}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "entry"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+	}
+}
+
+// validXMLName reports whether s can be used as an element name as is: an
+// ASCII letter or underscore followed by letters, digits, '_', '-' or '.'
+func validXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -1,227 +1,1370 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/apimgr/zipcodes/src/database"
+	"github.com/apimgr/zipcodes/src/utils"
 	"github.com/go-chi/chi/v5"
 )
 
 var db *database.DB
-var zipcodesJSON []byte
+var settings *database.Settings
+var zipcodesJSON atomic.Pointer[[]byte]
 
 // SetDatabase sets the database instance for handlers
 func SetDatabase(database *database.DB) {
 	db = database
 }
 
-// SetZipcodesJSON sets the embedded JSON data for raw JSON endpoint
+// SetSettings sets the settings cache used by the handlers
+func SetSettings(s *database.Settings) {
+	settings = s
+}
+
+// history records zipcode lookups for the admin history report
+var history *database.LookupHistory
+
+// SetLookupHistory sets where zipcode lookups are recorded
+func SetLookupHistory(h *database.LookupHistory) {
+	history = h
+}
+
+// candidate is an optional second dataset served for ?dataset=candidate, so
+// a corrected dataset can be compared with the primary before promoting it
+var candidate *database.DB
+var candidateJSON []byte
+
+// SetCandidate sets the candidate dataset and its raw JSON
+func SetCandidate(dataset *database.DB, data []byte) {
+	candidate = dataset
+	candidateJSON = database.PadZipCodesJSON(data)
+}
+
+// HasCandidate reports whether a candidate dataset is loaded
+func HasCandidate() bool {
+	return candidate != nil
+}
+
+// candidateKey marks a request context routed to the candidate dataset
+type candidateKey struct{}
+
+// UseCandidate returns r routed to the candidate dataset
+func UseCandidate(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), candidateKey{}, true))
+}
+
+// isCandidate reports whether r was routed to the candidate dataset
+func isCandidate(r *http.Request) bool {
+	on, _ := r.Context().Value(candidateKey{}).(bool)
+	return on && candidate != nil
+}
+
+// Dataset returns the database a request reads from: the candidate when the
+// request was routed to it, otherwise the primary
+func Dataset(r *http.Request) *database.DB {
+	if isCandidate(r) {
+		return candidate
+	}
+	return db
+}
+
+// SetZipcodesJSON sets the JSON data for raw JSON endpoint, with zip_code
+// values zero-padded like every other response.
+// Safe to call while serving, e.g. when the dataset file is reloaded
 func SetZipcodesJSON(data []byte) {
-	zipcodesJSON = data
+	data = database.PadZipCodesJSON(data)
+	zipcodesJSON.Store(&data)
+}
+
+// SearchHandler handles zipcode search requests
+// With ?format=csv the matching zipcodes are returned as CSV instead of JSON.
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "query parameter 'q' is required"},
+		})
+		return
+	}
+	if !validFormat(w, r) {
+		return
+	}
+
+	opts := queryOptions(r)
+
+	// Try "lat, lon" coordinates
+	if lat, lon, ok := parseLatLonPair(query); ok {
+		result, err := Dataset(r).NearestZipcode(r.Context(), lat, lon)
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+		if result == nil {
+			respond(w, r, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "NOT_FOUND", "message": "no zipcode near coordinates"},
+			})
+			return
+		}
+		unit, perMeter := distanceUnit(r)
+		distance := roundTo(*result.Distance*perMeter, 3)
+		result.Distance = &distance
+		applyPrecision(r, result)
+		respondList(w, r, map[string]interface{}{
+			"success": true,
+			"data":    result,
+			"unit":    unit,
+		}, []database.Zipcode{*result})
+		return
+	}
+
+	// A full 5-digit zipcode or a ZIP+4 code
+	if zipCode, plus4, err := database.ParseZipPlus4(query); err == nil {
+		result, err := Dataset(r).SearchByZipCode(r.Context(), zipCode)
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+		history.Record(database.LookupZipcode, zipCode, result != nil, "")
+		if result == nil {
+			respond(w, r, http.StatusNotFound, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "NOT_FOUND", "message": "zipcode not found"},
+			})
+			return
+		}
+		result.Plus4 = plus4
+		applyPrecision(r, result)
+		respondList(w, r, map[string]interface{}{
+			"success": true,
+			"data":    result,
+		}, []database.Zipcode{*result})
+		return
+	}
+
+	// Digits only: a zipcode prefix
+	if isNumeric(query) {
+		if len(query) < 5 {
+			limit, offset, ok := pageParams(w, r, DefaultPageSize)
+			if !ok {
+				return
+			}
+			total, excluded, err := countMatches(opts, func(opts database.QueryOptions) (int, error) {
+				return Dataset(r).CountByPrefix(r.Context(), query, opts)
+			})
+			if err != nil {
+				respondError(w, r, err)
+				return
+			}
+			results, err := Dataset(r).SearchByPrefix(r.Context(), query, opts, limit, offset)
+			if err != nil {
+				respondError(w, r, err)
+				return
+			}
+			response := pageResponse(r, results, opts, total, excluded, limit, offset)
+			if total == 0 {
+				// Still a 200, but say so and point at the closest prefix that has data
+				response["message"] = "no zipcodes match prefix " + query
+				suggestion, err := Dataset(r).NearestPrefix(r.Context(), query, opts)
+				if err != nil {
+					respondError(w, r, err)
+					return
+				}
+				if suggestion != "" {
+					response["suggested_prefix"] = suggestion
+				}
+			}
+			respondList(w, r, response, results)
+			return
+		}
+
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": "zipcode must be 5 digits or ZIP+4 (94102-1234)"},
+		})
+		return
+	}
+
+	// Try state, city format
+	parts := strings.Split(query, ",")
+	if len(parts) == 2 {
+		state := strings.TrimSpace(parts[1])
+		city := strings.TrimSpace(parts[0])
+		results, err := Dataset(r).SearchByStateAndCity(r.Context(), state, city, opts)
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+		respondList(w, r, listResponse(r, results, opts), results)
+		return
+	}
+
+	// Try as city name
+	if len(query) > 2 && !isNumeric(query) {
+		respondCityPage(w, r, query, opts)
+		return
+	}
+
+	respond(w, r, http.StatusBadRequest, map[string]interface{}{
+		"success": false,
+		"error":   map[string]string{"code": "INVALID_QUERY", "message": "invalid query format"},
+	})
+}
+
+// GetByZipCodeHandler handles GET /api/v1/zipcode/:code, :code.txt and
+// :code.xml
+// code is a 5-digit zipcode or a ZIP+4 code; a ZIP+4 add-on is echoed back as
+// plus4 on the 5-digit record. The suffix picks the format (see ResponseFormat).
+func GetByZipCodeHandler(w http.ResponseWriter, r *http.Request) {
+	code, plus4, err := database.ParseZipPlus4(chi.URLParam(r, "code"))
+	if err != nil {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": err.Error()},
+		})
+		return
+	}
+
+	result, err := Dataset(r).SearchByZipCode(r.Context(), code)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	history.Record(database.LookupZipcode, code, result != nil, "")
+
+	if result == nil {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "zipcode not found"},
+		})
+		return
+	}
+
+	result.Plus4 = plus4
+	applyPrecision(r, result)
+	respond(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetNeighborsHandler handles GET /api/v1/zipcode/{code}/neighbors
+// Returns zipcodes approximately adjacent to code (see database.GetNeighbors).
+// With ?group=city the zipcodes are collapsed to distinct nearby cities.
+func GetNeighborsHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := database.ParseZipCode(chi.URLParam(r, "code"))
+	if err != nil {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": err.Error()},
+		})
+		return
+	}
+
+	group, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	neighbors, radius, err := Dataset(r).GetNeighbors(r.Context(), code)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if neighbors == nil {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "zipcode not found"},
+		})
+		return
+	}
+
+	unit, perMeter := distanceUnit(r)
+	for i := range neighbors {
+		d := roundTo(*neighbors[i].Distance*perMeter, 3)
+		neighbors[i].Distance = &d
+	}
+
+	if group == "city" {
+		cities := database.GroupByCity(neighbors)
+		respond(w, r, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"zip_code":      code,
+			"radius":        roundTo(radius*perMeter, 3),
+			"unit":          unit,
+			"count":         len(cities),
+			"nearby_cities": cities,
+		})
+		return
+	}
+
+	applyPrecisionAll(r, neighbors)
+	respond(w, r, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"zip_code": code,
+		"radius":   roundTo(radius*perMeter, 3),
+		"unit":     unit,
+		"count":    len(neighbors),
+		"data":     neighbors,
+	})
+}
+
+const (
+	// defaultNearLimit and maxNearLimit bound ?limit on /zipcode/near
+	defaultNearLimit = 100
+	maxNearLimit     = 1000
+
+	// maxNearRadiusMeters is the largest radius /zipcode/near accepts (500 mi)
+	maxNearRadiusMeters = 500 * 1609.344
+)
+
+// GetNearHandler handles GET /api/v1/zipcode/near
+// Returns the zipcodes within ?radius (in ?unit, km by default) of ?lat and
+// ?lng, nearest first, each with its distance. At most ?limit (default 100)
+// are returned; total is the number inside the radius. With ?group=city the
+// zipcodes are collapsed to distinct nearby cities first, and limit and total
+// count cities.
+func GetNearHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, lng, ok := parseCoordinates(w, r)
+	if !ok {
+		return
+	}
+	group, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+	if query.Get("radius") == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "radius is required"},
+		})
+		return
+	}
+
+	unit, perMeter := distanceUnit(r)
+	radius, err := strconv.ParseFloat(query.Get("radius"), 64)
+	if err != nil || !(radius > 0) || radius/perMeter > maxNearRadiusMeters {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error": map[string]string{
+				"code":    "INVALID_PARAMETER",
+				"message": fmt.Sprintf("radius must be a positive number up to %g %s", roundTo(maxNearRadiusMeters*perMeter, 3), unit),
+			},
+		})
+		return
+	}
+
+	limit := defaultNearLimit
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxNearLimit)
+	}
+
+	results, err := Dataset(r).SearchByRadius(r.Context(), lat, lng, radius/perMeter)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	for i := range results {
+		d := roundTo(*results[i].Distance*perMeter, 3)
+		results[i].Distance = &d
+	}
+
+	if group == "city" {
+		cities := database.GroupByCity(results)
+		total := len(cities)
+		if total > limit {
+			cities = cities[:limit]
+		}
+		respond(w, r, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"center":        map[string]float64{"latitude": lat, "longitude": lng},
+			"radius":        radius,
+			"unit":          unit,
+			"count":         len(cities),
+			"total":         total,
+			"limit":         limit,
+			"nearby_cities": cities,
+		})
+		return
+	}
+
+	total := len(results)
+	if total > limit {
+		results = results[:limit]
+	}
+
+	response := listResponse(r, results, queryOptions(r))
+	response["center"] = map[string]float64{"latitude": lat, "longitude": lng}
+	response["radius"] = radius
+	response["unit"] = unit
+	response["total"] = total
+	response["limit"] = limit
+	respond(w, r, http.StatusOK, response)
+}
+
+// ReverseGeocodeHandler handles GET /api/v1/geocode/reverse
+// Returns the zipcode closest to ?lat and ?lng (lon is accepted too) with its
+// distance in ?unit, e.g. to turn the coordinates of a GeoIP result into a
+// zipcode. 404 when no zipcode lies within database.NearestMaxDistance.
+func ReverseGeocodeHandler(w http.ResponseWriter, r *http.Request) {
+	lat, lng, ok := parseCoordinates(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := Dataset(r).NearestZipcode(r.Context(), lat, lng)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	unit, perMeter := distanceUnit(r)
+	if result == nil {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error": map[string]string{
+				"code":    "NOT_FOUND",
+				"message": fmt.Sprintf("no zipcode within %g %s of the coordinates", roundTo(database.NearestMaxDistance*perMeter, 3), unit),
+			},
+		})
+		return
+	}
+
+	distance := roundTo(*result.Distance*perMeter, 3)
+	result.Distance = &distance
+	applyPrecision(r, result)
+	respond(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    result,
+		"unit":    unit,
+	})
+}
+
+// GetByCityHandler handles GET /api/v1/zipcode/city/:city
+func GetByCityHandler(w http.ResponseWriter, r *http.Request) {
+	city := chi.URLParam(r, "city")
+	if city == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "city is required"},
+		})
+		return
+	}
+	if !validFormat(w, r) {
+		return
+	}
+
+	respondCityPage(w, r, city, queryOptions(r))
+}
+
+// DefaultPageSize is the page size of the state and prefix list endpoints
+// when ?limit is absent
+const DefaultPageSize = 100
+
+// groupParam reads ?group, which is empty or "city". On any other value it
+// writes a 400 and returns ok=false.
+func groupParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	group := r.URL.Query().Get("group")
+	if group != "" && group != "city" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "group must be city"},
+		})
+		return "", false
+	}
+	return group, true
+}
+
+// parseCoordinates reads ?lat and ?lng (?lon is accepted too). When either
+// is missing, malformed or out of range it writes a 400 and returns ok=false.
+func parseCoordinates(w http.ResponseWriter, r *http.Request) (lat, lng float64, ok bool) {
+	query := r.URL.Query()
+	lngParam := query.Get("lng")
+	if lngParam == "" {
+		lngParam = query.Get("lon")
+	}
+	if query.Get("lat") == "" || lngParam == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "lat and lng are required"},
+		})
+		return 0, 0, false
+	}
+
+	lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(lngParam, 64)
+	if latErr != nil || lngErr != nil || !database.ValidCoordinates(lat, lng) {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "lat must be -90 to 90 and lng -180 to 180"},
+		})
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// pageParams reads ?limit (default defaultLimit, at most
+// database.MaxPageSize) and ?offset (default 0). On a malformed or
+// out-of-range value it writes a 400 and returns ok=false.
+func pageParams(w http.ResponseWriter, r *http.Request, defaultLimit int) (limit, offset int, ok bool) {
+	limit = defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > database.MaxPageSize {
+			respond(w, r, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_PARAMETER", "message": fmt.Sprintf("limit must be an integer from 1 to %d", database.MaxPageSize)},
+			})
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respond(w, r, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "offset must be a non-negative integer"},
+			})
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// countMatches runs a paged endpoint's count query with opts. With geo=true
+// it also counts without the filter, so excluded is how many matches were
+// left out for lacking coordinates; otherwise excluded is 0.
+func countMatches(opts database.QueryOptions, count func(database.QueryOptions) (int, error)) (total, excluded int, err error) {
+	total, err = count(opts)
+	if err != nil || !opts.GeoOnly {
+		return total, 0, err
+	}
+	unfiltered := opts
+	unfiltered.GeoOnly = false
+	all, err := count(unfiltered)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, all - total, nil
+}
+
+// pageResponse is listResponse for one page of a larger result: it adds the
+// page bounds, the total match count and whether more pages follow. With
+// geo=true it also reports geo_excluded, the matches left out for lacking
+// coordinates (see countMatches).
+func pageResponse(r *http.Request, results []database.Zipcode, opts database.QueryOptions, total, excluded, limit, offset int) map[string]interface{} {
+	response := listResponse(r, results, opts)
+	response["total"] = total
+	if opts.GeoOnly {
+		response["geo_excluded"] = excluded
+	}
+	response["limit"] = limit
+	response["offset"] = offset
+	response["has_more"] = offset+len(results) < total
+	return response
+}
+
+// respondCityPage writes one page of a city search. ?limit defaults to
+// features.city_search_limit (see pageParams for the bounds); the response
+// carries the page bounds and the total match count.
+func respondCityPage(w http.ResponseWriter, r *http.Request, city string, opts database.QueryOptions) {
+	limit, offset, ok := pageParams(w, r, settings.CitySearchLimit())
+	if !ok {
+		return
+	}
+
+	total, excluded, err := countMatches(opts, func(opts database.QueryOptions) (int, error) {
+		return Dataset(r).CountByCity(r.Context(), city, opts)
+	})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	results, err := Dataset(r).SearchByCity(r.Context(), city, opts, limit, offset)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondList(w, r, pageResponse(r, results, opts, total, excluded, limit, offset), results)
+}
+
+// GetByStateHandler handles GET /api/v1/zipcode/state/:state
+// Returns one page of the state's zipcodes: ?limit (default DefaultPageSize)
+// and ?offset, with the total match count.
+func GetByStateHandler(w http.ResponseWriter, r *http.Request) {
+	state := chi.URLParam(r, "state")
+	if state == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "state is required"},
+		})
+		return
+	}
+	limit, offset, ok := pageParams(w, r, DefaultPageSize)
+	if !ok {
+		return
+	}
+
+	opts := queryOptions(r)
+	total, excluded, err := countMatches(opts, func(opts database.QueryOptions) (int, error) {
+		return Dataset(r).CountByState(r.Context(), state, opts)
+	})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	results, err := Dataset(r).SearchByState(r.Context(), state, opts, limit, offset)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respond(w, r, http.StatusOK, pageResponse(r, results, opts, total, excluded, limit, offset))
+}
+
+// GetStateSummaryHandler handles GET /api/v1/state/{state}/summary
+// Returns the state's zipcode and city counts and the city with the most
+// zipcodes, a rough "largest city" proxy
+func GetStateSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	state := strings.TrimSpace(chi.URLParam(r, "state"))
+	if state == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "state is required"},
+		})
+		return
+	}
+
+	summary, err := Dataset(r).GetStateSummary(r.Context(), state, queryOptions(r))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if summary == nil {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no zipcodes found for state " + strings.ToUpper(state)},
+		})
+		return
+	}
+
+	respond(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    summary,
+	})
+}
+
+// GetStateBoundsHandler handles GET /api/v1/zipcode/state/{state}/bounds
+// Returns the bounding box and centroid of the state's zipcodes, for fitting
+// a map to the state in one call
+func GetStateBoundsHandler(w http.ResponseWriter, r *http.Request) {
+	state := strings.TrimSpace(chi.URLParam(r, "state"))
+	if state == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "state is required"},
+		})
+		return
+	}
+
+	bounds, err := Dataset(r).StateBounds(r.Context(), state)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if bounds == nil {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no zipcodes with coordinates found for state " + strings.ToUpper(state)},
+		})
+		return
+	}
+
+	respondBounds(w, r, bounds, map[string]string{"state": strings.ToUpper(state)})
+}
+
+// GetCityBoundsHandler handles GET /api/v1/zipcode/city/{city}/bounds
+// Like GetStateBoundsHandler for a city; ?state= narrows a name shared by
+// several states, otherwise the box spans every city of that name
+func GetCityBoundsHandler(w http.ResponseWriter, r *http.Request) {
+	city := strings.TrimSpace(chi.URLParam(r, "city"))
+	state := strings.TrimSpace(r.URL.Query().Get("state"))
+	if city == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "city is required"},
+		})
+		return
+	}
+
+	bounds, err := Dataset(r).CityBounds(r.Context(), city, state)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if bounds == nil {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no zipcodes with coordinates found for city"},
+		})
+		return
+	}
+
+	respondBounds(w, r, bounds, map[string]string{"city": city, "state": strings.ToUpper(state)})
+}
+
+// respondBounds writes a bounds response with the centroid rounded like the
+// other centroids the API returns
+func respondBounds(w http.ResponseWriter, r *http.Request, bounds *database.Bounds, query map[string]string) {
+	bounds.Centroid.Latitude = roundTo(bounds.Centroid.Latitude, 6)
+	bounds.Centroid.Longitude = roundTo(bounds.Centroid.Longitude, 6)
+	respond(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"query":   query,
+		"data":    bounds,
+	})
+}
+
+// GetByStateNDJSONHandler handles GET /api/v1/zipcode/state/{state}.ndjson
+// Streams every zipcode in the state as newline-delimited JSON, one record per
+// line, in a single response instead of the JSON endpoint's pages
+func GetByStateNDJSONHandler(w http.ResponseWriter, r *http.Request) {
+	state := chi.URLParam(r, "state")
+	if state == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "state is required"},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "inline; filename=\""+strings.ToLower(state)+".ndjson\"")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	err := Dataset(r).StreamByState(r.Context(), state, queryOptions(r), func(zc *database.Zipcode) error {
+		applyPrecision(r, zc)
+		if err := encoder.Encode(zc); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return r.Context().Err()
+	})
+	if err != nil {
+		// Headers are already sent; the client sees a truncated stream
+		log.Printf("NDJSON stream for state %s ended early: %v", state, err)
+	}
+}
+
+// GetByGeohashHandler handles GET /api/v1/zipcode/geohash/{hash}
+// Returns every zipcode whose geohash starts with the given prefix
+func GetByGeohashHandler(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	if !database.ValidGeohash(hash) {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "hash must be a geohash of 1-12 characters"},
+		})
+		return
+	}
+
+	opts := queryOptions(r)
+	results, err := Dataset(r).SearchByGeohash(r.Context(), hash, opts)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respond(w, r, http.StatusOK, listResponse(r, results, opts))
+}
+
+// GetByFIPSHandler handles GET /api/v1/zipcode/fips/{code}
+// Returns the zipcodes in the county with the given 5-digit FIPS code. Empty
+// unless a county FIPS mapping has been loaded (--fips-file).
+func GetByFIPSHandler(w http.ResponseWriter, r *http.Request) {
+	fips := chi.URLParam(r, "code")
+	if !database.ValidFIPS(fips) {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": "FIPS code must be exactly 5 digits"},
+		})
+		return
+	}
+
+	opts := queryOptions(r)
+	results, err := Dataset(r).SearchByFIPS(r.Context(), fips, opts)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respond(w, r, http.StatusOK, listResponse(r, results, opts))
+}
+
+// GetByAreaCodeHandler handles GET /api/v1/areacode/{code}
+// Returns the zipcodes served by a telephone area code, ordered by state
+func GetByAreaCodeHandler(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	if !database.ValidAreaCode(code) {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": "area code must be a 3-digit NANP area code"},
+		})
+		return
+	}
+
+	opts := queryOptions(r)
+	results, err := Dataset(r).SearchByAreaCode(r.Context(), code, opts)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if len(results) == 0 {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "area code not found"},
+		})
+		return
+	}
+
+	respond(w, r, http.StatusOK, listResponse(r, results, opts))
+}
+
+// ListMetrosHandler handles GET /api/v1/metro
+// Lists the supported metros and the counties each one covers
+func ListMetrosHandler(w http.ResponseWriter, r *http.Request) {
+	metros := database.Metros()
+	respond(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"count":   len(metros),
+		"data":    metros,
+	})
+}
+
+// GetByMetroHandler handles GET /api/v1/metro/{slug}
+// Returns the zipcodes across a metro's counties, ordered by state
+func GetByMetroHandler(w http.ResponseWriter, r *http.Request) {
+	metro, ok := database.LookupMetro(chi.URLParam(r, "slug"))
+	if !ok {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "unknown metro; see /api/v1/metro for the supported metros"},
+		})
+		return
+	}
+
+	opts := queryOptions(r)
+	results, err := Dataset(r).SearchByMetro(r.Context(), metro, opts)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	response := listResponse(r, results, opts)
+	response["metro"] = metro
+	respond(w, r, http.StatusOK, response)
 }
 
-// SearchHandler handles zipcode search requests
-func SearchHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+// GetBySCFHandler handles GET /api/v1/zipcode/scf/{prefix}
+// Returns the zipcodes of a Sectional Center Facility (the first 3 digits)
+// with the states, city count and centroid of the area it serves
+func GetBySCFHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := chi.URLParam(r, "prefix")
+	if len(prefix) != 3 || !isNumeric(prefix) {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
-			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "query parameter 'q' is required"},
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": "SCF prefix must be exactly 3 digits"},
 		})
 		return
 	}
 
-	// Try to parse as zipcode number
-	if zipCode, err := strconv.Atoi(query); err == nil {
-		result, err := db.SearchByZipCode(zipCode)
-		if err != nil {
-			respondError(w, err)
-			return
-		}
-		if result == nil {
-			respondJSON(w, http.StatusNotFound, map[string]interface{}{
-				"success": false,
-				"error":   map[string]string{"code": "NOT_FOUND", "message": "zipcode not found"},
-			})
-			return
-		}
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"success": true,
-			"data":    result,
+	// A 3-digit SCF prefix covers only the 100 codes xxx00-xxx99, well under
+	// MaxPageSize (1000), so one maximal page always holds all of them
+	opts := queryOptions(r)
+	results, err := Dataset(r).SearchByPrefix(r.Context(), prefix, opts, database.MaxPageSize, 0)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if len(results) == 0 {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no zipcodes found for SCF " + prefix},
 		})
 		return
 	}
 
-	// Try state, city format
-	parts := strings.Split(query, ",")
-	if len(parts) == 2 {
-		state := strings.TrimSpace(parts[1])
-		city := strings.TrimSpace(parts[0])
-		results, err := db.SearchByStateAndCity(state, city)
-		if err != nil {
-			respondError(w, err)
-			return
+	states := []string{}
+	seenState := make(map[string]bool)
+	cities := make(map[string]bool)
+	for _, zc := range results {
+		if !seenState[zc.State] {
+			seenState[zc.State] = true
+			states = append(states, zc.State)
 		}
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"success": true,
-			"count":   len(results),
-			"data":    results,
+		cities[zc.State+"|"+database.NormalizeCity(zc.City)] = true
+	}
+	sort.Strings(states)
+
+	scf := map[string]interface{}{
+		"prefix":     prefix,
+		"states":     states,
+		"city_count": len(cities),
+	}
+	if lat, lon, ok := database.Centroid(results); ok {
+		scf["centroid"] = map[string]float64{"latitude": roundTo(lat, 6), "longitude": roundTo(lon, 6)}
+	}
+
+	response := listResponse(r, results, opts)
+	response["scf"] = scf
+	respond(w, r, http.StatusOK, response)
+}
+
+// ResolveHandler handles GET /api/v1/zipcode/resolve
+// Resolves a city/state (or a free-text address in q) to candidate zipcodes
+// ordered by distance from the city's centroid. This is city-level only: street
+// names and house numbers are ignored.
+func ResolveHandler(w http.ResponseWriter, r *http.Request) {
+	city := strings.TrimSpace(r.URL.Query().Get("city"))
+	state := strings.TrimSpace(r.URL.Query().Get("state"))
+	if q := r.URL.Query().Get("q"); city == "" && q != "" {
+		city, state = parseAddress(q)
+	}
+
+	if city == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "city (or q) is required"},
 		})
 		return
 	}
 
-	// Try as city name
-	if len(query) > 2 && !isNumeric(query) {
-		results, err := db.SearchByCity(query)
-		if err != nil {
-			respondError(w, err)
-			return
-		}
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"success": true,
-			"count":   len(results),
-			"data":    results,
+	opts := queryOptions(r)
+	var results []database.Zipcode
+	var err error
+	if state != "" {
+		results, err = Dataset(r).SearchByStateAndCity(r.Context(), state, city, opts)
+	} else {
+		results, err = Dataset(r).SearchByCity(r.Context(), city, opts, database.MaxPageSize, 0)
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if len(results) == 0 {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no zipcodes found for city"},
 		})
 		return
 	}
 
-	// Try as zipcode prefix
-	if isNumeric(query) {
-		results, err := db.SearchByPrefix(query)
-		if err != nil {
-			respondError(w, err)
-			return
+	response := map[string]interface{}{
+		"success":   true,
+		"precision": "city",
+		"query":     map[string]string{"city": city, "state": strings.ToUpper(state)},
+	}
+
+	// Order by centrality when the city can be placed on a map
+	if lat, lon, ok := database.Centroid(results); ok {
+		database.SortByDistance(results, lat, lon)
+		unit, perMeter := distanceUnit(r)
+		for i := range results {
+			if results[i].Distance != nil {
+				d := roundTo(*results[i].Distance*perMeter, 3)
+				results[i].Distance = &d
+			}
 		}
-		respondJSON(w, http.StatusOK, map[string]interface{}{
-			"success": true,
-			"count":   len(results),
-			"data":    results,
-		})
-		return
+		response["centroid"] = map[string]float64{"latitude": roundTo(lat, 6), "longitude": roundTo(lon, 6)}
+		response["unit"] = unit
 	}
 
-	respondJSON(w, http.StatusBadRequest, map[string]interface{}{
-		"success": false,
-		"error":   map[string]string{"code": "INVALID_QUERY", "message": "invalid query format"},
-	})
+	applyPrecisionAll(r, results)
+	response["count"] = len(results)
+	response["data"] = results
+	respond(w, r, http.StatusOK, response)
 }
 
-// GetByZipCodeHandler handles GET /api/v1/zipcode/:code
-func GetByZipCodeHandler(w http.ResponseWriter, r *http.Request) {
-	codeStr := chi.URLParam(r, "code")
-	code, err := strconv.Atoi(codeStr)
-	if err != nil {
-		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+// parseAddress extracts the city and state from a free-text US address such
+// as "1600 Pennsylvania Ave, Washington, DC 20500" or "Austin TX"
+func parseAddress(q string) (string, string) {
+	var parts []string
+	for _, part := range strings.Split(q, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", ""
+	}
+
+	// Drop a trailing zipcode ("DC 20500" or a lone "20500")
+	last := strings.Fields(parts[len(parts)-1])
+	if len(last) > 0 && isNumeric(last[len(last)-1]) {
+		last = last[:len(last)-1]
+	}
+	if len(last) == 0 {
+		parts = parts[:len(parts)-1]
+		if len(parts) == 0 {
+			return "", ""
+		}
+		last = strings.Fields(parts[len(parts)-1])
+	}
+
+	// A trailing two-letter word is the state
+	state := ""
+	if n := len(last); n > 0 && len(last[n-1]) == 2 && !isNumeric(last[n-1]) {
+		state = last[n-1]
+		last = last[:n-1]
+	}
+
+	if len(last) > 0 {
+		// "Washington DC" or "Washington, DC" where the city shares the part
+		return strings.Join(last, " "), state
+	}
+	if len(parts) >= 2 {
+		// "..., Washington, DC"
+		return parts[len(parts)-2], state
+	}
+	return "", state
+}
+
+// CityQuery is a single city/state pair in a bulk city search
+type CityQuery struct {
+	City  string `json:"city"`
+	State string `json:"state"`
+}
+
+// CityStateGroup summarizes the zipcodes of one city name within a state
+type CityStateGroup struct {
+	State          string            `json:"state"`
+	City           string            `json:"city"`
+	Count          int               `json:"count"`
+	Representative *database.Zipcode `json:"representative"`
+	ZipCodes       []string          `json:"zip_codes"`
+}
+
+// GetByCityAllStatesHandler handles GET /api/v1/zipcode/city/{city}/all
+// Returns every state with a city of that name, ordered by state, each with
+// its zipcode count and a representative zipcode (the one closest to the
+// city's centroid, or the lowest code without coordinates). Meant for
+// "which Springfield?" disambiguation.
+func GetByCityAllStatesHandler(w http.ResponseWriter, r *http.Request) {
+	city := chi.URLParam(r, "city")
+	if city == "" {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
-			"error":   map[string]string{"code": "INVALID_FORMAT", "message": "invalid zipcode format"},
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "city is required"},
 		})
 		return
 	}
 
-	result, err := db.SearchByZipCode(code)
+	// SearchByCity orders by state, so each state's records are contiguous
+	results, err := Dataset(r).SearchByCity(r.Context(), city, queryOptions(r), database.MaxPageSize, 0)
 	if err != nil {
-		respondError(w, err)
+		respondError(w, r, err)
 		return
 	}
 
-	if result == nil {
-		respondJSON(w, http.StatusNotFound, map[string]interface{}{
-			"success": false,
-			"error":   map[string]string{"code": "NOT_FOUND", "message": "zipcode not found"},
-		})
-		return
+	groups := []CityStateGroup{}
+	for start := 0; start < len(results); {
+		end := start
+		for end < len(results) && results[end].State == results[start].State {
+			end++
+		}
+		records := results[start:end]
+
+		group := CityStateGroup{
+			State:    records[0].State,
+			City:     records[0].City,
+			Count:    len(records),
+			ZipCodes: make([]string, len(records)),
+		}
+		for i := range records {
+			group.ZipCodes[i] = records[i].ZipCode
+		}
+
+		representative := records[0]
+		if lat, lon, ok := database.Centroid(records); ok {
+			database.SortByDistance(records, lat, lon)
+			representative = records[0]
+			representative.Distance = nil
+		}
+		applyPrecision(r, &representative)
+		group.Representative = &representative
+
+		groups = append(groups, group)
+		start = end
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	respond(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"data":    result,
+		"query":   city,
+		"states":  len(groups),
+		"count":   len(results),
+		"data":    groups,
 	})
 }
 
-// GetByZipCodeTextHandler handles GET /api/v1/zipcode/:code.txt
-func GetByZipCodeTextHandler(w http.ResponseWriter, r *http.Request) {
-	codeStr := chi.URLParam(r, "code")
-	code, err := strconv.Atoi(codeStr)
-	if err != nil {
-		http.Error(w, "Invalid zipcode format", http.StatusBadRequest)
+// CityResult holds the zipcodes matched for one bulk city search input
+type CityResult struct {
+	City     string             `json:"city"`
+	State    string             `json:"state"`
+	Count    int                `json:"count"`
+	Zipcodes []database.Zipcode `json:"zipcodes"`
+}
+
+// BulkCitySearchHandler handles POST /api/v1/zipcode/cities
+func BulkCitySearchHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Cities []CityQuery `json:"cities"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_BODY", "message": "invalid request body"},
+		})
 		return
 	}
 
-	result, err := db.SearchByZipCode(code)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if len(request.Cities) == 0 {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "cities is required"},
+		})
 		return
 	}
 
-	if result == nil {
-		http.Error(w, "Zipcode not found", http.StatusNotFound)
+	if limit := settings.MaxBatchSize(); len(request.Cities) > limit {
+		respondBatchTooLarge(w, r, limit, "cities")
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
-	response := formatZipcodeText(result)
-	w.Write([]byte(response))
+	// Deduplicate inputs and group city names by state so each state is one query
+	var queries []CityQuery
+	seen := make(map[string]bool)
+	byState := make(map[string][]string)
+	for _, q := range request.Cities {
+		q.City = strings.TrimSpace(q.City)
+		q.State = strings.ToUpper(strings.TrimSpace(q.State))
+		if q.City == "" {
+			continue
+		}
+
+		key := q.State + "|" + database.NormalizeCity(q.City)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		queries = append(queries, q)
+		byState[q.State] = append(byState[q.State], q.City)
+	}
+
+	// Run one IN query per state and index the matches by state and city
+	opts := queryOptions(r)
+	matches := make(map[string][]database.Zipcode)
+	for state, cities := range byState {
+		results, err := Dataset(r).SearchByCities(r.Context(), state, cities, opts)
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+		applyPrecisionAll(r, results)
+		for _, zc := range results {
+			key := state + "|" + database.NormalizeCity(zc.City)
+			matches[key] = append(matches[key], zc)
+		}
+	}
+
+	data := make([]CityResult, 0, len(queries))
+	for _, q := range queries {
+		zipcodes := matches[q.State+"|"+database.NormalizeCity(q.City)]
+		if zipcodes == nil {
+			zipcodes = []database.Zipcode{}
+		}
+		data = append(data, CityResult{
+			City:     q.City,
+			State:    q.State,
+			Count:    len(zipcodes),
+			Zipcodes: zipcodes,
+		})
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"count":   len(data),
+		"data":    data,
+	}
+	if opts.GeoOnly {
+		response["geo_only"] = true
+	}
+	respond(w, r, http.StatusOK, response)
 }
 
-// GetByCityHandler handles GET /api/v1/zipcode/city/:city
-func GetByCityHandler(w http.ResponseWriter, r *http.Request) {
-	city := chi.URLParam(r, "city")
-	if city == "" {
-		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+// CentroidHandler handles POST /api/v1/zipcode/centroid
+// Returns the geographic center of a list of zipcodes (see database.Centroid
+// for the spherical averaging), the number of codes it was computed from, and
+// the codes left out for having no coordinates or not existing.
+func CentroidHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Codes []string `json:"codes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
 			"success": false,
-			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "city is required"},
+			"error":   map[string]string{"code": "INVALID_BODY", "message": "invalid request body"},
+		})
+		return
+	}
+
+	if len(request.Codes) == 0 {
+		respond(w, r, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "codes is required"},
 		})
 		return
 	}
 
-	results, err := db.SearchByCity(city)
+	if limit := settings.MaxBatchSize(); len(request.Codes) > limit {
+		respondBatchTooLarge(w, r, limit, "codes")
+		return
+	}
+
+	var codes []string
+	seen := make(map[string]bool)
+	for _, c := range request.Codes {
+		code, err := database.ParseZipCode(strings.TrimSpace(c))
+		if err != nil {
+			respond(w, r, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_FORMAT", "message": err.Error()},
+			})
+			return
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+
+	results, err := Dataset(r).SearchByZipCodes(r.Context(), codes)
 	if err != nil {
-		respondError(w, err)
+		respondError(w, r, err)
+		return
+	}
+
+	found := make(map[string]bool, len(results))
+	used := make([]database.Zipcode, 0, len(results))
+	skipped := []string{}
+	for _, zc := range results {
+		found[zc.ZipCode] = true
+		if _, _, ok := zc.Coordinates(); ok {
+			used = append(used, zc)
+		} else {
+			skipped = append(skipped, zc.ZipCode)
+		}
+	}
+	notFound := []string{}
+	for _, code := range codes {
+		if !found[code] {
+			notFound = append(notFound, code)
+		}
+	}
+
+	lat, lon, ok := database.Centroid(used)
+	if !ok {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "none of the zipcodes have coordinates"},
+		})
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	respond(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"count":   len(results),
-		"data":    results,
+		"data": map[string]interface{}{
+			"latitude":  roundTo(lat, 6),
+			"longitude": roundTo(lon, 6),
+			"count":     len(used),
+			"skipped":   skipped,
+			"not_found": notFound,
+		},
 	})
 }
 
-// GetByStateHandler handles GET /api/v1/zipcode/state/:state
-func GetByStateHandler(w http.ResponseWriter, r *http.Request) {
-	state := chi.URLParam(r, "state")
-	if state == "" {
-		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+// TimezoneHandler handles GET /api/v1/zipcode/timezone?lat=&lng= (or &lon=)
+// Returns the IANA timezone at a US location from the embedded boundary data
+// (see database.TimezoneForCoords) with its current UTC offset.
+func TimezoneHandler(w http.ResponseWriter, r *http.Request) {
+	lat, lon, ok := parseCoordinates(w, r)
+	if !ok {
+		return
+	}
+
+	zone := database.TimezoneForCoords(lat, lon)
+	if zone == "" {
+		respond(w, r, http.StatusNotFound, map[string]interface{}{
 			"success": false,
-			"error":   map[string]string{"code": "MISSING_PARAMETER", "message": "state is required"},
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "no US timezone at these coordinates"},
 		})
 		return
 	}
 
-	results, err := db.SearchByState(state)
-	if err != nil {
-		respondError(w, err)
-		return
+	data := map[string]interface{}{
+		"latitude":  lat,
+		"longitude": lon,
+		"timezone":  zone,
+	}
+	if loc, err := time.LoadLocation(zone); err == nil {
+		now := time.Now().In(loc)
+		abbr, _ := now.Zone()
+		data["abbreviation"] = abbr
+		data["utc_offset"] = now.Format("-07:00")
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	respond(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"count":   len(results),
-		"data":    results,
+		"data":    data,
 	})
 }
 
 // AutoCompleteHandler handles GET /api/v1/zipcode/autocomplete
+// Suggestions are "City, ST" strings, or with ?structured=true objects with
+// the city, state and a zipcode to fill in directly
 func AutoCompleteHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		respondJSON(w, http.StatusOK, map[string]interface{}{
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	structured, _ := strconv.ParseBool(r.URL.Query().Get("structured"))
+
+	// Short prefixes match huge result sets; skip the DB until the user has typed more
+	if query == "" || len([]rune(query)) < autocompleteMinChars() {
+		var empty interface{} = []string{}
+		if structured {
+			empty = []database.Suggestion{}
+		}
+		respond(w, r, http.StatusOK, map[string]interface{}{
 			"success":     true,
-			"suggestions": []string{},
+			"suggestions": empty,
 		})
 		return
 	}
@@ -234,27 +1377,55 @@ func AutoCompleteHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	suggestions, err := db.AutoComplete(query, limit)
+	if structured {
+		suggestions, err := Dataset(r).AutoCompleteStructured(r.Context(), query, limit)
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+		respond(w, r, http.StatusOK, map[string]interface{}{
+			"success":     true,
+			"suggestions": suggestions,
+		})
+		return
+	}
+
+	suggestions, err := Dataset(r).AutoComplete(r.Context(), query, limit)
 	if err != nil {
-		respondError(w, err)
+		respondError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	respond(w, r, http.StatusOK, map[string]interface{}{
 		"success":     true,
 		"suggestions": suggestions,
 	})
 }
 
+// defaultAutocompleteMinChars is the minimum query length when unset
+const defaultAutocompleteMinChars = 2
+
+// autocompleteMinChars returns the configured minimum autocomplete query length
+func autocompleteMinChars() int {
+	if settings == nil {
+		return defaultAutocompleteMinChars
+	}
+	n := settings.GetInt("features.autocomplete_min_chars", defaultAutocompleteMinChars)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
 // StatsHandler handles GET /api/v1/zipcode/stats
 func StatsHandler(w http.ResponseWriter, r *http.Request) {
-	stats, err := db.GetStats()
+	stats, err := Dataset(r).GetStats(r.Context())
 	if err != nil {
-		respondError(w, err)
+		respondError(w, r, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
+	respond(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"data":    stats,
 	})
@@ -262,37 +1433,147 @@ func StatsHandler(w http.ResponseWriter, r *http.Request) {
 
 // RawJSONHandler serves the raw zipcodes.json file from embedded data
 func RawJSONHandler(w http.ResponseWriter, r *http.Request) {
-	// Serve embedded JSON
+	// Serve the loaded dataset (embedded or --data-file)
+	var data []byte
+	if isCandidate(r) {
+		data = candidateJSON
+	} else if p := zipcodesJSON.Load(); p != nil {
+		data = *p
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "inline; filename=\"zipcodes.json\"")
 	w.WriteHeader(http.StatusOK)
-	w.Write(zipcodesJSON)
+	w.Write(data)
 }
 
 // Helper functions
 
-func respondJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-
-	// Wrap response with timestamp if not already present
-	if m, ok := data.(map[string]interface{}); ok {
-		if _, hasTimestamp := m["timestamp"]; !hasTimestamp {
-			m["timestamp"] = time.Now().Format(time.RFC3339)
-		}
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		respond(w, r, http.StatusGatewayTimeout, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "QUERY_TIMEOUT", "message": "database query timed out"},
+		})
+		return
 	}
-
-	json.NewEncoder(w).Encode(data)
-}
-
-func respondError(w http.ResponseWriter, err error) {
-	respondJSON(w, http.StatusInternalServerError, map[string]interface{}{
+	respond(w, r, http.StatusInternalServerError, map[string]interface{}{
 		"success":   false,
 		"error":     map[string]string{"message": err.Error()},
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
 
+// respondBatchTooLarge rejects a batch over the features.max_batch_size cap
+// with 413, including the effective cap so clients can split the batch
+func respondBatchTooLarge(w http.ResponseWriter, r *http.Request, limit int, noun string) {
+	respond(w, r, http.StatusRequestEntityTooLarge, map[string]interface{}{
+		"success": false,
+		"error": map[string]interface{}{
+			"code":           "BATCH_TOO_LARGE",
+			"message":        "maximum " + strconv.Itoa(limit) + " " + noun + " per request",
+			"max_batch_size": limit,
+		},
+	})
+}
+
+// parseLatLonPair detects a "lat, lon" pair such as "37.7749, -122.4194"
+// Both parts must parse as numbers within valid ranges, so "City, ST" never matches
+func parseLatLonPair(s string) (float64, float64, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !database.ValidCoordinates(lat, lon) {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// distanceUnit returns the requested distance unit ("km" or "mi") and its size per meter
+func distanceUnit(r *http.Request) (string, float64) {
+	if strings.EqualFold(r.URL.Query().Get("unit"), "mi") {
+		return "mi", 1 / 1609.344
+	}
+	return "km", 1 / 1000.0
+}
+
+// roundTo rounds f to the given number of decimal places
+func roundTo(f float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(f*scale) / scale
+}
+
+// queryOptions reads the list filters shared by the list endpoints
+func queryOptions(r *http.Request) database.QueryOptions {
+	geo, _ := strconv.ParseBool(r.URL.Query().Get("geo"))
+	return database.QueryOptions{GeoOnly: geo}
+}
+
+// maxCoordinatePrecision is the most decimal places ?precision accepts
+// (7 places is about 1cm, already finer than the source data)
+const maxCoordinatePrecision = 7
+
+// coordinatePrecision reads ?precision, clamped to 0-7
+// Returns false when absent or not a number, meaning source precision is kept
+func coordinatePrecision(r *http.Request) (int, bool) {
+	p, err := strconv.Atoi(r.URL.Query().Get("precision"))
+	if err != nil {
+		return 0, false
+	}
+	if p < 0 {
+		p = 0
+	}
+	if p > maxCoordinatePrecision {
+		p = maxCoordinatePrecision
+	}
+	return p, true
+}
+
+// applyPrecision rounds the coordinates of zipcodes to the requested precision
+func applyPrecision(r *http.Request, zipcodes ...*database.Zipcode) {
+	p, ok := coordinatePrecision(r)
+	if !ok {
+		return
+	}
+	for _, zc := range zipcodes {
+		zc.RoundCoordinates(p)
+	}
+}
+
+// applyPrecisionAll is applyPrecision for a slice of zipcodes
+func applyPrecisionAll(r *http.Request, zipcodes []database.Zipcode) {
+	for i := range zipcodes {
+		applyPrecision(r, &zipcodes[i])
+	}
+}
+
+// listResponse builds the standard envelope for a list of zipcodes
+// With geo=true the count only includes records that have coordinates
+func listResponse(r *http.Request, results []database.Zipcode, opts database.QueryOptions) map[string]interface{} {
+	if results == nil {
+		// Clients read data.length, so an empty list must not encode as null
+		results = []database.Zipcode{}
+	}
+	applyPrecisionAll(r, results)
+	response := map[string]interface{}{
+		"success": true,
+		"count":   len(results),
+		"data":    results,
+	}
+	if opts.GeoOnly {
+		response["geo_only"] = true
+	}
+	return response
+}
+
 func isNumeric(s string) bool {
 	for _, c := range s {
 		if c < '0' || c > '9' {
@@ -306,28 +1587,40 @@ func formatZipcodeText(zc *database.Zipcode) string {
 	var sb strings.Builder
 
 	sb.WriteString("Zip Code: ")
-	sb.WriteString(strconv.Itoa(zc.ZipCode))
+	sb.WriteString(database.FormatZipPlus4(zc.ZipCode, zc.Plus4))
 	sb.WriteString("\n")
 
 	sb.WriteString("City: ")
-	sb.WriteString(zc.City)
+	sb.WriteString(utils.SanitizeText(zc.City))
 	sb.WriteString("\n")
 
 	sb.WriteString("State: ")
-	sb.WriteString(zc.State)
+	sb.WriteString(utils.SanitizeText(zc.State))
 	sb.WriteString("\n")
 
 	if zc.County != "" {
 		sb.WriteString("County: ")
-		sb.WriteString(zc.County)
+		sb.WriteString(utils.SanitizeText(zc.County))
+		sb.WriteString("\n")
+	}
+
+	if zc.FIPS != "" {
+		sb.WriteString("County FIPS: ")
+		sb.WriteString(utils.SanitizeText(zc.FIPS))
+		sb.WriteString("\n")
+	}
+
+	if zc.Timezone != "" {
+		sb.WriteString("Timezone: ")
+		sb.WriteString(utils.SanitizeText(zc.Timezone))
 		sb.WriteString("\n")
 	}
 
 	if zc.Latitude != "" && zc.Longitude != "" {
 		sb.WriteString("Coordinates: ")
-		sb.WriteString(zc.Latitude)
+		sb.WriteString(utils.SanitizeText(zc.Latitude))
 		sb.WriteString(", ")
-		sb.WriteString(zc.Longitude)
+		sb.WriteString(utils.SanitizeText(zc.Longitude))
 		sb.WriteString("\n")
 	}
 
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// testZipcodes is a small dataset for handler tests
+const testZipcodes = `[
+	{"state": "MA", "city": "Agawam", "county": "Hampden", "zip_code": 1001, "latitude": "42.0702", "longitude": "-72.6227"},
+	{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2101, "latitude": "42.3706", "longitude": "-71.0270"},
+	{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2108, "latitude": "42.3576", "longitude": "-71.0684"},
+	{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2199, "latitude": "", "longitude": ""},
+	{"state": "NY", "city": "Holtsville", "county": "Suffolk", "zip_code": 501, "latitude": "40.8154", "longitude": "-73.0451"}
+]`
+
+// setupTestDB loads testZipcodes into a fresh database and makes it the one
+// handlers read from for the rest of the test
+func setupTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	dataset, err := database.Initialize(filepath.Join(t.TempDir(), "zipcodes.db"))
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := dataset.LoadFromJSON([]byte(testZipcodes)); err != nil {
+		t.Fatalf("LoadFromJSON: %v", err)
+	}
+
+	old := db
+	SetDatabase(dataset)
+	t.Cleanup(func() {
+		db = old
+		dataset.Close()
+	})
+	return dataset
+}
+
+// serve runs handler on req and decodes the JSON envelope it responds with
+func serve(t *testing.T, handler http.HandlerFunc, req *http.Request) (int, map[string]json.RawMessage) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("%s %s: invalid JSON %q: %v", req.Method, req.URL, rec.Body.String(), err)
+	}
+	return rec.Code, envelope
+}
+
+// withURLParams routes req as chi would, with the given URL parameters
+func withURLParams(req *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestSearchNoMatchesReturnsEmptyArray(t *testing.T) {
+	setupTestDB(t)
+
+	for _, q := range []string{"Nowhere", "Nowhere,%20ZZ", "999"} {
+		status, envelope := serve(t, SearchHandler, httptest.NewRequest(http.MethodGet, "/api/v1/zipcode/search?q="+q, nil))
+		if status != http.StatusOK {
+			t.Errorf("q=%s: status %d, want 200", q, status)
+			continue
+		}
+		if got := string(envelope["data"]); got != "[]" {
+			t.Errorf("q=%s: data = %s, want []", q, got)
+		}
+	}
+}
+
+// jsonRequest builds a POST request with body encoded as JSON
+func jsonRequest(t *testing.T, target string, body interface{}) *http.Request {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestBatchCapBoundary(t *testing.T) {
+	setupTestDB(t)
+	limit := settings.MaxBatchSize()
+
+	codes := func(n int) map[string]interface{} {
+		list := []string{"01001"}
+		for code := 90000; len(list) < n; code++ {
+			list = append(list, database.FormatZipCode(code))
+		}
+		return map[string]interface{}{"codes": list}
+	}
+	cities := func(n int) map[string]interface{} {
+		list := []CityQuery{{City: "Boston", State: "MA"}}
+		for i := 0; len(list) < n; i++ {
+			list = append(list, CityQuery{City: fmt.Sprintf("Nowhere %d", i), State: "MA"})
+		}
+		return map[string]interface{}{"cities": list}
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		body    func(int) map[string]interface{}
+	}{
+		{"centroid", CentroidHandler, "/api/v1/zipcode/centroid", codes},
+		{"cities", BulkCitySearchHandler, "/api/v1/zipcode/cities", cities},
+	}
+	for _, tt := range tests {
+		status, _ := serve(t, tt.handler, jsonRequest(t, tt.target, tt.body(limit)))
+		if status != http.StatusOK {
+			t.Errorf("%s with exactly %d items: status %d, want 200", tt.name, limit, status)
+		}
+
+		status, envelope := serve(t, tt.handler, jsonRequest(t, tt.target, tt.body(limit+1)))
+		if status != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s with %d items: status %d, want 413", tt.name, limit+1, status)
+		}
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(envelope["error"], &apiErr)
+		if apiErr.Code != "BATCH_TOO_LARGE" {
+			t.Errorf("%s with %d items: error code %q, want BATCH_TOO_LARGE", tt.name, limit+1, apiErr.Code)
+		}
+	}
+}
+
+func TestGeoFilterReportsExcluded(t *testing.T) {
+	setupTestDB(t)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		req     *http.Request
+	}{
+		{"state", GetByStateHandler, withURLParams(httptest.NewRequest(http.MethodGet, "/api/v1/zipcode/state/MA?geo=true", nil), map[string]string{"state": "MA"})},
+		{"city", GetByCityHandler, withURLParams(httptest.NewRequest(http.MethodGet, "/api/v1/zipcode/city/Boston?geo=true", nil), map[string]string{"city": "Boston"})},
+		{"prefix", SearchHandler, httptest.NewRequest(http.MethodGet, "/api/v1/zipcode/search?q=021&geo=true", nil)},
+	}
+	for _, tt := range tests {
+		status, envelope := serve(t, tt.handler, tt.req)
+		if status != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", tt.name, status)
+			continue
+		}
+		// 02199 has no coordinates
+		for field, want := range map[string]string{"geo_only": "true", "geo_excluded": "1"} {
+			if got := string(envelope[field]); got != want {
+				t.Errorf("%s: %s = %s, want %s", tt.name, field, got, want)
+			}
+		}
+	}
+
+	status, envelope := serve(t, GetByStateHandler, withURLParams(httptest.NewRequest(http.MethodGet, "/api/v1/zipcode/state/MA", nil), map[string]string{"state": "MA"}))
+	if status != http.StatusOK {
+		t.Fatalf("without geo: status %d, want 200", status)
+	}
+	if _, ok := envelope["geo_excluded"]; ok {
+		t.Errorf("without geo: geo_excluded is present")
+	}
+}
+
+func TestCoordinateParameters(t *testing.T) {
+	setupTestDB(t)
+
+	handlers := map[string]http.HandlerFunc{
+		"/api/v1/zipcode/near?radius=10&": GetNearHandler,
+		"/api/v1/geocode/reverse?":        ReverseGeocodeHandler,
+		"/api/v1/zipcode/timezone?":       TimezoneHandler,
+	}
+	tests := []struct {
+		params string
+		status int
+		code   string
+	}{
+		{"lat=42.37&lng=-71.03", http.StatusOK, ""},
+		{"lat=42.37&lon=-71.03", http.StatusOK, ""},
+		{"lng=-71.03", http.StatusBadRequest, "MISSING_PARAMETER"},
+		{"lat=42.37", http.StatusBadRequest, "MISSING_PARAMETER"},
+		{"lat=north&lng=-71.03", http.StatusBadRequest, "INVALID_PARAMETER"},
+		{"lat=91&lng=-71.03", http.StatusBadRequest, "INVALID_PARAMETER"},
+		{"lat=42.37&lng=-181", http.StatusBadRequest, "INVALID_PARAMETER"},
+	}
+	for prefix, handler := range handlers {
+		for _, tt := range tests {
+			target := prefix + tt.params
+			status, envelope := serve(t, handler, httptest.NewRequest(http.MethodGet, target, nil))
+			if status != tt.status {
+				t.Errorf("%s: status %d, want %d", target, status, tt.status)
+				continue
+			}
+			var apiErr struct {
+				Code string `json:"code"`
+			}
+			json.Unmarshal(envelope["error"], &apiErr)
+			if apiErr.Code != tt.code {
+				t.Errorf("%s: error code %q, want %q", target, apiErr.Code, tt.code)
+			}
+		}
+	}
+}
+
+func TestNearGroupByCity(t *testing.T) {
+	setupTestDB(t)
+
+	// All three Massachusetts records with coordinates are within 200 km
+	status, envelope := serve(t, GetNearHandler, httptest.NewRequest(http.MethodGet,
+		"/api/v1/zipcode/near?lat=42.36&lng=-71.06&radius=200&group=city", nil))
+	if status != http.StatusOK {
+		t.Fatalf("status %d, want 200", status)
+	}
+	var cities []database.NearbyCity
+	if err := json.Unmarshal(envelope["nearby_cities"], &cities); err != nil {
+		t.Fatalf("nearby_cities: %v", err)
+	}
+	if len(cities) != 2 || cities[0].City != "Boston" || cities[0].Count != 2 || cities[1].City != "Agawam" {
+		t.Errorf("nearby_cities = %+v, want Boston (2) then Agawam", cities)
+	}
+	if _, ok := envelope["data"]; ok {
+		t.Errorf("grouped response also has data")
+	}
+
+	status, envelope = serve(t, GetNearHandler, httptest.NewRequest(http.MethodGet,
+		"/api/v1/zipcode/near?lat=42.36&lng=-71.06&radius=200&group=city&limit=1", nil))
+	if status != http.StatusOK {
+		t.Fatalf("limit=1: status %d, want 200", status)
+	}
+	if got, want := string(envelope["count"])+"/"+string(envelope["total"]), "1/2"; got != want {
+		t.Errorf("limit=1: count/total = %s, want %s", got, want)
+	}
+
+	status, _ = serve(t, GetNearHandler, httptest.NewRequest(http.MethodGet,
+		"/api/v1/zipcode/near?lat=42.36&lng=-71.06&radius=200&group=state", nil))
+	if status != http.StatusBadRequest {
+		t.Errorf("group=state: status %d, want 400", status)
+	}
+}
+
+func TestGetByZipCodePadsZipCode(t *testing.T) {
+	setupTestDB(t)
+
+	for _, code := range []string{"01001", "00501", "02101"} {
+		req := withURLParams(httptest.NewRequest(http.MethodGet, "/api/v1/zipcode/"+code, nil), map[string]string{"code": code})
+		status, envelope := serve(t, GetByZipCodeHandler, req)
+		if status != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", code, status)
+			continue
+		}
+		var data struct {
+			ZipCode json.RawMessage `json:"zip_code"`
+		}
+		if err := json.Unmarshal(envelope["data"], &data); err != nil {
+			t.Fatalf("%s: data %s: %v", code, envelope["data"], err)
+		}
+		if got, want := string(data.ZipCode), `"`+code+`"`; got != want {
+			t.Errorf("%s: zip_code = %s, want %s", code, got, want)
+		}
+	}
+}
@@ -3,14 +3,18 @@ package database
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/apimgr/zipcodes/src/utils"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // InitializeAdminSchema creates admin-only authentication tables
@@ -26,6 +30,26 @@ func InitializeAdminSchema(db *sql.DB) error {
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Admin sessions table (web UI login sessions)
+	CREATE TABLE IF NOT EXISTS admin_sessions (
+		token_hash TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- API tokens table (bearer tokens for gated public routes)
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(8)))),
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_used DATETIME,
+		revoked_at DATETIME
+	);
+
 	-- Settings table
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
@@ -65,9 +89,21 @@ func InitializeAdminSchema(db *sql.DB) error {
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Lookup history (features.track_lookups)
+	CREATE TABLE IF NOT EXISTS lookup_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		query TEXT NOT NULL,
+		found INTEGER NOT NULL,
+		country_code TEXT,
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
 	-- Indexes for performance
 	CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_lookup_history_kind_timestamp ON lookup_history(kind, timestamp);
 	CREATE INDEX IF NOT EXISTS idx_settings_category ON settings(category);
+	CREATE INDEX IF NOT EXISTS idx_admin_sessions_expires_at ON admin_sessions(expires_at);
 	`
 
 	_, err := db.Exec(schema)
@@ -80,6 +116,11 @@ func InitializeAdminSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to insert default settings: %w", err)
 	}
 
+	// Seed built-in scheduled tasks
+	if err := insertDefaultScheduledTasks(db); err != nil {
+		return fmt.Errorf("failed to insert default scheduled tasks: %w", err)
+	}
+
 	// Initialize admin credentials silently (don't display yet)
 	if err := initializeAdminCredentials(db); err != nil {
 		return fmt.Errorf("failed to initialize admin credentials: %w", err)
@@ -89,8 +130,11 @@ func InitializeAdminSchema(db *sql.DB) error {
 }
 
 // DisplayAdminCredentials displays admin credentials with server URL
-// Should be called AFTER port is determined
-func DisplayAdminCredentials(db *sql.DB, port, address string) error {
+// Should be called AFTER port is determined. serverInfo, if non-nil, is only
+// called when the banner is actually shown and may return "" to skip the line.
+// In quiet mode the credentials are only written to the credentials file and
+// stdout just says where to find them.
+func DisplayAdminCredentials(db *sql.DB, port, address string, serverInfo func() string, quiet bool) error {
 	// Check if credentials were just created
 	var username, password, token string
 	var createdAt time.Time
@@ -119,11 +163,33 @@ func DisplayAdminCredentials(db *sql.DB, port, address string) error {
 	// Get config directory for file path
 	configDir := os.Getenv("CONFIG_DIR")
 
+	// Admin URLs follow server.admin_path and server.admin_api_path
+	settings := NewSettings(db)
+	webPath, apiPath := settings.AdminPath(), settings.AdminAPIPath()
+
 	// Write credentials file with port
 	if configDir != "" {
-		writeCredentialsFileWithPort(configDir, username, password, token, port, address)
+		writeCredentialsFileWithPort(configDir, username, password, token, port, address, webPath, apiPath)
+	}
+
+	if quiet {
+		if configDir != "" {
+			fmt.Printf("Admin credentials written to %s\n", filepath.Join(configDir, "admin_credentials"))
+		}
+		return nil
 	}
 
+	var info string
+	if serverInfo != nil {
+		info = serverInfo()
+	}
+	printCredentials(username, password, token, port, address, webPath, info, configDir)
+	return nil
+}
+
+// printCredentials prints the credentials banner; info is the optional
+// server location line
+func printCredentials(username, password, token, port, address, webPath, info, configDir string) {
 	// Get display address
 	displayAddr := utils.GetDisplayAddress(address)
 
@@ -132,20 +198,23 @@ func DisplayAdminCredentials(db *sql.DB, port, address string) error {
 	fmt.Println("ZIPCODES API - ADMIN CREDENTIALS")
 	fmt.Println("========================================")
 	fmt.Println("WEB UI LOGIN:")
-	fmt.Printf("  URL:      http://%s:%s/admin\n", displayAddr, port)
+	fmt.Printf("  URL:      http://%s:%s%s\n", displayAddr, port, webPath)
 	fmt.Printf("  Username: %s\n", username)
 	fmt.Printf("  Password: %s\n", password)
 	fmt.Println("\nAPI TOKEN:")
 	fmt.Printf("  Header:   Authorization: Bearer %s\n", token)
 	fmt.Printf("  Token:    %s\n", token)
+	if info != "" {
+		fmt.Println("\nSERVER:")
+		fmt.Printf("  Outbound IP: %s\n", info)
+	}
 	if configDir != "" {
 		fmt.Printf("\nCredentials saved to: %s/admin_credentials\n", configDir)
 	}
 	fmt.Println("\n⚠️  Save these credentials securely!")
 	fmt.Println("They will not be shown again.")
-	fmt.Println("========================================\n")
-
-	return nil
+	fmt.Println("========================================")
+	fmt.Println()
 }
 
 // insertAdminDefaultSettings adds default server settings
@@ -162,13 +231,57 @@ func insertAdminDefaultSettings(db *sql.DB) error {
 		{"server.description", "Fast and accurate US zipcode lookup API with 340,000+ zipcodes, GeoIP integration, and modern web interface.", "string", "server", "Full description"},
 		{"server.address", "0.0.0.0", "string", "server", "Listen address"},
 		{"server.http_port", "64080", "number", "server", "HTTP port"},
-		{"server.https_enabled", "false", "boolean", "server", "Enable HTTPS"},
+		{"server.https_enabled", "false", "boolean", "server", "Enable HTTPS with a Let's Encrypt certificate for server.tls_domains (--tls-cert/--tls-key enable it on their own); applied on restart"},
+		{"server.tls_domains", "", "string", "server", "Comma-separated domains to request Let's Encrypt certificates for when HTTPS is on; applied on restart"},
+		{"server.acme_email", "", "string", "server", "Contact email given to Let's Encrypt (optional)"},
+		{"server.https_redirect_port", "0", "number", "server", "With HTTPS on, also listen on this port (usually 80) and redirect to HTTPS, answering ACME challenges (0 = off); applied on restart"},
 		{"server.timezone", "UTC", "string", "server", "Server timezone"},
 		{"server.date_format", "US", "string", "server", "Date format (US, EU, ISO)"},
 		{"server.time_format", "12-hour", "string", "server", "Time format (12-hour, 24-hour)"},
+		{"server.compression_level", "5", "number", "server", "Response gzip level, 1 (fastest) to 9 (smallest); applied on restart"},
+		{"server.h2c_enabled", "false", "boolean", "server", "Also accept HTTP/2 without TLS (h2c) on the plain listener; applied on restart"},
+		{"server.max_concurrent", "0", "number", "server", "Maximum requests handled at once, beyond which clients get 503 (0 = unlimited); applied on restart"},
+		{"server.admin_path", "/admin", "string", "server", "Mount path of the admin web UI; applied on restart"},
+		{"server.admin_api_path", "/api/v1/admin", "string", "server", "Mount path of the admin API, under /api/v1/; applied on restart"},
+		{"security.session_timeout", "43200", "number", "security", "Session timeout in minutes (30 days)"},
+		{"security.bcrypt_cost", "12", "number", "security", "bcrypt cost of the admin password hash (4-31); a changed cost re-hashes the password at the next login"},
+		{"security.session_cookie_name", "zipcodes_session", "string", "security", "Admin session cookie name"},
+		{"security.session_cookie_domain", "", "string", "security", "Admin session cookie domain (empty for host-only)"},
+		{"security.rate_limit_rpm", "120", "number", "security", "API requests per minute per client IP (0 disables)"},
+		{"security.autocomplete_rate_limit_rpm", "60", "number", "security", "Autocomplete requests per minute per client IP (0 disables)"},
 		{"proxy.enabled", "true", "boolean", "proxy", "Enable reverse proxy support"},
 		{"proxy.trust_headers", "true", "boolean", "proxy", "Trust proxy headers"},
+		{"proxy.client_ip_headers", "", "string", "proxy", "Comma-separated client IP headers checked before X-Forwarded-For (e.g. CF-Connecting-IP)"},
+		{"proxy.allowed_hosts", "", "string", "proxy", "Comma-separated public hostnames accepted from X-Forwarded-Host/Forwarded for generated URLs (e.g. api.example.com,*.example.com; empty ignores them)"},
+		{"proxy.cors_origins", "*", "string", "proxy", "Comma-separated origins allowed by CORS (* for any)"},
+		{"proxy.cors_origins_geoip", "", "string", "proxy", "Comma-separated origins allowed by CORS on /api/v1/geoip routes (empty uses proxy.cors_origins)"},
 		{"features.api_enabled", "true", "boolean", "features", "Enable API endpoints"},
+		{"features.max_batch_size", "100", "number", "features", "Maximum items per request on batch endpoints (GeoIP batch, bulk cities, centroid)"},
+		{"features.city_search_limit", "200", "number", "features", "Default number of zipcodes returned by city searches (?limit overrides, up to 1000)"},
+		{"features.autocomplete_min_chars", "2", "number", "features", "Minimum autocomplete query length; shorter queries return no suggestions"},
+		{"features.shared_cache", "false", "boolean", "features", "Cache zipcode API responses in the database, shared by every instance using it (adds write traffic)"},
+		{"features.shared_cache_ttl", "300", "number", "features", "Seconds a shared cache entry is served before it is refreshed"},
+		{"features.geoip_require_auth", "false", "boolean", "features", "Require a bearer token (admin or API token) on /api/v1/geoip routes"},
+		{"db.query_timeout", "10", "number", "db", "Seconds a public API request's database queries may run before they are cancelled (0 disables)"},
+		{"features.track_lookups", "false", "boolean", "features", "Record zipcode and GeoIP lookups (zipcode or IP, time, found) in lookup_history for the admin history report"},
+		{"features.track_lookups_sample_percent", "100", "number", "features", "Percentage of lookups recorded while features.track_lookups is on (100 records all)"},
+		{"audit.retention_days", "90", "number", "audit", "Days of audit log kept by the audit-prune scheduled task"},
+		{"history.retention_days", "30", "number", "history", "Days of lookup history kept by the history-prune scheduled task"},
+		{"backup.keep", "7", "number", "backup", "Number of backups kept by the backup scheduled task"},
+		{"cache_control.dataset", "public, max-age=86400", "string", "cache_control", "Cache-Control for /api/v1/zipcodes.json (empty sends none)"},
+		{"cache_control.zipcode", "public, max-age=3600", "string", "cache_control", "Cache-Control for zipcode lookups and searches"},
+		{"cache_control.geoip", "public, max-age=3600", "string", "cache_control", "Cache-Control for GeoIP lookups of an explicit ?ip="},
+		{"cache_control.geoip_self", "no-store", "string", "cache_control", "Cache-Control for GeoIP lookups of the caller's own IP (keep no-store so CDNs never share them)"},
+		{"attribution.zipcodes_source", "US Postal Service ZIP Code data", "string", "attribution", "Zipcode dataset source shown by /api/v1/attribution"},
+		{"attribution.zipcodes_license", "", "string", "attribution", "Zipcode dataset license (empty omits it)"},
+		{"attribution.zipcodes_url", "https://github.com/apimgr/zipcodes", "string", "attribution", "Zipcode dataset URL"},
+		{"attribution.geoip_source", "MaxMind GeoLite2 and sapics/ip-location-db", "string", "attribution", "GeoIP database source"},
+		{"attribution.geoip_license", "CC BY-SA 4.0", "string", "attribution", "GeoIP database license"},
+		{"attribution.geoip_url", "https://github.com/sapics/ip-location-db", "string", "attribution", "GeoIP database URL"},
+		{"attribution.geoip_notice", "This product includes GeoLite2 data created by MaxMind, available from https://www.maxmind.com.", "string", "attribution", "Attribution notice required by the GeoIP data license"},
+		{"attribution.header", "false", "boolean", "attribution", "Add an X-Data-Attribution header to zipcode and GeoIP responses"},
+		{"geoip.auto_update", "false", "boolean", "geoip", "Check for and download GeoIP database updates daily"},
+		{"geoip.show_server_location", "true", "boolean", "geoip", "Show the server's outbound IP and GeoIP location in the first-run credentials banner"},
 	}
 
 	for _, setting := range defaults {
@@ -217,7 +330,10 @@ func initializeAdminCredentials(db *sql.DB) error {
 	}
 
 	// Hash password and token
-	passwordHash := hashString(password)
+	passwordHash, err := hashPassword(db, password)
+	if err != nil {
+		return err
+	}
 	tokenHash := hashString(token)
 
 	// Insert admin credentials
@@ -237,8 +353,77 @@ func initializeAdminCredentials(db *sql.DB) error {
 	return nil
 }
 
+// ResetAdminCredentials replaces the admin password and token, using
+// ADMIN_USER, ADMIN_PASSWORD and ADMIN_TOKEN when set and generating the rest
+// as on first run. Existing admin web sessions are signed out. The new
+// credentials are written to {CONFIG_DIR}/admin_credentials and printed once.
+func ResetAdminCredentials(db *sql.DB, port, address string) error {
+	username := os.Getenv("ADMIN_USER")
+	if username == "" {
+		if err := db.QueryRow("SELECT username FROM admin_credentials WHERE id = 1").Scan(&username); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	if username == "" {
+		username = "administrator"
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		password = generateRandomString(16)
+	}
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		token = generateRandomString(64)
+	}
+
+	passwordHash, err := hashPassword(db, password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO admin_credentials (id, username, password_hash, token_hash)
+		VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			username = excluded.username,
+			password_hash = excluded.password_hash,
+			token_hash = excluded.token_hash,
+			updated_at = CURRENT_TIMESTAMP
+	`, username, passwordHash, hashString(token))
+	if err != nil {
+		return fmt.Errorf("failed to update admin credentials: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM admin_sessions"); err != nil {
+		return fmt.Errorf("failed to sign out admin sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	settings := NewSettings(db)
+	webPath, apiPath := settings.AdminPath(), settings.AdminAPIPath()
+
+	configDir := os.Getenv("CONFIG_DIR")
+	if configDir != "" {
+		if err := writeCredentialsFileWithPort(configDir, username, password, token, port, address, webPath, apiPath); err != nil {
+			return fmt.Errorf("failed to write credentials file: %w", err)
+		}
+	}
+
+	printCredentials(username, password, token, port, address, webPath, "", configDir)
+	return nil
+}
+
 // writeCredentialsFileWithPort writes credentials to a file with proper URL including port
-func writeCredentialsFileWithPort(configDir, username, password, token, port, address string) error {
+func writeCredentialsFileWithPort(configDir, username, password, token, port, address, webPath, apiPath string) error {
 	// Create config directory if it doesn't exist
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return err
@@ -252,12 +437,12 @@ func writeCredentialsFileWithPort(configDir, username, password, token, port, ad
 	content := fmt.Sprintf(`ZIPCODES API - ADMIN CREDENTIALS
 ========================================
 WEB UI LOGIN:
-  URL:      http://%s:%s/admin
+  URL:      http://%s:%s%s
   Username: %s
   Password: %s
 
 API TOKEN:
-  URL:      http://%s:%s/api/v1/admin
+  URL:      http://%s:%s%s
   Header:   Authorization: Bearer %s
   Token:    %s
 
@@ -266,7 +451,7 @@ Created: %s
 
 ⚠️  Keep these credentials secure!
 They will not be shown again.
-`, displayAddr, port, username, password, displayAddr, port, token, token, time.Now().Format("2006-01-02 15:04:05"))
+`, displayAddr, port, webPath, username, password, displayAddr, port, apiPath, token, token, time.Now().Format("2006-01-02 15:04:05"))
 
 	// Write file with 0600 permissions (owner read/write only)
 	if err := os.WriteFile(credFile, []byte(content), 0600); err != nil {
@@ -283,13 +468,57 @@ func generateRandomString(length int) string {
 	return hex.EncodeToString(bytes)
 }
 
-// hashString creates a SHA-256 hash
+// hashString creates a SHA-256 hash. Used for high-entropy random tokens,
+// where a slow salted hash adds nothing; passwords go through hashPassword.
 func hashString(s string) string {
 	hash := sha256.Sum256([]byte(s))
 	return hex.EncodeToString(hash[:])
 }
 
-// VerifyAdminPassword verifies admin password
+// hashMatches reports whether s hashes (as hashString) to the hex-encoded
+// storedHash, comparing the decoded digests in constant time so the time
+// taken says nothing about how much of a guess was right
+func hashMatches(s, storedHash string) bool {
+	stored, err := hex.DecodeString(storedHash)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256([]byte(s))
+	return subtle.ConstantTimeCompare(sum[:], stored) == 1
+}
+
+// defaultBcryptCost is the admin password's bcrypt cost when
+// security.bcrypt_cost is unset or invalid
+const defaultBcryptCost = 12
+
+// bcryptCost reads security.bcrypt_cost
+func bcryptCost(db *sql.DB) int {
+	cost := NewSettings(db).GetInt("security.bcrypt_cost", defaultBcryptCost)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		log.Printf("Invalid security.bcrypt_cost %d (must be %d-%d), using %d", cost, bcrypt.MinCost, bcrypt.MaxCost, defaultBcryptCost)
+		return defaultBcryptCost
+	}
+	return cost
+}
+
+// hashPassword hashes an admin password with bcrypt at security.bcrypt_cost
+func hashPassword(db *sql.DB, password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost(db))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash admin password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// isBcryptHash reports whether a stored password hash is bcrypt rather than
+// the unsalted SHA-256 used before
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+// VerifyAdminPassword verifies admin password. A password still stored as
+// SHA-256, or as bcrypt at a cost other than security.bcrypt_cost, is
+// re-hashed on the first successful login.
 func VerifyAdminPassword(db *sql.DB, username, password string) bool {
 	var storedHash string
 	err := db.QueryRow(`
@@ -300,20 +529,108 @@ func VerifyAdminPassword(db *sql.DB, username, password string) bool {
 		return false
 	}
 
-	passwordHash := hashString(password)
-	return passwordHash == storedHash
+	if !isBcryptHash(storedHash) {
+		if !hashMatches(password, storedHash) {
+			return false
+		}
+		rehashAdminPassword(db, username, password)
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password)) != nil {
+		return false
+	}
+	if cost, err := bcrypt.Cost([]byte(storedHash)); err == nil && cost != bcryptCost(db) {
+		rehashAdminPassword(db, username, password)
+	}
+	return true
+}
+
+// rehashAdminPassword stores password as a bcrypt hash at the current cost.
+// Failures are logged and leave the old hash in place, so the login that
+// triggered it still succeeds.
+func rehashAdminPassword(db *sql.DB, username, password string) {
+	hash, err := hashPassword(db, password)
+	if err == nil {
+		_, err = db.Exec(`
+			UPDATE admin_credentials SET password_hash = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE username = ?
+		`, hash, username)
+	}
+	if err != nil {
+		log.Printf("Failed to upgrade admin password hash: %v", err)
+		return
+	}
+	log.Printf("Re-hashed admin password with bcrypt (cost %d)", bcryptCost(db))
 }
 
 // VerifyAdminToken verifies admin API token
 func VerifyAdminToken(db *sql.DB, token string) bool {
-	var storedHash string
+	_, ok := AdminTokenUser(db, token)
+	return ok
+}
+
+// AdminTokenUser returns the admin username owning an API token.
+// There is exactly one admin: admin_credentials only admits the row with
+// id = 1 (CHECK constraint), so the token is checked against that row alone
+// and no username is needed to find it.
+func AdminTokenUser(db *sql.DB, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	var username, storedHash string
 	err := db.QueryRow(`
-		SELECT token_hash FROM admin_credentials LIMIT 1
-	`).Scan(&storedHash)
+		SELECT username, token_hash FROM admin_credentials WHERE id = 1
+	`).Scan(&username, &storedHash)
 	if err != nil {
-		return false
+		return "", false
 	}
 
-	tokenHash := hashString(token)
-	return tokenHash == storedHash
+	if !hashMatches(token, storedHash) {
+		return "", false
+	}
+	return username, true
+}
+
+// CreateAdminSession stores a new admin web session and returns its token
+func CreateAdminSession(db *sql.DB, username, ipAddress, userAgent string, lifetime time.Duration) (string, error) {
+	token := generateRandomString(64)
+
+	// Drop expired sessions while we're here
+	db.Exec("DELETE FROM admin_sessions WHERE expires_at <= ?", time.Now().UTC())
+
+	_, err := db.Exec(`
+		INSERT INTO admin_sessions (token_hash, username, ip_address, user_agent, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hashString(token), username, ipAddress, userAgent, time.Now().UTC().Add(lifetime))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// VerifyAdminSession returns the username for a valid, unexpired session token
+func VerifyAdminSession(db *sql.DB, token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	var username string
+	err := db.QueryRow(`
+		SELECT username FROM admin_sessions
+		WHERE token_hash = ? AND expires_at > ?
+	`, hashString(token), time.Now().UTC()).Scan(&username)
+	if err != nil {
+		return "", false
+	}
+
+	return username, true
+}
+
+// DeleteAdminSession removes an admin web session
+func DeleteAdminSession(db *sql.DB, token string) error {
+	_, err := db.Exec("DELETE FROM admin_sessions WHERE token_hash = ?", hashString(token))
+	return err
 }
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestAdminDB opens a fresh database with the admin schema and one admin,
+// "admin", whose token is token and whose password is stored as passwordHash
+func newTestAdminDB(t *testing.T, token, passwordHash string) *sql.DB {
+	t.Helper()
+	t.Setenv("ADMIN_USER", "admin")
+	t.Setenv("ADMIN_TOKEN", token)
+	t.Setenv("ADMIN_PASSWORD", "unused-password")
+	t.Setenv("CONFIG_DIR", "")
+
+	conn := newTestDB(t).conn
+	if err := InitializeAdminSchema(conn); err != nil {
+		t.Fatalf("InitializeAdminSchema: %v", err)
+	}
+	if _, err := conn.Exec("UPDATE admin_credentials SET password_hash = ?", passwordHash); err != nil {
+		t.Fatal(err)
+	}
+	// Keep bcrypt fast; tests that check re-hashing change it
+	setTestBcryptCost(t, conn, bcrypt.MinCost)
+	return conn
+}
+
+// setTestBcryptCost sets security.bcrypt_cost
+func setTestBcryptCost(t *testing.T, conn *sql.DB, cost int) {
+	t.Helper()
+	if _, err := conn.Exec("UPDATE settings SET value = ? WHERE key = 'security.bcrypt_cost'", cost); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storedPasswordHash reads the admin's password hash
+func storedPasswordHash(t *testing.T, conn *sql.DB) string {
+	t.Helper()
+	var hash string
+	if err := conn.QueryRow("SELECT password_hash FROM admin_credentials WHERE username = 'admin'").Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestAdminTokenUser(t *testing.T) {
+	token := strings.Repeat("a1", 32)
+	conn := newTestAdminDB(t, token, hashString("unused-password"))
+
+	if username, ok := AdminTokenUser(conn, token); !ok || username != "admin" {
+		t.Errorf("AdminTokenUser(valid) = %q, %v; want admin, true", username, ok)
+	}
+
+	// Same length as the real token and differing only in the last character
+	wrong := token[:len(token)-1] + "2"
+	if username, ok := AdminTokenUser(conn, wrong); ok {
+		t.Errorf("AdminTokenUser(wrong token of the same length) = %q, true; want rejected", username)
+	}
+	for _, bad := range []string{"", token[:len(token)-1], token + "a", strings.ToUpper(token)} {
+		if _, ok := AdminTokenUser(conn, bad); ok {
+			t.Errorf("AdminTokenUser(%q) accepted", bad)
+		}
+	}
+
+	// A stored hash that isn't hex never matches
+	if _, err := conn.Exec("UPDATE admin_credentials SET token_hash = 'not-hex' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := AdminTokenUser(conn, token); ok {
+		t.Errorf("AdminTokenUser accepted a token against a corrupt stored hash")
+	}
+}
+
+func TestVerifyAdminPasswordRehashesLegacyHash(t *testing.T) {
+	conn := newTestAdminDB(t, strings.Repeat("b2", 32), hashString("s3cret"))
+
+	if VerifyAdminPassword(conn, "admin", "wrong") {
+		t.Fatal("wrong password accepted")
+	}
+	if hash := storedPasswordHash(t, conn); isBcryptHash(hash) {
+		t.Fatal("failed login re-hashed the password")
+	}
+
+	if !VerifyAdminPassword(conn, "admin", "s3cret") {
+		t.Fatal("correct password rejected")
+	}
+	hash := storedPasswordHash(t, conn)
+	if !isBcryptHash(hash) {
+		t.Fatalf("password still stored as %q after login, want bcrypt", hash)
+	}
+	if !VerifyAdminPassword(conn, "admin", "s3cret") {
+		t.Fatal("correct password rejected after re-hash")
+	}
+}
+
+func TestVerifyAdminPasswordRehashesOnCostChange(t *testing.T) {
+	old, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTestAdminDB(t, strings.Repeat("c3", 32), string(old))
+	setTestBcryptCost(t, conn, bcrypt.MinCost+1)
+
+	if !VerifyAdminPassword(conn, "admin", "s3cret") {
+		t.Fatal("correct password rejected")
+	}
+	cost, err := bcrypt.Cost([]byte(storedPasswordHash(t, conn)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != bcrypt.MinCost+1 {
+		t.Errorf("bcrypt cost after login = %d, want %d", cost, bcrypt.MinCost+1)
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// areaCodeRecord is one entry of an area code mapping file
+type areaCodeRecord struct {
+	ZipCode   flexString   `json:"zip_code"`
+	AreaCodes []flexString `json:"area_codes"`
+}
+
+// LoadAreaCodes replaces the telephone area code mapping. data is a JSON array
+// of {"zip_code": "10001", "area_codes": ["212", "646", "332"]} records;
+// numeric zipcodes are zero-padded to 5 digits. Returns the number of
+// zipcodes loaded.
+func (db *DB) LoadAreaCodes(data []byte) (int, error) {
+	var records []areaCodeRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return 0, fmt.Errorf("failed to parse area code mapping: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM zip_area_codes"); err != nil {
+		return 0, fmt.Errorf("failed to clear area code mapping: %w", err)
+	}
+
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO zip_area_codes (area_code, zip_code) VALUES (?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for i, rec := range records {
+		zip := strings.TrimSpace(string(rec.ZipCode))
+		if len(zip) < 5 && zip != "" && isDigits(zip) {
+			zip = strings.Repeat("0", 5-len(zip)) + zip
+		}
+		code, err := ParseZipCode(zip)
+		if err != nil {
+			return 0, fmt.Errorf("invalid zipcode %q at index %d", rec.ZipCode, i)
+		}
+		for _, ac := range rec.AreaCodes {
+			areaCode := strings.TrimSpace(string(ac))
+			if !ValidAreaCode(areaCode) {
+				return 0, fmt.Errorf("invalid area code %q at index %d", ac, i)
+			}
+			if _, err := stmt.Exec(areaCode, code); err != nil {
+				return 0, fmt.Errorf("failed to insert area code mapping at index %d: %w", i, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// ValidAreaCode reports whether s is a NANP geographic area code: NXX with N
+// in 2-9, excluding the reserved X9X expansion codes and the N11 service
+// codes (211, 311, ... 911)
+func ValidAreaCode(s string) bool {
+	if len(s) != 3 || !isDigits(s) || s[0] < '2' {
+		return false
+	}
+	return s[1] != '9' && s[1:] != "11"
+}
+
+// SearchByAreaCode finds the zipcodes served by a telephone area code, ordered
+// by state, city and zipcode. Empty unless an area code mapping has been loaded.
+func (db *DB) SearchByAreaCode(ctx context.Context, areaCode string, opts QueryOptions) ([]Zipcode, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("zip_code IN (SELECT zip_code FROM zip_area_codes WHERE area_code = ?)")+`
+		ORDER BY state, city, zip_code
+	`, areaCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanZipcodes(rows)
+}
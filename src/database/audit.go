@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AuditEntry is a single audit_log record
+type AuditEntry struct {
+	Username  string
+	Action    string
+	Resource  string
+	OldValue  string
+	NewValue  string
+	IPAddress string
+	UserAgent string
+	Success   bool
+	Error     string
+}
+
+// WriteAuditLog records an admin action in audit_log
+func WriteAuditLog(db *sql.DB, entry AuditEntry) error {
+	success := 0
+	if entry.Success {
+		success = 1
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO audit_log (username, action, resource, old_value, new_value, ip_address, user_agent, success, error_message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Username, entry.Action, entry.Resource, nullString(entry.OldValue), nullString(entry.NewValue),
+		entry.IPAddress, entry.UserAgent, success, nullString(entry.Error))
+	return err
+}
+
+// PruneAuditLog deletes audit_log entries older than the given age
+func PruneAuditLog(db *sql.DB, olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan).UTC().Format("2006-01-02 15:04:05")
+	res, err := db.Exec("DELETE FROM audit_log WHERE timestamp < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,12 @@
+package database
+
+import (
+	"context"
+)
+
+// Backup writes a consistent snapshot of the database to path
+// VACUUM INTO refuses to overwrite, so path must not already exist.
+func (db *DB) Backup(ctx context.Context, path string) error {
+	_, err := db.conn.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// fillCountyFIPS sets each zipcode's fips from the county_fips mapping,
+// matching state and county name case-insensitively. Counties missing from
+// the mapping are left NULL, so the field is omitted from responses.
+const fillCountyFIPS = `
+	UPDATE zipcodes SET fips = (
+		SELECT c.fips FROM county_fips c
+		WHERE c.state = UPPER(zipcodes.state) AND c.county = LOWER(TRIM(zipcodes.county))
+	)
+`
+
+// countyFIPSRecord is one entry of a county FIPS mapping file
+type countyFIPSRecord struct {
+	State  string     `json:"state"`
+	County string     `json:"county"`
+	FIPS   flexString `json:"fips"`
+}
+
+// LoadCountyFIPS replaces the county FIPS mapping and re-derives the fips
+// column of every zipcode. data is a JSON array of
+// {"state": "CA", "county": "Los Angeles", "fips": "06037"} records; numeric
+// codes are zero-padded to 5 digits. Returns the number of counties loaded.
+func (db *DB) LoadCountyFIPS(data []byte) (int, error) {
+	var records []countyFIPSRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return 0, fmt.Errorf("failed to parse FIPS mapping: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM county_fips"); err != nil {
+		return 0, fmt.Errorf("failed to clear FIPS mapping: %w", err)
+	}
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO county_fips (state, county, fips) VALUES (?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for i, rec := range records {
+		fips := strings.TrimSpace(string(rec.FIPS))
+		if len(fips) < 5 && fips != "" && isDigits(fips) {
+			fips = strings.Repeat("0", 5-len(fips)) + fips
+		}
+		if !ValidFIPS(fips) {
+			return 0, fmt.Errorf("invalid FIPS code %q at index %d", rec.FIPS, i)
+		}
+		state := strings.ToUpper(strings.TrimSpace(rec.State))
+		county := strings.ToLower(strings.TrimSpace(rec.County))
+		if _, err := stmt.Exec(state, county, fips); err != nil {
+			return 0, fmt.Errorf("failed to insert FIPS mapping at index %d: %w", i, err)
+		}
+	}
+
+	if _, err := tx.Exec(fillCountyFIPS); err != nil {
+		return 0, fmt.Errorf("failed to set county FIPS codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// ValidFIPS reports whether s is a 5-digit county FIPS code
+func ValidFIPS(s string) bool {
+	return len(s) == 5 && isDigits(s)
+}
@@ -0,0 +1,345 @@
+package database
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	earthRadiusMeters = 6371000.0
+	metersPerDegree   = 111320.0 // Approximate meters per degree of latitude
+
+	// NearestMaxDistance is the furthest a nearest-zipcode match may be (meters)
+	NearestMaxDistance = 100000.0
+
+	// Neighbor search tuning, see GetNeighbors
+	neighborDensityRank = 6       // Distinct locations used to gauge local density
+	neighborRadiusScale = 1.5     // Radius as a multiple of the density distance
+	neighborMinRadius   = 2000.0  // Meters
+	neighborMaxRadius   = 50000.0 // Meters
+)
+
+// haversineMeters returns the great-circle distance between two points in meters
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// boundingBox returns the lat/lon ranges that contain every point within
+// radius meters of the center
+func boundingBox(lat, lon, radius float64) (minLat, maxLat, minLon, maxLon float64) {
+	latDelta := radius / metersPerDegree
+	lonDelta := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+		lonDelta = math.Min(180, radius/(metersPerDegree*cos))
+	}
+	return lat - latDelta, lat + latDelta, lon - lonDelta, lon + lonDelta
+}
+
+// Coordinates parses the record's latitude and longitude
+// Returns false if either is missing or invalid
+func (zc *Zipcode) Coordinates() (float64, float64, bool) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(zc.Latitude), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(zc.Longitude), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// RoundCoordinates rounds latitude and longitude to places decimal places
+// Coordinates already at or below that precision are left as they are
+func (zc *Zipcode) RoundCoordinates(places int) {
+	lat, lon, ok := zc.Coordinates()
+	if !ok {
+		return
+	}
+	zc.Latitude = roundCoordinate(lat, places)
+	zc.Longitude = roundCoordinate(lon, places)
+}
+
+// roundCoordinate formats v rounded to places decimals without trailing zeros
+func roundCoordinate(v float64, places int) string {
+	scale := math.Pow(10, float64(places))
+	return strconv.FormatFloat(math.Round(v*scale)/scale, 'f', -1, 64)
+}
+
+// ValidCoordinates reports whether lat/lon are within valid ranges
+func ValidCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// withinRadius returns zipcodes within radius meters of a point, nearest first,
+// with Distance set in meters
+func (db *DB) withinRadius(ctx context.Context, lat, lon, radius float64) ([]Zipcode, error) {
+	minLat, maxLat, minLon, maxLon := boundingBox(lat, lon, radius)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+hasCoordinatesClause+`
+		AND CAST(latitude AS REAL) BETWEEN ? AND ?
+		AND CAST(longitude AS REAL) BETWEEN ? AND ?
+		ORDER BY zip_code
+	`, minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates, err := db.scanZipcodes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	SortByDistance(candidates, lat, lon)
+	results := make([]Zipcode, 0, len(candidates))
+	for _, zc := range candidates {
+		if zc.Distance != nil && *zc.Distance <= radius {
+			results = append(results, zc)
+		}
+	}
+	return results, nil
+}
+
+// GetNeighbors approximates the zipcodes adjacent to code. Without boundary
+// polygons, adjacency is estimated with a radius scaled to local density: the
+// distance to the 6th-nearest distinct location (roughly one ring of
+// neighbors) times 1.5, clamped to 2-50 km. Dense urban codes therefore get a
+// small radius and rural ones a large one. Results are nearest first with
+// Distance in meters; the radius used is returned in meters.
+// Returns nil if the zipcode doesn't exist and an empty list if it has no coordinates.
+func (db *DB) GetNeighbors(ctx context.Context, code string) ([]Zipcode, float64, error) {
+	origin, err := db.SearchByZipCode(ctx, code)
+	if err != nil || origin == nil {
+		return nil, 0, err
+	}
+	lat, lon, ok := origin.Coordinates()
+	if !ok {
+		return []Zipcode{}, 0, nil
+	}
+
+	candidates, err := db.withinRadius(ctx, lat, lon, neighborMaxRadius)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Gauge density from distinct locations; PO boxes often share a point
+	radius := neighborMaxRadius
+	distinct := 0
+	last := -1.0
+	for _, zc := range candidates {
+		if zc.ZipCode == code || *zc.Distance == 0 || *zc.Distance == last {
+			continue
+		}
+		last = *zc.Distance
+		if distinct++; distinct == neighborDensityRank {
+			radius = math.Max(neighborMinRadius, math.Min(neighborMaxRadius, last*neighborRadiusScale))
+			break
+		}
+	}
+
+	neighbors := make([]Zipcode, 0)
+	for _, zc := range candidates {
+		if zc.ZipCode != code && *zc.Distance <= radius {
+			neighbors = append(neighbors, zc)
+		}
+	}
+	return neighbors, radius, nil
+}
+
+// NearbyCity is a distinct city in a proximity result: its nearest zipcode,
+// how many of its zipcodes matched and the distance to the nearest one
+type NearbyCity struct {
+	City           string  `json:"city"`
+	State          string  `json:"state"`
+	NearestZipCode string  `json:"nearest_zip_code"`
+	Count          int     `json:"count"`
+	MinDistance    float64 `json:"min_distance"`
+}
+
+// GroupByCity collapses proximity results (nearest first, Distance set) to
+// distinct city/state pairs, so the nearest city comes first. Cities are
+// compared after NormalizeCity; the first spelling seen is kept.
+func GroupByCity(results []Zipcode) []NearbyCity {
+	cities := make([]NearbyCity, 0)
+	index := make(map[string]int)
+	for _, zc := range results {
+		key := strings.ToUpper(zc.State) + "|" + NormalizeCity(zc.City)
+		if i, ok := index[key]; ok {
+			cities[i].Count++
+			continue
+		}
+		index[key] = len(cities)
+		city := NearbyCity{City: zc.City, State: zc.State, NearestZipCode: zc.ZipCode, Count: 1}
+		if zc.Distance != nil {
+			city.MinDistance = *zc.Distance
+		}
+		cities = append(cities, city)
+	}
+	return cities
+}
+
+// NearestZipcode returns the zipcode closest to a point, with Distance set in
+// meters, or nil if none lies within NearestMaxDistance
+func (db *DB) NearestZipcode(ctx context.Context, lat, lon float64) (*Zipcode, error) {
+	minLat, maxLat, minLon, maxLon := boundingBox(lat, lon, NearestMaxDistance)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+hasCoordinatesClause+`
+		AND CAST(latitude AS REAL) BETWEEN ? AND ?
+		AND CAST(longitude AS REAL) BETWEEN ? AND ?
+		ORDER BY zip_code
+	`, minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates, err := db.scanZipcodes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Candidates come in zip_code order and only a strictly closer one
+	// replaces the current pick, so ties go to the lowest zip_code
+	var nearest *Zipcode
+	best := NearestMaxDistance
+	for i := range candidates {
+		zLat, zLon, ok := candidates[i].Coordinates()
+		if !ok {
+			continue
+		}
+		if d := haversineMeters(lat, lon, zLat, zLon); d < best {
+			best = d
+			nearest = &candidates[i]
+		}
+	}
+
+	if nearest != nil {
+		nearest.Distance = &best
+	}
+	return nearest, nil
+}
+
+// Centroid returns the geographic mean of the zipcodes that have
+// coordinates, and false if none do. Points are averaged as unit vectors on
+// the sphere rather than as raw degrees, so sets spanning the antimeridian
+// (the western Aleutians) or near the poles get a sensible center. For
+// compact US areas the result is within meters of the arithmetic mean.
+func Centroid(zipcodes []Zipcode) (float64, float64, bool) {
+	var x, y, z float64
+	n := 0
+	for i := range zipcodes {
+		lat, lon, ok := zipcodes[i].Coordinates()
+		if !ok {
+			continue
+		}
+		latRad, lonRad := lat*math.Pi/180, lon*math.Pi/180
+		x += math.Cos(latRad) * math.Cos(lonRad)
+		y += math.Cos(latRad) * math.Sin(lonRad)
+		z += math.Sin(latRad)
+		n++
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	// Antipodal points cancel out and have no meaningful center
+	hyp := math.Hypot(x, y)
+	if hyp == 0 && z == 0 {
+		return 0, 0, false
+	}
+	return math.Atan2(z, hyp) * 180 / math.Pi, math.Atan2(y, x) * 180 / math.Pi, true
+}
+
+// SortByDistance sets each record's Distance (meters) from a point and sorts
+// nearest first; records without coordinates keep a nil Distance and go last.
+// Equal distances are ordered by zip code so the result is deterministic.
+func SortByDistance(zipcodes []Zipcode, lat, lon float64) {
+	for i := range zipcodes {
+		zipcodes[i].Distance = nil
+		if zLat, zLon, ok := zipcodes[i].Coordinates(); ok {
+			d := haversineMeters(lat, lon, zLat, zLon)
+			zipcodes[i].Distance = &d
+		}
+	}
+
+	sort.SliceStable(zipcodes, func(i, j int) bool {
+		di, dj := zipcodes[i].Distance, zipcodes[j].Distance
+		switch {
+		case di == nil && dj == nil:
+		case di == nil || dj == nil:
+			return di != nil
+		case *di != *dj:
+			return *di < *dj
+		}
+		return zipcodes[i].ZipCode < zipcodes[j].ZipCode
+	})
+}
+
+// Bounds is the bounding box of a region's zipcodes and the mean of their
+// coordinates. Only records with coordinates are counted.
+type Bounds struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+	Centroid     LatLon  `json:"centroid"`
+	ZipcodeCount int     `json:"zipcode_count"`
+}
+
+// LatLon is a point in decimal degrees
+type LatLon struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// StateBounds returns the bounds of a state's zipcodes, or nil when none of
+// them has coordinates
+func (db *DB) StateBounds(ctx context.Context, state string) (*Bounds, error) {
+	return db.bounds(ctx, "UPPER(state) = UPPER(?)", strings.TrimSpace(state))
+}
+
+// CityBounds returns the bounds of a city's zipcodes, within state when it is
+// not empty, or nil when none of them has coordinates. Names are matched
+// after NormalizeCity, like SearchByCity.
+func (db *DB) CityBounds(ctx context.Context, city, state string) (*Bounds, error) {
+	if state = strings.TrimSpace(state); state != "" {
+		return db.bounds(ctx, "city_normalized = ? AND UPPER(state) = UPPER(?)", NormalizeCity(city), state)
+	}
+	return db.bounds(ctx, "city_normalized = ?", NormalizeCity(city))
+}
+
+// bounds aggregates the coordinates of the zipcodes matching condition in
+// one query
+func (db *DB) bounds(ctx context.Context, condition string, args ...interface{}) (*Bounds, error) {
+	var b Bounds
+	var minLat, minLon, maxLat, maxLon, avgLat, avgLon *float64
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			MIN(CAST(latitude AS REAL)), MIN(CAST(longitude AS REAL)),
+			MAX(CAST(latitude AS REAL)), MAX(CAST(longitude AS REAL)),
+			AVG(CAST(latitude AS REAL)), AVG(CAST(longitude AS REAL))
+		FROM zipcodes WHERE `+condition+` AND `+hasCoordinatesClause,
+		args...).Scan(&b.ZipcodeCount, &minLat, &minLon, &maxLat, &maxLon, &avgLat, &avgLon)
+	if err != nil {
+		return nil, err
+	}
+	if b.ZipcodeCount == 0 {
+		return nil, nil
+	}
+
+	b.MinLatitude, b.MinLongitude = *minLat, *minLon
+	b.MaxLatitude, b.MaxLongitude = *maxLat, *maxLon
+	b.Centroid = LatLon{Latitude: *avgLat, Longitude: *avgLon}
+	return &b, nil
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNearestZipcodeTieGoesToLowestZip(t *testing.T) {
+	db := newTestDB(t)
+	// Co-located codes, listed highest first so load order can't decide
+	err := db.LoadFromJSON([]byte(`[
+		{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2205, "latitude": "42.3586", "longitude": "-71.0567"},
+		{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2201, "latitude": "42.3586", "longitude": "-71.0567"},
+		{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2203, "latitude": "42.3586", "longitude": "-71.0567"}
+	]`))
+	if err != nil {
+		t.Fatalf("LoadFromJSON: %v", err)
+	}
+
+	nearest, err := db.NearestZipcode(context.Background(), 42.36, -71.05)
+	if err != nil {
+		t.Fatalf("NearestZipcode: %v", err)
+	}
+	if nearest == nil || nearest.ZipCode != "02201" {
+		t.Fatalf("NearestZipcode = %+v, want 02201", nearest)
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import "strings"
+
+// GeohashPrecision is the geohash length stored for each zipcode (~1.2km x 0.6km cells)
+const GeohashPrecision = 6
+
+// geohashAlphabet is the base32 alphabet used by geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// EncodeGeohash encodes a coordinate as a geohash of the given length
+func EncodeGeohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	bit, ch := 0, 0
+	even := true
+	for hash.Len() < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+
+		if bit < 4 {
+			bit++
+		} else {
+			hash.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+
+	return hash.String()
+}
+
+// ValidGeohash reports whether s only contains geohash characters
+func ValidGeohash(s string) bool {
+	if s == "" || len(s) > 12 {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if !strings.ContainsRune(geohashAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// geohashFor returns the stored geohash for a record, or "" without coordinates
+func geohashFor(zc *Zipcode) string {
+	lat, lon, ok := zc.Coordinates()
+	if !ok || !ValidCoordinates(lat, lon) {
+		return ""
+	}
+	return EncodeGeohash(lat, lon, GeohashPrecision)
+}
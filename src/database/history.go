@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// Lookup kinds recorded in lookup_history
+const (
+	LookupZipcode = "zipcode"
+	LookupGeoIP   = "geoip"
+)
+
+// lookupQueueSize bounds the records waiting to be written. When the writer
+// falls behind, new records are dropped rather than slowing lookups down.
+const lookupQueueSize = 1024
+
+// lookupRecord is one row of lookup_history
+type lookupRecord struct {
+	kind        string
+	query       string
+	found       bool
+	countryCode string
+}
+
+// LookupHistory records public zipcode and GeoIP lookups in lookup_history
+// while features.track_lookups is on, keeping
+// features.track_lookups_sample_percent of them. Records are written by a
+// background goroutine so a lookup never waits on the insert.
+type LookupHistory struct {
+	db       *sql.DB
+	settings *Settings
+	queue    chan lookupRecord
+}
+
+// NewLookupHistory returns a LookupHistory writing to db and starts its writer
+func NewLookupHistory(db *sql.DB, settings *Settings) *LookupHistory {
+	h := &LookupHistory{
+		db:       db,
+		settings: settings,
+		queue:    make(chan lookupRecord, lookupQueueSize),
+	}
+	go h.run()
+	return h
+}
+
+// Record queues a lookup of query (a zipcode or an IP). countryCode is the
+// GeoIP result's country, empty for zipcodes. Safe to call on a nil
+// LookupHistory, and a no-op while tracking is off or the sample skips it.
+func (h *LookupHistory) Record(kind, query string, found bool, countryCode string) {
+	if h == nil || !h.settings.GetBool("features.track_lookups", false) {
+		return
+	}
+	if percent := h.settings.GetInt("features.track_lookups_sample_percent", 100); percent < 100 && rand.IntN(100) >= percent {
+		return
+	}
+
+	select {
+	case h.queue <- lookupRecord{kind: kind, query: query, found: found, countryCode: countryCode}:
+	default:
+	}
+}
+
+// run writes queued records until the process exits
+func (h *LookupHistory) run() {
+	for rec := range h.queue {
+		found := 0
+		if rec.found {
+			found = 1
+		}
+		_, err := h.db.Exec(`
+			INSERT INTO lookup_history (kind, query, found, country_code)
+			VALUES (?, ?, ?, ?)
+		`, rec.kind, rec.query, found, nullString(rec.countryCode))
+		if err != nil {
+			log.Printf("Failed to record lookup history: %v", err)
+		}
+	}
+}
+
+// LookupCount is how often one value was looked up
+type LookupCount struct {
+	Query   string `json:"query"`
+	Lookups int    `json:"lookups"`
+	Found   int    `json:"found"`
+}
+
+// CountryCount is how many GeoIP lookups resolved to a country
+type CountryCount struct {
+	CountryCode string `json:"country_code"`
+	Lookups     int    `json:"lookups"`
+}
+
+// TopLookups returns the limit most looked-up values of kind since the given
+// time, most frequent first
+func TopLookups(db *sql.DB, kind string, since time.Time, limit int) ([]LookupCount, error) {
+	rows, err := db.Query(`
+		SELECT query, COUNT(*) AS lookups, SUM(found)
+		FROM lookup_history
+		WHERE kind = ? AND timestamp >= ?
+		GROUP BY query
+		ORDER BY lookups DESC, query
+		LIMIT ?
+	`, kind, since.UTC().Format("2006-01-02 15:04:05"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []LookupCount{}
+	for rows.Next() {
+		var c LookupCount
+		if err := rows.Scan(&c.Query, &c.Lookups, &c.Found); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// GeoIPCountries returns the limit countries GeoIP lookups resolved to most
+// often since the given time. Lookups without a country are not counted.
+func GeoIPCountries(db *sql.DB, since time.Time, limit int) ([]CountryCount, error) {
+	rows, err := db.Query(`
+		SELECT country_code, COUNT(*) AS lookups
+		FROM lookup_history
+		WHERE kind = ? AND country_code IS NOT NULL AND timestamp >= ?
+		GROUP BY country_code
+		ORDER BY lookups DESC, country_code
+		LIMIT ?
+	`, LookupGeoIP, since.UTC().Format("2006-01-02 15:04:05"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []CountryCount{}
+	for rows.Next() {
+		var c CountryCount
+		if err := rows.Scan(&c.CountryCode, &c.Lookups); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// PruneLookupHistory deletes lookup_history entries older than the given age
+func PruneLookupHistory(db *sql.DB, olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan).UTC().Format("2006-01-02 15:04:05")
+	res, err := db.Exec("DELETE FROM lookup_history WHERE timestamp < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
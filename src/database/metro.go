@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// Metro is a metropolitan area, defined by its core counties since the
+// dataset has no metro field. Membership follows the census metropolitan
+// statistical areas, trimmed to the counties most people mean by the name.
+type Metro struct {
+	Slug     string        `json:"slug"`
+	Name     string        `json:"name"`
+	Counties []MetroCounty `json:"counties"`
+}
+
+// MetroCounty is one county of a metro, named as in the dataset
+type MetroCounty struct {
+	State  string `json:"state"`
+	County string `json:"county"`
+}
+
+// metros is the built-in metro mapping; add an entry to support a new metro
+var metros = []Metro{
+	{"atlanta", "Atlanta", []MetroCounty{
+		{"GA", "Fulton"}, {"GA", "Dekalb"}, {"GA", "Cobb"}, {"GA", "Gwinnett"}, {"GA", "Clayton"},
+	}},
+	{"bay-area", "San Francisco Bay Area", []MetroCounty{
+		{"CA", "Alameda"}, {"CA", "Contra Costa"}, {"CA", "Marin"}, {"CA", "Napa"}, {"CA", "San Francisco"},
+		{"CA", "San Mateo"}, {"CA", "Santa Clara"}, {"CA", "Solano"}, {"CA", "Sonoma"},
+	}},
+	{"boston", "Greater Boston", []MetroCounty{
+		{"MA", "Suffolk"}, {"MA", "Middlesex"}, {"MA", "Norfolk"}, {"MA", "Essex"},
+	}},
+	{"chicago", "Chicagoland", []MetroCounty{
+		{"IL", "Cook"}, {"IL", "Du Page"}, {"IL", "Lake"}, {"IL", "Will"}, {"IL", "Kane"}, {"IL", "McHenry"},
+	}},
+	{"dallas-fort-worth", "Dallas-Fort Worth", []MetroCounty{
+		{"TX", "Dallas"}, {"TX", "Tarrant"}, {"TX", "Collin"}, {"TX", "Denton"},
+	}},
+	{"houston", "Greater Houston", []MetroCounty{
+		{"TX", "Harris"}, {"TX", "Fort Bend"}, {"TX", "Montgomery"},
+	}},
+	{"los-angeles", "Greater Los Angeles", []MetroCounty{
+		{"CA", "Los Angeles"}, {"CA", "Orange"},
+	}},
+	{"miami", "South Florida", []MetroCounty{
+		{"FL", "Miami-Dade"}, {"FL", "Broward"}, {"FL", "Palm Beach"},
+	}},
+	{"new-york-city", "New York City", []MetroCounty{
+		{"NY", "New York"}, {"NY", "Kings"}, {"NY", "Queens"}, {"NY", "Bronx"}, {"NY", "Richmond"},
+	}},
+	{"seattle", "Seattle Metro", []MetroCounty{
+		{"WA", "King"}, {"WA", "Snohomish"}, {"WA", "Pierce"},
+	}},
+	{"washington-dc", "Washington, D.C. Metro", []MetroCounty{
+		{"DC", "District of Columbia"}, {"VA", "Arlington"}, {"VA", "Fairfax"}, {"VA", "Alexandria City"},
+		{"VA", "Loudoun"}, {"VA", "Prince William"}, {"MD", "Montgomery"}, {"MD", "Prince Georges"},
+	}},
+}
+
+// Metros returns the built-in metros, sorted by slug
+func Metros() []Metro {
+	return metros
+}
+
+// LookupMetro finds a metro by slug (case-insensitive)
+func LookupMetro(slug string) (*Metro, bool) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	for i := range metros {
+		if metros[i].Slug == slug {
+			return &metros[i], true
+		}
+	}
+	return nil, false
+}
+
+// SearchByMetro finds the zipcodes in a metro's counties, ordered by state
+// and zipcode
+func (db *DB) SearchByMetro(ctx context.Context, m *Metro, opts QueryOptions) ([]Zipcode, error) {
+	conds := make([]string, len(m.Counties))
+	args := make([]interface{}, 0, 2*len(m.Counties))
+	for i, c := range m.Counties {
+		conds[i] = "(UPPER(state) = ? AND LOWER(county) = ?)"
+		args = append(args, strings.ToUpper(c.State), strings.ToLower(c.County))
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("("+strings.Join(conds, " OR ")+")")+`
+		ORDER BY state, zip_code
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanZipcodes(rows)
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// zipcodeIndexes are the indexes on the zipcodes table. LoadFromJSON
+// recreates them after swapping in a new dataset.
+var zipcodeIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_zip_code ON zipcodes(zip_code)",
+	"CREATE INDEX IF NOT EXISTS idx_city ON zipcodes(city)",
+	"CREATE INDEX IF NOT EXISTS idx_state ON zipcodes(state)",
+	"CREATE INDEX IF NOT EXISTS idx_state_city ON zipcodes(state, city)",
+	"CREATE INDEX IF NOT EXISTS idx_geohash ON zipcodes(geohash)",
+	"CREATE INDEX IF NOT EXISTS idx_city_normalized ON zipcodes(city_normalized)",
+	"CREATE INDEX IF NOT EXISTS idx_state_city_normalized ON zipcodes(state, city_normalized)",
+	"CREATE INDEX IF NOT EXISTS idx_fips ON zipcodes(fips)",
+}
+
+// migrate brings databases created by older versions up to date by adding
+// derived columns and filling them in for existing records
+func (db *DB) migrate() error {
+	if err := db.ensureColumn("geohash", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("city_normalized", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("fips", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.ensureColumn("timezone", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.migrateZipCodeText(); err != nil {
+		return err
+	}
+
+	for _, index := range zipcodeIndexes {
+		if _, err := db.conn.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	if err := db.backfillColumn("geohash", hasCoordinatesClause, geohashFor); err != nil {
+		return err
+	}
+	if err := db.backfillColumn("city_normalized", "1 = 1", func(zc *Zipcode) string {
+		return NormalizeCity(zc.City)
+	}); err != nil {
+		return err
+	}
+	// Military mail (AA/AE/AP) has no fixed timezone
+	return db.backfillColumn("timezone", "state NOT IN ('AA', 'AE', 'AP')", TimezoneForZipcode)
+}
+
+// zipCodeTables lists each table keyed by zip_code with the columns copied
+// when migrateZipCodeText rebuilds it
+var zipCodeTables = []struct {
+	table, definition, columns string
+}{
+	{"zipcodes", zipcodesTableColumns, "id, state, city, county, zip_code, latitude, longitude, geohash, city_normalized, fips, timezone, created_at"},
+	{"zip_area_codes", zipAreaCodesTableColumns, "area_code, zip_code"},
+}
+
+// migrateZipCodeText rebuilds tables from older versions that store zip_code
+// as an INTEGER, converting it to the zero-padded text the current schema
+// stores. SQLite can't change a column's type, and an INTEGER column would
+// turn "01001" back into 1001, so the rows are copied into a table with the
+// current definition. The zipcodes indexes are recreated by migrate.
+func (db *DB) migrateZipCodeText() error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range zipCodeTables {
+		var columnType string
+		err := tx.QueryRow("SELECT type FROM pragma_table_info('" + t.table + "') WHERE name = 'zip_code'").Scan(&columnType)
+		if err == sql.ErrNoRows || (err == nil && !strings.EqualFold(columnType, "INTEGER")) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to inspect %s table: %w", t.table, err)
+		}
+
+		rebuilt := t.table + "_new"
+		selected := strings.Replace(t.columns, "zip_code", "printf('%05d', zip_code)", 1)
+		for _, stmt := range []string{
+			"DROP TABLE IF EXISTS " + rebuilt,
+			"CREATE TABLE " + rebuilt + " " + t.definition,
+			"INSERT INTO " + rebuilt + " (" + t.columns + ") SELECT " + selected + " FROM " + t.table,
+			"DROP TABLE " + t.table,
+			"ALTER TABLE " + rebuilt + " RENAME TO " + t.table,
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to convert %s.zip_code to text: %w", t.table, err)
+			}
+		}
+		fmt.Printf("Converted %s.zip_code to zero-padded text\n", t.table)
+	}
+
+	return tx.Commit()
+}
+
+// ensureColumn adds a column to the zipcodes table if it doesn't exist
+func (db *DB) ensureColumn(name, definition string) error {
+	var exists int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('zipcodes') WHERE name = ?", name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to inspect zipcodes table: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	if _, err := db.conn.Exec("ALTER TABLE zipcodes ADD COLUMN " + name + " " + definition); err != nil {
+		return fmt.Errorf("failed to add %s column: %w", name, err)
+	}
+	return nil
+}
+
+// backfillColumn computes column for records where it is NULL and condition holds
+// Records for which compute returns "" are left NULL
+func (db *DB) backfillColumn(column, condition string, compute func(*Zipcode) string) error {
+	rows, err := db.conn.Query(`
+		SELECT zip_code, state, city, latitude, longitude
+		FROM zipcodes WHERE ` + column + ` IS NULL AND ` + condition)
+	if err != nil {
+		return err
+	}
+	var pending []Zipcode
+	for rows.Next() {
+		var zc Zipcode
+		if err := rows.Scan(&zc.ZipCode, &zc.State, &zc.City, &zc.Latitude, &zc.Longitude); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, zc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE zipcodes SET " + column + " = ? WHERE zip_code = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := range pending {
+		if value := compute(&pending[i]); value != "" {
+			if _, err := stmt.Exec(value, pending[i].ZipCode); err != nil {
+				return fmt.Errorf("failed to set %s for %s: %w", column, pending[i].ZipCode, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Computed %s for %d zipcodes\n", column, len(pending))
+	return nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+)
+
+// cityAbbreviations maps common city-name abbreviations to their full form
+var cityAbbreviations = map[string]string{
+	"st":  "saint",
+	"ste": "sainte",
+	"mt":  "mount",
+	"ft":  "fort",
+	"pt":  "point",
+}
+
+// NormalizeCity canonicalizes a city name for matching: case, punctuation and
+// common abbreviations are folded so "St. Louis", "St Louis" and "Saint Louis"
+// all normalize to "saint louis"
+func NormalizeCity(city string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(city) {
+		switch {
+		case r == '\'' || r == '’':
+			// Drop apostrophes so "O'Fallon" matches "OFallon"
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	words := strings.Fields(b.String())
+	for i, word := range words {
+		if full, ok := cityAbbreviations[word]; ok {
+			words[i] = full
+		}
+	}
+	return strings.Join(words, " ")
+}
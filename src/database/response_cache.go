@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CachedResponse is an API response stored in the shared response cache.
+// Header holds the response headers to replay, keyed like http.Header.
+type CachedResponse struct {
+	Status    int
+	Header    map[string][]string
+	Body      []byte
+	ExpiresAt time.Time
+}
+
+// GetCachedResponse returns the unexpired cached response for key, or nil
+func (db *DB) GetCachedResponse(ctx context.Context, key string) (*CachedResponse, error) {
+	var resp CachedResponse
+	var headers string
+	var expires int64
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT status, headers, body, expires_at
+		FROM response_cache WHERE key = ? AND expires_at > ?
+	`, key, time.Now().Unix()).Scan(&resp.Status, &headers, &resp.Body, &expires)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(headers), &resp.Header); err != nil {
+		return nil, fmt.Errorf("invalid cached headers: %w", err)
+	}
+	resp.ExpiresAt = time.Unix(expires, 0)
+	return &resp, nil
+}
+
+// PutCachedResponse stores resp under key, replacing any previous entry
+func (db *DB) PutCachedResponse(ctx context.Context, key string, resp *CachedResponse) error {
+	headers, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.ExecContext(ctx, `
+		INSERT OR REPLACE INTO response_cache (key, status, headers, body, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, key, resp.Status, string(headers), resp.Body, resp.ExpiresAt.Unix())
+	return err
+}
+
+// PruneResponseCache deletes expired entries and returns how many were removed
+func (db *DB) PruneResponseCache(ctx context.Context) (int64, error) {
+	result, err := db.conn.ExecContext(ctx, "DELETE FROM response_cache WHERE expires_at <= ?", time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// dropOldResponseCache drops a response_cache table from before full headers
+// were stored, so createSchema recreates it. It only holds cached responses,
+// so nothing is lost.
+func (db *DB) dropOldResponseCache() error {
+	var old int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('response_cache') WHERE name = 'content_type'").Scan(&old)
+	if err != nil {
+		return fmt.Errorf("failed to inspect response_cache table: %w", err)
+	}
+	if old == 0 {
+		return nil
+	}
+	if _, err := db.conn.Exec("DROP TABLE response_cache"); err != nil {
+		return fmt.Errorf("failed to drop old response_cache table: %w", err)
+	}
+	return nil
+}
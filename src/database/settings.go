@@ -0,0 +1,250 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/utils"
+)
+
+// settingsCacheTTL is how long settings are served from memory before re-reading
+const settingsCacheTTL = 30 * time.Second
+
+// Settings provides cached read access to the settings table
+type Settings struct {
+	db     *sql.DB
+	mu     sync.RWMutex
+	values map[string]string
+	loaded time.Time
+}
+
+// NewSettings creates a settings cache backed by the given database
+func NewSettings(db *sql.DB) *Settings {
+	return &Settings{db: db}
+}
+
+// Get returns the raw value for a key and whether it exists
+func (s *Settings) Get(key string) (string, bool) {
+	s.mu.RLock()
+	fresh := s.values != nil && time.Since(s.loaded) < settingsCacheTTL
+	if fresh {
+		value, ok := s.values[key]
+		s.mu.RUnlock()
+		return value, ok
+	}
+	s.mu.RUnlock()
+
+	if err := s.load(); err != nil {
+		return "", false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// GetString returns a string setting or the fallback if unset
+func (s *Settings) GetString(key, fallback string) string {
+	if value, ok := s.Get(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// GetBool returns a boolean setting or the fallback if unset or invalid
+func (s *Settings) GetBool(key string, fallback bool) bool {
+	value, ok := s.Get(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		// HTML checkboxes submit "on"
+		return strings.EqualFold(strings.TrimSpace(value), "on")
+	}
+	return b
+}
+
+// GetInt returns an integer setting or the fallback if unset or invalid
+func (s *Settings) GetInt(key string, fallback int) int {
+	value, ok := s.Get(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// ProxyConfig returns the reverse proxy trust configuration
+func (s *Settings) ProxyConfig() utils.ProxyConfig {
+	return utils.ProxyConfig{
+		TrustHeaders:    s.GetBool("proxy.enabled", true) && s.GetBool("proxy.trust_headers", true),
+		ClientIPHeaders: utils.ParseHeaderList(s.GetString("proxy.client_ip_headers", "")),
+		AllowedHosts:    utils.ParseHeaderList(s.GetString("proxy.allowed_hosts", "")),
+	}
+}
+
+// DefaultMaxBatchSize is the batch endpoint item cap when
+// features.max_batch_size is unset or not positive
+const DefaultMaxBatchSize = 100
+
+// MaxBatchSize returns the item cap shared by all batch endpoints
+// A nil Settings returns the default.
+func (s *Settings) MaxBatchSize() int {
+	if s == nil {
+		return DefaultMaxBatchSize
+	}
+	if n := s.GetInt("features.max_batch_size", DefaultMaxBatchSize); n > 0 {
+		return n
+	}
+	return DefaultMaxBatchSize
+}
+
+// DefaultCitySearchLimit is the city search page size when
+// features.city_search_limit is unset or not positive
+const DefaultCitySearchLimit = 200
+
+// CitySearchLimit returns the default page size for city searches, capped at
+// MaxPageSize. A nil Settings returns the default.
+func (s *Settings) CitySearchLimit() int {
+	if s == nil {
+		return DefaultCitySearchLimit
+	}
+	n := s.GetInt("features.city_search_limit", DefaultCitySearchLimit)
+	if n <= 0 {
+		return DefaultCitySearchLimit
+	}
+	if n > MaxPageSize {
+		return MaxPageSize
+	}
+	return n
+}
+
+// DefaultAdminPath and DefaultAdminAPIPath are where the admin web UI and the
+// admin API are mounted when server.admin_path or server.admin_api_path is
+// unset or invalid
+const (
+	DefaultAdminPath    = "/admin"
+	DefaultAdminAPIPath = "/api/v1/admin"
+)
+
+// apiPrefix is the base path of the public API; the admin API must live under it
+const apiPrefix = "/api/v1"
+
+// reservedWebSegments are top-level paths the server already serves
+var reservedWebSegments = map[string]bool{
+	"api": true, "static": true, "healthz": true, "openapi": true, "graphql": true,
+	"version": true, "version.json": true, "version.txt": true,
+}
+
+// reservedAPISegments are paths under /api/v1 used by public endpoints
+var reservedAPISegments = map[string]bool{
+	"openapi": true, "openapi.json": true, "graphql": true, "zipcodes.json": true,
+	"zipcode": true, "state": true, "export": true, "areacode": true, "metro": true, "geoip": true, "geoip.txt": true,
+	"health": true, "version": true, "version.txt": true, "attribution": true,
+}
+
+// CleanAdminPath normalizes an admin mount path to a leading slash and no
+// trailing slash. Web paths may not be "/" or shadow a public route; API paths
+// (api true) must sit below /api/v1 without shadowing a public endpoint.
+func CleanAdminPath(value string, api bool) (string, error) {
+	p := strings.TrimSpace(value)
+	if p == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+	for _, c := range p {
+		if !isPathChar(c) {
+			return "", fmt.Errorf("%q contains invalid characters", value)
+		}
+	}
+	p = path.Clean("/" + p)
+
+	rest, reserved := strings.TrimPrefix(p, "/"), reservedWebSegments
+	if api {
+		if !strings.HasPrefix(p, apiPrefix+"/") {
+			return "", fmt.Errorf("%q must be under %s/", value, apiPrefix)
+		}
+		rest, reserved = strings.TrimPrefix(p, apiPrefix+"/"), reservedAPISegments
+	}
+	if rest == "" {
+		return "", fmt.Errorf("%q would replace the whole site", value)
+	}
+	if first, _, _ := strings.Cut(rest, "/"); reserved[first] {
+		return "", fmt.Errorf("%q conflicts with an existing route", value)
+	}
+	return p, nil
+}
+
+// isPathChar reports whether c is allowed in an admin mount path
+func isPathChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.ContainsRune("/-._~", c)
+}
+
+// AdminPath returns the admin web UI mount path from server.admin_path.
+// A nil Settings or an invalid value returns DefaultAdminPath.
+func (s *Settings) AdminPath() string {
+	return s.adminPath("server.admin_path", DefaultAdminPath, false)
+}
+
+// AdminAPIPath returns the admin API mount path from server.admin_api_path.
+// A nil Settings or an invalid value returns DefaultAdminAPIPath.
+func (s *Settings) AdminAPIPath() string {
+	return s.adminPath("server.admin_api_path", DefaultAdminAPIPath, true)
+}
+
+// adminPath reads and cleans an admin mount path setting
+func (s *Settings) adminPath(key, fallback string, api bool) string {
+	if s == nil {
+		return fallback
+	}
+	p, err := CleanAdminPath(s.GetString(key, fallback), api)
+	if err != nil {
+		return fallback
+	}
+	return p
+}
+
+// Invalidate forces the next read to reload settings from the database
+func (s *Settings) Invalidate() {
+	s.mu.Lock()
+	s.values = nil
+	s.mu.Unlock()
+}
+
+// load reads all settings from the database into memory
+func (s *Settings) load() error {
+	rows, err := s.db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		values[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.values = values
+	s.loaded = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ScheduledTask is a scheduled_tasks row run by the in-process scheduler
+type ScheduledTask struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	CronExpression string     `json:"cron_expression"`
+	Command        string     `json:"command"`
+	Enabled        bool       `json:"enabled"`
+	LastRun        *time.Time `json:"last_run,omitempty"`
+	NextRun        time.Time  `json:"next_run"`
+	LastStatus     string     `json:"last_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// ListScheduledTasks returns all scheduled tasks ordered by name
+func ListScheduledTasks(db *sql.DB) ([]ScheduledTask, error) {
+	rows, err := db.Query(`
+		SELECT id, name, cron_expression, command, IFNULL(enabled, 0), last_run, next_run,
+			IFNULL(last_status, ''), IFNULL(last_error, '')
+		FROM scheduled_tasks ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []ScheduledTask{}
+	for rows.Next() {
+		var t ScheduledTask
+		var lastRun sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.CronExpression, &t.Command, &t.Enabled, &lastRun,
+			&t.NextRun, &t.LastStatus, &t.LastError); err != nil {
+			return nil, err
+		}
+		if lastRun.Valid {
+			t.LastRun = &lastRun.Time
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// SetTaskNextRun schedules the next run of a task without recording a run
+func SetTaskNextRun(db *sql.DB, id string, next time.Time) error {
+	_, err := db.Exec("UPDATE scheduled_tasks SET next_run = ? WHERE id = ?", next.UTC(), id)
+	return err
+}
+
+// RecordTaskRun stores the outcome of a task run and its next scheduled time
+// runErr is nil on success.
+func RecordTaskRun(db *sql.DB, id string, ranAt, next time.Time, runErr error) error {
+	status, errMsg := "success", ""
+	if runErr != nil {
+		status, errMsg = "failed", runErr.Error()
+	}
+	_, err := db.Exec(`
+		UPDATE scheduled_tasks
+		SET last_run = ?, next_run = ?, last_status = ?, last_error = ?
+		WHERE id = ?
+	`, ranAt.UTC(), next.UTC(), status, nullString(errMsg), id)
+	return err
+}
+
+// insertDefaultScheduledTasks seeds the built-in tasks
+// next_run is recomputed from cron_expression when the scheduler starts.
+func insertDefaultScheduledTasks(db *sql.DB) error {
+	defaults := []struct {
+		name    string
+		cron    string
+		command string
+		enabled bool
+	}{
+		{"audit-prune", "30 3 * * *", "audit-prune", true},
+		{"history-prune", "45 3 * * *", "history-prune", true},
+		{"backup", "0 4 * * *", "backup", false},
+		{"geoip-update", "0 5 * * 0", "geoip-update", false},
+	}
+
+	for _, task := range defaults {
+		_, err := db.Exec(`
+			INSERT OR IGNORE INTO scheduled_tasks (name, cron_expression, command, enabled, next_run)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`, task.name, task.cron, task.command, task.enabled)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"strings"
+)
+
+// US timezone lookup without external services. Coordinates are placed with a
+// coarse, hand-digitized boundary set: three north-south polylines split the
+// contiguous states into Eastern/Central/Mountain/Pacific, and boxes cover
+// Arizona, Alaska, Hawaii and the territories. Boundaries are accurate to
+// roughly a county, so records are resolved by state first and only states
+// that span zones use the coordinates (see TimezoneForZipcode).
+//
+// Known approximations:
+//   - Arizona does not observe DST (America/Phoenix) except the Navajo Nation
+//     (America/Denver), approximated as the state's northeast corner; the Hopi
+//     reservation inside it is not carved out.
+//   - Indiana is mostly Eastern, with its northwest (Gary) and southwest
+//     (Evansville) corners on Central. Eastern Indiana, Kentucky and Michigan
+//     return America/New_York, which has the same rules today as their own
+//     IANA zones (America/Indiana/Indianapolis, America/Detroit, ...).
+//   - Nevada is treated as Pacific throughout (West Wendover is Mountain).
+
+// tzPoint is a boundary vertex
+type tzPoint struct{ lat, lon float64 }
+
+// Zone boundaries, north to south; a point west of a line is in the zone to
+// its west
+var (
+	easternCentralLine = []tzPoint{
+		{49.0, -89.5}, {47.0, -87.6}, {45.0, -87.6}, {42.0, -87.5},
+		{41.76, -86.5}, {41.0, -86.9}, {40.7, -87.5}, {38.5, -87.5},
+		{38.3, -86.9}, {37.9, -86.5}, {37.6, -86.1}, {37.0, -85.3},
+		{36.6, -85.0}, {36.0, -84.85}, {35.5, -85.1}, {35.0, -85.4},
+		{34.9, -85.6}, {34.0, -85.4}, {32.9, -85.15}, {32.0, -85.05},
+		{31.0, -85.0}, {30.6, -85.0}, {29.5, -85.1}, {24.0, -85.1},
+	}
+	centralMountainLine = []tzPoint{
+		{49.0, -104.05}, {47.5, -104.05}, {47.3, -101.9}, {46.0, -101.3},
+		{43.0, -100.8}, {42.9, -101.2}, {40.0, -101.5}, {37.7, -101.5},
+		{37.6, -102.05}, {37.0, -103.0}, {32.0, -103.05}, {31.99, -104.85},
+		{28.9, -104.85},
+	}
+	mountainPacificLine = []tzPoint{
+		{49.0, -116.05}, {48.0, -116.05}, {47.5, -115.7}, {46.6, -114.6},
+		{45.6, -114.5}, {45.55, -116.6}, {44.3, -117.2}, {44.2, -118.2},
+		{42.0, -118.2}, {41.99, -114.05}, {36.2, -114.05}, {35.0, -114.6},
+		{32.5, -114.8},
+	}
+)
+
+// tzBox is a lat/lon rectangle assigned to one zone
+type tzBox struct {
+	minLat, maxLat, minLon, maxLon float64
+	zone                           string
+}
+
+// tzBoxes are checked in order before the contiguous-state lines
+var tzBoxes = []tzBox{
+	{35.5, 37.0, -111.6, -109.04, "America/Denver"}, // Navajo Nation
+	{31.3, 37.0, -114.82, -109.04, "America/Phoenix"},
+	{51.0, 72.0, -180.0, -169.5, "America/Adak"},
+	{51.0, 56.0, 172.0, 180.0, "America/Adak"},
+	{51.0, 72.0, -169.5, -129.9, "America/Anchorage"},
+	{18.5, 22.5, -161.0, -154.5, "Pacific/Honolulu"},
+	{17.5, 18.8, -68.0, -64.3, "America/Puerto_Rico"},
+	{13.0, 13.8, 144.5, 145.1, "Pacific/Guam"},
+	{14.0, 20.6, 144.8, 146.1, "Pacific/Saipan"},
+	{-14.6, -11.0, -171.2, -168.0, "Pacific/Pago_Pago"},
+}
+
+// stateTimezones is the zone covering all or most of each state
+var stateTimezones = map[string]string{
+	"AL": "America/Chicago", "AK": "America/Anchorage", "AZ": "America/Phoenix",
+	"AR": "America/Chicago", "CA": "America/Los_Angeles", "CO": "America/Denver",
+	"CT": "America/New_York", "DE": "America/New_York", "DC": "America/New_York",
+	"FL": "America/New_York", "GA": "America/New_York", "HI": "Pacific/Honolulu",
+	"ID": "America/Denver", "IL": "America/Chicago", "IN": "America/New_York",
+	"IA": "America/Chicago", "KS": "America/Chicago", "KY": "America/New_York",
+	"LA": "America/Chicago", "ME": "America/New_York", "MD": "America/New_York",
+	"MA": "America/New_York", "MI": "America/New_York", "MN": "America/Chicago",
+	"MS": "America/Chicago", "MO": "America/Chicago", "MT": "America/Denver",
+	"NE": "America/Chicago", "NV": "America/Los_Angeles", "NH": "America/New_York",
+	"NJ": "America/New_York", "NM": "America/Denver", "NY": "America/New_York",
+	"NC": "America/New_York", "ND": "America/Chicago", "OH": "America/New_York",
+	"OK": "America/Chicago", "OR": "America/Los_Angeles", "PA": "America/New_York",
+	"RI": "America/New_York", "SC": "America/New_York", "SD": "America/Chicago",
+	"TN": "America/Chicago", "TX": "America/Chicago", "UT": "America/Denver",
+	"VT": "America/New_York", "VA": "America/New_York", "WA": "America/Los_Angeles",
+	"WV": "America/New_York", "WI": "America/Chicago", "WY": "America/Denver",
+	"PR": "America/Puerto_Rico", "VI": "America/St_Thomas", "GU": "Pacific/Guam",
+	"MP": "Pacific/Saipan", "AS": "Pacific/Pago_Pago", "FM": "Pacific/Pohnpei",
+	"MH": "Pacific/Majuro", "PW": "Pacific/Palau",
+}
+
+// splitStates span more than one zone, so their records use coordinates
+var splitStates = map[string]bool{
+	"AK": true, "AZ": true, "FL": true, "ID": true, "IN": true, "KS": true,
+	"KY": true, "MI": true, "ND": true, "NE": true, "OR": true, "SD": true,
+	"TN": true, "TX": true,
+}
+
+// TimezoneForCoords returns the IANA timezone of a US location, or "" if the
+// point is outside the areas covered. See the notes at the top of this file
+// for the approximations involved.
+func TimezoneForCoords(lat, lon float64) string {
+	for _, b := range tzBoxes {
+		if lat >= b.minLat && lat <= b.maxLat && lon >= b.minLon && lon <= b.maxLon {
+			return b.zone
+		}
+	}
+
+	// Contiguous states
+	if lat < 24.0 || lat > 49.5 || lon < -125.0 || lon > -66.5 {
+		return ""
+	}
+	switch {
+	case lon < boundaryLon(mountainPacificLine, lat):
+		return "America/Los_Angeles"
+	case lon < boundaryLon(centralMountainLine, lat):
+		return "America/Denver"
+	case lon < boundaryLon(easternCentralLine, lat):
+		return "America/Chicago"
+	default:
+		return "America/New_York"
+	}
+}
+
+// TimezoneForZipcode returns the timezone of a record: the state's zone for
+// single-zone states, otherwise the zone at its coordinates, falling back to
+// the state's main zone when it has none
+func TimezoneForZipcode(zc *Zipcode) string {
+	state := strings.ToUpper(zc.State)
+	if splitStates[state] {
+		if lat, lon, ok := zc.Coordinates(); ok {
+			if zone := TimezoneForCoords(lat, lon); zone != "" {
+				return zone
+			}
+		}
+	}
+	if zone, ok := stateTimezones[state]; ok {
+		return zone
+	}
+	if lat, lon, ok := zc.Coordinates(); ok {
+		return TimezoneForCoords(lat, lon)
+	}
+	return ""
+}
+
+// boundaryLon interpolates the longitude of a boundary line at lat, clamping
+// to the ends of the line
+func boundaryLon(line []tzPoint, lat float64) float64 {
+	if lat >= line[0].lat {
+		return line[0].lon
+	}
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		if lat >= b.lat {
+			return b.lon + (lat-b.lat)/(a.lat-b.lat)*(a.lon-b.lon)
+		}
+	}
+	return line[len(line)-1].lon
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// APIToken is a bearer token issued for gated public routes
+// The token itself is only returned once, when created
+type APIToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIToken issues a new API token and returns its ID and plaintext value
+func CreateAPIToken(db *sql.DB, name string) (string, string, error) {
+	token := generateRandomString(64)
+
+	var id string
+	err := db.QueryRow(`
+		INSERT INTO api_tokens (name, token_hash) VALUES (?, ?)
+		RETURNING id
+	`, name, hashString(token)).Scan(&id)
+	if err != nil {
+		return "", "", err
+	}
+	return id, token, nil
+}
+
+// ListAPITokens returns all API tokens, newest first
+func ListAPITokens(db *sql.DB) ([]APIToken, error) {
+	rows, err := db.Query(`
+		SELECT id, name, created_at, last_used, revoked_at
+		FROM api_tokens ORDER BY created_at DESC, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var lastUsed, revokedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &lastUsed, &revokedAt); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			t.LastUsed = &lastUsed.Time
+		}
+		if revokedAt.Valid {
+			t.RevokedAt = &revokedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes a token by ID
+// Returns false if no active token has that ID
+func RevokeAPIToken(db *sql.DB, id string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// VerifyAPIToken reports whether token is the admin token or an active API token
+func VerifyAPIToken(db *sql.DB, token string) bool {
+	if token == "" {
+		return false
+	}
+	if _, ok := AdminTokenUser(db, token); ok {
+		return true
+	}
+
+	result, err := db.Exec(`
+		UPDATE api_tokens SET last_used = ? WHERE token_hash = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), hashString(token))
+	if err != nil {
+		return false
+	}
+	n, _ := result.RowsAffected()
+	return n > 0
+}
@@ -1,27 +1,262 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Zipcode represents a US zipcode record
 type Zipcode struct {
-	State     string  `json:"state"`
-	City      string  `json:"city"`
-	County    string  `json:"county"`
-	ZipCode   int     `json:"zip_code"`
-	Latitude  string  `json:"latitude"`
-	Longitude string  `json:"longitude"`
+	State     string `json:"state" xml:"state"`
+	City      string `json:"city" xml:"city"`
+	County    string `json:"county" xml:"county"`
+	ZipCode   string `json:"zip_code" xml:"zip_code"` // Zero-padded 5 digits ("01001")
+	Latitude  string `json:"latitude" xml:"latitude"`
+	Longitude string `json:"longitude" xml:"longitude"`
+	Geohash   string `json:"geohash,omitempty" xml:"geohash,omitempty"`
+	FIPS      string `json:"fips,omitempty" xml:"fips,omitempty"`
+	Timezone  string `json:"timezone,omitempty" xml:"timezone,omitempty"`
+
+	// Plus4 is the 4-digit add-on of a ZIP+4 lookup ("94102-1234"). The
+	// dataset is keyed by 5-digit code, so it is echoed from the request
+	// rather than stored.
+	Plus4 string `json:"plus4,omitempty" xml:"plus4,omitempty"`
+
+	// Distance from the search point, set by proximity queries
+	Distance *float64 `json:"distance,omitempty" xml:"distance,omitempty"`
+}
+
+// FormatZipCode renders a numeric zipcode as the zero-padded 5-digit string
+// stored in zip_code ("00601")
+func FormatZipCode(code int) string {
+	return fmt.Sprintf("%05d", code)
+}
+
+// ParseZipCode validates a zipcode given as exactly 5 digits ("00601") and
+// returns it as stored in the zip_code column
+func ParseZipCode(s string) (string, error) {
+	if len(s) != 5 || !isDigits(s) {
+		return "", fmt.Errorf("invalid zipcode %q: must be exactly 5 digits (00000-99999)", s)
+	}
+	return s, nil
+}
+
+// ParseZipPlus4 validates a 5-digit zipcode or a ZIP+4 code ("94102-1234" or
+// "941021234") and returns the 5-digit code and the 4-digit add-on, which is
+// empty for a plain 5-digit code
+func ParseZipPlus4(s string) (string, string, error) {
+	var zip, plus4 string
+	switch {
+	case len(s) == 5:
+		zip = s
+	case len(s) == 10 && s[5] == '-':
+		zip, plus4 = s[:5], s[6:]
+	case len(s) == 9:
+		zip, plus4 = s[:5], s[5:]
+	default:
+		return "", "", fmt.Errorf("invalid zipcode %q: must be 5 digits (94102) or ZIP+4 (94102-1234)", s)
+	}
+	if !isDigits(zip) || !isDigits(plus4) {
+		return "", "", fmt.Errorf("invalid zipcode %q: must be 5 digits (94102) or ZIP+4 (94102-1234)", s)
+	}
+	return zip, plus4, nil
+}
+
+// FormatZipPlus4 renders a zipcode with its ZIP+4 add-on when it has one
+func FormatZipPlus4(code, plus4 string) string {
+	if plus4 == "" {
+		return code
+	}
+	return code + "-" + plus4
+}
+
+// PadZipCodesJSON re-encodes dataset JSON with every zip_code as a
+// zero-padded string (1001 becomes "01001"), matching the API's zip_code.
+// zip_code is decoded the same way LoadFromJSON decodes it; every other field,
+// including ones the loader ignores, is kept byte for byte. Records are
+// written back indented like the shipped file, with their keys sorted. Data
+// that doesn't parse is returned as is; loading it reports the error.
+func PadZipCodesJSON(data []byte) []byte {
+	var records []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return data
+	}
+	for _, record := range records {
+		raw, ok := record["zip_code"]
+		if !ok {
+			continue
+		}
+		var zip flexZip
+		if err := json.Unmarshal(raw, &zip); err != nil {
+			return data
+		}
+		padded, err := json.Marshal(string(zip))
+		if err != nil {
+			return data
+		}
+		record["zip_code"] = padded
+	}
+	padded, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return data
+	}
+	return append(padded, '\n')
+}
+
+// zipPrefixRange returns the zip_code range covered by a 1-5 digit prefix,
+// so "006" covers "00600"-"00699". Codes are fixed-width digit strings, so
+// they compare in the same order as their numeric values.
+func zipPrefixRange(prefix string) (string, string, error) {
+	if len(prefix) == 0 || len(prefix) > 5 || !isDigits(prefix) {
+		return "", "", fmt.Errorf("zipcode prefix must be 1-5 digits")
+	}
+	pad := 5 - len(prefix)
+	return prefix + strings.Repeat("0", pad), prefix + strings.Repeat("9", pad), nil
+}
+
+// isDigits reports whether s consists only of ASCII digits
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// zipcodeFields has Zipcode's fields without its MarshalXML method
+type zipcodeFields Zipcode
+
+// MarshalXML encodes a zipcode as a <zipcode> element (or the element it is
+// encoded as)
+func (zc Zipcode) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if start.Name.Local == "" || start.Name.Local == "Zipcode" {
+		start.Name.Local = "zipcode"
+	}
+	return e.EncodeElement(zipcodeFields(zc), start)
+}
+
+// QueryOptions holds optional filters for list queries
+type QueryOptions struct {
+	// GeoOnly restricts results to records with coordinates
+	GeoOnly bool
+}
+
+// zipcodeColumns is the column list scanned by scanZipcodes
+const zipcodeColumns = "state, city, county, zip_code, latitude, longitude, IFNULL(geohash, ''), IFNULL(fips, ''), IFNULL(timezone, '')"
+
+// hasCoordinatesClause matches records that can be placed on a map
+const hasCoordinatesClause = "latitude IS NOT NULL AND latitude != '' AND longitude IS NOT NULL AND longitude != ''"
+
+// filter appends the option filters to a WHERE condition
+func (o QueryOptions) filter(condition string) string {
+	if o.GeoOnly {
+		condition += " AND " + hasCoordinatesClause
+	}
+	return condition
+}
+
+// zipcodeRecord is a record in the embedded JSON, where the zipcode and
+// coordinates may be encoded either as strings or as numbers
+type zipcodeRecord struct {
+	State     string     `json:"state"`
+	City      string     `json:"city"`
+	County    string     `json:"county"`
+	ZipCode   flexZip    `json:"zip_code"`
+	Latitude  flexString `json:"latitude"`
+	Longitude flexString `json:"longitude"`
+}
+
+func (r zipcodeRecord) zipcode() Zipcode {
+	return Zipcode{
+		State:     r.State,
+		City:      r.City,
+		County:    r.County,
+		ZipCode:   string(r.ZipCode),
+		Latitude:  string(r.Latitude),
+		Longitude: string(r.Longitude),
+	}
+}
+
+// flexString decodes a JSON string or number into its text form
+type flexString string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = flexString(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = flexString(n.String())
+	return nil
+}
+
+// flexZip decodes a zipcode given as a JSON number (1001) or as a string,
+// either zero-padded ("01001") or ZIP+4 ("01001-1234", whose add-on is
+// dropped since records are per 5-digit code), into the zero-padded form
+type flexZip string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (z *flexZip) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid zip_code %s: %w", data, err)
+		}
+		if n < 0 || n > 99999 {
+			return fmt.Errorf("invalid zip_code %d: must be 0-99999", n)
+		}
+		*z = flexZip(FormatZipCode(n))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	code, _, err := ParseZipPlus4(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*z = flexZip(code)
+	return nil
+}
+
+// nullString maps an empty string to SQL NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
 }
 
 // DB holds the database connection
 type DB struct {
-	conn *sql.DB
+	conn    *sql.DB
+	states  []string     // Only these states are loaded; empty loads all
+	version atomic.Value // Dataset version string, set by LoadFromJSON
 }
 
 // Initialize creates and initializes the database
@@ -41,32 +276,105 @@ func Initialize(dbPath string) (*DB, error) {
 	return db, nil
 }
 
-// createSchema creates the database tables
-func (db *DB) createSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS zipcodes (
+// SetStates restricts LoadFromJSON to the given state codes (case-insensitive)
+// An empty list loads every state. Takes effect on the next load; a changed
+// list forces a reload even if the dataset itself is unchanged.
+func (db *DB) SetStates(states []string) {
+	db.states = nil
+	seen := make(map[string]bool)
+	for _, st := range states {
+		st = strings.ToUpper(strings.TrimSpace(st))
+		if st != "" && !seen[st] {
+			seen[st] = true
+			db.states = append(db.states, st)
+		}
+	}
+	sort.Strings(db.states)
+}
+
+// States returns the state codes loading is restricted to, or nil for all
+func (db *DB) States() []string {
+	return db.states
+}
+
+// zipcodesTableColumns is the zipcodes table definition, shared by
+// createSchema and the shadow table LoadFromJSON builds. zip_code is the
+// zero-padded 5-digit code as text. Databases created by older versions lack
+// some columns, or store zip_code as an integer, until migrate fixes them.
+const zipcodesTableColumns = `(
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		state TEXT NOT NULL,
 		city TEXT NOT NULL,
 		county TEXT,
-		zip_code INTEGER NOT NULL UNIQUE,
+		zip_code TEXT NOT NULL UNIQUE,
 		latitude TEXT,
 		longitude TEXT,
+		geohash TEXT,
+		city_normalized TEXT,
+		fips TEXT,
+		timezone TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`
+
+// zipAreaCodesTableColumns is the zip_area_codes table definition, shared by
+// createSchema and the zip_code migration
+const zipAreaCodesTableColumns = `(
+		area_code TEXT NOT NULL,
+		zip_code TEXT NOT NULL,
+		PRIMARY KEY (area_code, zip_code)
+	)`
+
+// createSchema creates the database tables
+func (db *DB) createSchema() error {
+	if err := db.dropOldResponseCache(); err != nil {
+		return err
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS zipcodes ` + zipcodesTableColumns + `;
+
+	CREATE TABLE IF NOT EXISTS county_fips (
+		state TEXT NOT NULL,
+		county TEXT NOT NULL,
+		fips TEXT NOT NULL,
+		PRIMARY KEY (state, county)
+	);
+
+	CREATE TABLE IF NOT EXISTS zip_area_codes ` + zipAreaCodesTableColumns + `;
+
+	CREATE TABLE IF NOT EXISTS dataset_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS response_cache (
+		key TEXT PRIMARY KEY,
+		status INTEGER NOT NULL,
+		headers TEXT NOT NULL,
+		body BLOB NOT NULL,
+		expires_at INTEGER NOT NULL
 	);
 
-	CREATE INDEX IF NOT EXISTS idx_zip_code ON zipcodes(zip_code);
-	CREATE INDEX IF NOT EXISTS idx_city ON zipcodes(city);
-	CREATE INDEX IF NOT EXISTS idx_state ON zipcodes(state);
-	CREATE INDEX IF NOT EXISTS idx_state_city ON zipcodes(state, city);
+	CREATE INDEX IF NOT EXISTS idx_response_cache_expires ON response_cache(expires_at);
 	`
 
-	_, err := db.conn.Exec(schema)
-	return err
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	return db.migrate()
 }
 
-// LoadFromJSON loads zipcode data from embedded JSON bytes
+// LoadFromJSON loads zipcode data from JSON bytes
+// A checksum of the data is recorded so an unchanged dataset is skipped on
+// restart, while a changed one (e.g. an updated --data-file) replaces the
+// existing records
 func (db *DB) LoadFromJSON(data []byte) error {
+	checksum := datasetChecksum(data)
+	if len(db.states) > 0 {
+		checksum += ":" + strings.Join(db.states, ",")
+	}
+
 	// Check if data already loaded
 	var count int
 	err := db.conn.QueryRow("SELECT COUNT(*) FROM zipcodes").Scan(&count)
@@ -75,36 +383,76 @@ func (db *DB) LoadFromJSON(data []byte) error {
 	}
 
 	if count > 0 {
-		fmt.Printf("Database already contains %d zipcodes, skipping load\n", count)
-		return nil
+		if db.datasetMeta("checksum") == checksum {
+			fmt.Printf("Database already contains %d zipcodes, skipping load\n", count)
+			db.version.Store(datasetVersion(checksum))
+			return nil
+		}
+		fmt.Printf("Dataset changed, replacing %d zipcodes\n", count)
 	}
 
 	// Parse JSON
-	var zipcodes []Zipcode
-	if err := json.Unmarshal(data, &zipcodes); err != nil {
+	var records []zipcodeRecord
+	if err := json.Unmarshal(data, &records); err != nil {
 		return fmt.Errorf("failed to parse JSON: %w", err)
 	}
+	include := make(map[string]bool, len(db.states))
+	for _, st := range db.states {
+		include[st] = true
+	}
+	zipcodes := make([]Zipcode, 0, len(records))
+	for _, rec := range records {
+		zc := rec.zipcode()
+		if len(include) > 0 && !include[strings.ToUpper(zc.State)] {
+			continue
+		}
+		zipcodes = append(zipcodes, zc)
+	}
 
-	// Begin transaction
+	// The new data is built in a shadow table and only swapped in once it is
+	// complete, so a failed or interrupted load leaves the current data intact
+	if err := db.fillShadowTable(zipcodes); err != nil {
+		return err
+	}
+	if err := db.swapShadowTable(checksum); err != nil {
+		return err
+	}
+
+	db.version.Store(datasetVersion(checksum))
+	fmt.Printf("Successfully loaded %d zipcodes\n", len(zipcodes))
+	return nil
+}
+
+// shadowTable is where LoadFromJSON builds a dataset before swapping it in
+const shadowTable = "zipcodes_new"
+
+// fillShadowTable recreates the shadow table and inserts zipcodes into it in
+// one transaction. A leftover shadow table from an interrupted load is dropped.
+func (db *DB) fillShadowTable(zipcodes []Zipcode) error {
 	tx, err := db.conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Prepare statement
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + shadowTable); err != nil {
+		return fmt.Errorf("failed to drop stale %s: %w", shadowTable, err)
+	}
+	if _, err := tx.Exec("CREATE TABLE " + shadowTable + " " + zipcodesTableColumns); err != nil {
+		return fmt.Errorf("failed to create %s: %w", shadowTable, err)
+	}
+
 	stmt, err := tx.Prepare(`
-		INSERT INTO zipcodes (state, city, county, zip_code, latitude, longitude)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO ` + shadowTable + ` (state, city, county, zip_code, latitude, longitude, geohash, city_normalized, timezone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	// Insert data
 	for i, zc := range zipcodes {
-		_, err := stmt.Exec(zc.State, zc.City, zc.County, zc.ZipCode, zc.Latitude, zc.Longitude)
+		_, err := stmt.Exec(zc.State, zc.City, zc.County, zc.ZipCode, zc.Latitude, zc.Longitude, nullString(geohashFor(&zc)), NormalizeCity(zc.City), nullString(TimezoneForZipcode(&zc)))
 		if err != nil {
 			return fmt.Errorf("failed to insert zipcode at index %d: %w", i, err)
 		}
@@ -114,22 +462,88 @@ func (db *DB) LoadFromJSON(data []byte) error {
 		}
 	}
 
-	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return nil
+}
+
+// swapShadowTable replaces zipcodes with the filled shadow table by rename,
+// rebuilds the indexes and FIPS codes and records the dataset checksum, all
+// in one transaction
+func (db *DB) swapShadowTable(checksum string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	fmt.Printf("Successfully loaded %d zipcodes\n", len(zipcodes))
+	if _, err := tx.Exec("DROP TABLE zipcodes"); err != nil {
+		return fmt.Errorf("failed to drop old zipcodes: %w", err)
+	}
+	if _, err := tx.Exec("ALTER TABLE " + shadowTable + " RENAME TO zipcodes"); err != nil {
+		return fmt.Errorf("failed to swap in %s: %w", shadowTable, err)
+	}
+	for _, index := range zipcodeIndexes {
+		if _, err := tx.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(fillCountyFIPS); err != nil {
+		return fmt.Errorf("failed to set county FIPS codes: %w", err)
+	}
+
+	if _, err := tx.Exec("INSERT OR REPLACE INTO dataset_meta (key, value) VALUES ('checksum', ?)", checksum); err != nil {
+		return fmt.Errorf("failed to record dataset checksum: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
+// datasetChecksum returns the SHA-256 of a dataset file
+func datasetChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// datasetVersion shortens a dataset checksum to the version reported to
+// clients. A --states filter changes the loaded data, so it changes the
+// version too.
+func datasetVersion(checksum string) string {
+	if strings.Contains(checksum, ":") {
+		checksum = datasetChecksum([]byte(checksum))
+	}
+	return checksum[:12]
+}
+
+// DatasetVersion identifies the loaded dataset: the first 12 hex digits of
+// its SHA-256, or "" before anything is loaded. It changes whenever a
+// different dataset (or state filter) is loaded.
+func (db *DB) DatasetVersion() string {
+	v, _ := db.version.Load().(string)
+	return v
+}
+
+// datasetMeta returns a value from dataset_meta, or "" if unset
+func (db *DB) datasetMeta(key string) string {
+	var value string
+	if err := db.conn.QueryRow("SELECT value FROM dataset_meta WHERE key = ?", key).Scan(&value); err != nil {
+		return ""
+	}
+	return value
+}
+
 // SearchByZipCode finds a zipcode by its code
-func (db *DB) SearchByZipCode(zipCode int) (*Zipcode, error) {
+func (db *DB) SearchByZipCode(ctx context.Context, zipCode string) (*Zipcode, error) {
 	var zc Zipcode
-	err := db.conn.QueryRow(`
-		SELECT state, city, county, zip_code, latitude, longitude
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT `+zipcodeColumns+`
 		FROM zipcodes WHERE zip_code = ?
-	`, zipCode).Scan(&zc.State, &zc.City, &zc.County, &zc.ZipCode, &zc.Latitude, &zc.Longitude)
+	`, zipCode).Scan(&zc.State, &zc.City, &zc.County, &zc.ZipCode, &zc.Latitude, &zc.Longitude, &zc.Geohash, &zc.FIPS, &zc.Timezone)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -141,13 +555,34 @@ func (db *DB) SearchByZipCode(zipCode int) (*Zipcode, error) {
 	return &zc, nil
 }
 
-// SearchByCity finds zipcodes by city name
-func (db *DB) SearchByCity(city string) ([]Zipcode, error) {
-	rows, err := db.conn.Query(`
-		SELECT state, city, county, zip_code, latitude, longitude
-		FROM zipcodes WHERE LOWER(city) = LOWER(?)
+// MaxPageSize is the hard ceiling on rows returned by one page of a list
+// query (SearchByCity, SearchByState, SearchByPrefix)
+const MaxPageSize = 1000
+
+// clampPage bounds a page request to 1-MaxPageSize rows and a non-negative
+// offset; limit <= 0 means MaxPageSize
+func clampPage(limit, offset int) (int, int) {
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// SearchByCity finds zipcodes by city name, returning at most limit rows
+// after skipping offset. limit is clamped to 1-MaxPageSize.
+// Names are matched after NormalizeCity, so "St. Louis" finds "Saint Louis"
+func (db *DB) SearchByCity(ctx context.Context, city string, opts QueryOptions, limit, offset int) ([]Zipcode, error) {
+	limit, offset = clampPage(limit, offset)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("city_normalized = ?")+`
 		ORDER BY state, zip_code
-	`, city)
+		LIMIT ? OFFSET ?
+	`, NormalizeCity(city), limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -156,14 +591,89 @@ func (db *DB) SearchByCity(city string) ([]Zipcode, error) {
 	return db.scanZipcodes(rows)
 }
 
-// SearchByState finds zipcodes by state
-func (db *DB) SearchByState(state string) ([]Zipcode, error) {
-	rows, err := db.conn.Query(`
-		SELECT state, city, county, zip_code, latitude, longitude
-		FROM zipcodes WHERE UPPER(state) = UPPER(?)
+// CountByCity returns how many zipcodes SearchByCity would match without a limit
+func (db *DB) CountByCity(ctx context.Context, city string, opts QueryOptions) (int, error) {
+	var total int
+	err := db.conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM zipcodes WHERE "+opts.filter("city_normalized = ?"),
+		NormalizeCity(city)).Scan(&total)
+	return total, err
+}
+
+// SearchByState finds zipcodes by state, returning at most limit rows after
+// skipping offset. limit is clamped to 1-MaxPageSize.
+func (db *DB) SearchByState(ctx context.Context, state string, opts QueryOptions, limit, offset int) ([]Zipcode, error) {
+	limit, offset = clampPage(limit, offset)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("UPPER(state) = UPPER(?)")+`
 		ORDER BY city, zip_code
-		LIMIT 1000
-	`, state)
+		LIMIT ? OFFSET ?
+	`, state, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanZipcodes(rows)
+}
+
+// CountByState returns how many zipcodes SearchByState would match without a limit
+func (db *DB) CountByState(ctx context.Context, state string, opts QueryOptions) (int, error) {
+	var total int
+	err := db.conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM zipcodes WHERE "+opts.filter("UPPER(state) = UPPER(?)"),
+		state).Scan(&total)
+	return total, err
+}
+
+// StreamByState calls fn for every zipcode in a state, without a row cap,
+// reading rows one at a time so memory stays flat. Stops at the first error from fn.
+func (db *DB) StreamByState(ctx context.Context, state string, opts QueryOptions, fn func(*Zipcode) error) error {
+	return db.streamZipcodes(ctx, opts.filter("UPPER(state) = UPPER(?)"), "city, zip_code", []interface{}{state}, fn)
+}
+
+// StreamAll calls fn for every zipcode in zip code order, or only those in
+// state when it is not empty. Like StreamByState it has no row cap and
+// reads rows one at a time.
+func (db *DB) StreamAll(ctx context.Context, state string, opts QueryOptions, fn func(*Zipcode) error) error {
+	if state != "" {
+		return db.streamZipcodes(ctx, opts.filter("UPPER(state) = UPPER(?)"), "zip_code", []interface{}{state}, fn)
+	}
+	return db.streamZipcodes(ctx, opts.filter("1 = 1"), "zip_code", nil, fn)
+}
+
+// streamZipcodes runs a zipcode query and calls fn for each row as it is read
+func (db *DB) streamZipcodes(ctx context.Context, condition, orderBy string, args []interface{}, fn func(*Zipcode) error) error {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+condition+`
+		ORDER BY `+orderBy, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		zc, err := scanZipcode(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(&zc); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SearchByFIPS finds zipcodes in the county with the given 5-digit FIPS code
+func (db *DB) SearchByFIPS(ctx context.Context, fips string, opts QueryOptions) ([]Zipcode, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("fips = ?")+`
+		ORDER BY zip_code
+	`, fips)
 	if err != nil {
 		return nil, err
 	}
@@ -173,12 +683,12 @@ func (db *DB) SearchByState(state string) ([]Zipcode, error) {
 }
 
 // SearchByStateAndCity finds zipcodes by state and city
-func (db *DB) SearchByStateAndCity(state, city string) ([]Zipcode, error) {
-	rows, err := db.conn.Query(`
-		SELECT state, city, county, zip_code, latitude, longitude
-		FROM zipcodes WHERE UPPER(state) = UPPER(?) AND LOWER(city) = LOWER(?)
+func (db *DB) SearchByStateAndCity(ctx context.Context, state, city string, opts QueryOptions) ([]Zipcode, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("UPPER(state) = UPPER(?) AND city_normalized = ?")+`
 		ORDER BY zip_code
-	`, state, city)
+	`, state, NormalizeCity(city))
 	if err != nil {
 		return nil, err
 	}
@@ -187,14 +697,212 @@ func (db *DB) SearchByStateAndCity(state, city string) ([]Zipcode, error) {
 	return db.scanZipcodes(rows)
 }
 
-// SearchByPrefix finds zipcodes by prefix (e.g., "94" matches 94000-94999)
-func (db *DB) SearchByPrefix(prefix string) ([]Zipcode, error) {
-	rows, err := db.conn.Query(`
-		SELECT state, city, county, zip_code, latitude, longitude
-		FROM zipcodes WHERE CAST(zip_code AS TEXT) LIKE ?
+// maxInVariables caps the values bound in one IN (...) list. SQLite builds
+// before 3.32 reject statements with more than 999 variables; the margin
+// leaves room for the other parameters of the query.
+const maxInVariables = 900
+
+// inChunks splits values into slices of at most maxInVariables
+func inChunks[T any](values []T) [][]T {
+	var chunks [][]T
+	for len(values) > maxInVariables {
+		chunks = append(chunks, values[:maxInVariables])
+		values = values[maxInVariables:]
+	}
+	return append(chunks, values)
+}
+
+// placeholders returns n comma-separated "?" for an IN list
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// SearchByZipCodes looks up several zipcodes at once, ordered by zip code
+// Codes that don't exist are simply absent from the result. Long lists are
+// queried in chunks under SQLite's variable limit.
+func (db *DB) SearchByZipCodes(ctx context.Context, codes []string) ([]Zipcode, error) {
+	results := []Zipcode{}
+	if len(codes) == 0 {
+		return results, nil
+	}
+
+	for _, chunk := range inChunks(codes) {
+		args := make([]interface{}, len(chunk))
+		for i, code := range chunk {
+			args[i] = code
+		}
+
+		rows, err := db.conn.QueryContext(ctx, `
+			SELECT `+zipcodeColumns+`
+			FROM zipcodes WHERE zip_code IN (`+placeholders(len(chunk))+`)
+			ORDER BY zip_code
+		`, args...)
+		if err != nil {
+			return nil, err
+		}
+		found, err := db.scanZipcodes(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].ZipCode < results[j].ZipCode
+	})
+	return results, nil
+}
+
+// SearchByCities finds zipcodes for several cities in one query
+// An empty state matches the cities in any state. Long lists are queried in
+// chunks under SQLite's variable limit.
+func (db *DB) SearchByCities(ctx context.Context, state string, cities []string, opts QueryOptions) ([]Zipcode, error) {
+	results := []Zipcode{}
+	if len(cities) == 0 {
+		return results, nil
+	}
+
+	for _, chunk := range inChunks(cities) {
+		args := make([]interface{}, 0, len(chunk)+1)
+		for _, city := range chunk {
+			args = append(args, NormalizeCity(city))
+		}
+
+		condition := "city_normalized IN (" + placeholders(len(chunk)) + ")"
+		if state != "" {
+			condition += " AND UPPER(state) = UPPER(?)"
+			args = append(args, state)
+		}
+		query := `
+			SELECT ` + zipcodeColumns + `
+			FROM zipcodes WHERE ` + opts.filter(condition)
+		query += " ORDER BY state, city, zip_code"
+
+		rows, err := db.conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		found, err := db.scanZipcodes(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.State != b.State {
+			return a.State < b.State
+		}
+		if a.City != b.City {
+			return a.City < b.City
+		}
+		return a.ZipCode < b.ZipCode
+	})
+	return results, nil
+}
+
+// SearchByPrefix finds zipcodes by prefix (e.g., "94" matches 94000-94999),
+// returning at most limit rows after skipping offset. limit is clamped to
+// 1-MaxPageSize.
+func (db *DB) SearchByPrefix(ctx context.Context, prefix string, opts QueryOptions, limit, offset int) ([]Zipcode, error) {
+	low, high, err := zipPrefixRange(prefix)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset = clampPage(limit, offset)
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("zip_code BETWEEN ? AND ?")+`
 		ORDER BY zip_code
-		LIMIT 500
-	`, prefix+"%")
+		LIMIT ? OFFSET ?
+	`, low, high, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return db.scanZipcodes(rows)
+}
+
+// CountByPrefix returns how many zipcodes SearchByPrefix would match without a limit
+func (db *DB) CountByPrefix(ctx context.Context, prefix string, opts QueryOptions) (int, error) {
+	low, high, err := zipPrefixRange(prefix)
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	err = db.conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM zipcodes WHERE "+opts.filter("zip_code BETWEEN ? AND ?"),
+		low, high).Scan(&total)
+	return total, err
+}
+
+// NearestPrefix returns the prefix of the same length as prefix that is
+// numerically closest to it and matches at least one zipcode, e.g. "005" for
+// "000". Ties go to the lower prefix. Returns "" when no zipcode matches opts.
+func (db *DB) NearestPrefix(ctx context.Context, prefix string, opts QueryOptions) (string, error) {
+	low, high, err := zipPrefixRange(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	for _, q := range []struct {
+		condition string
+		bound     string
+		order     string
+	}{
+		{"zip_code < ?", low, "zip_code DESC"},
+		{"zip_code > ?", high, "zip_code"},
+	} {
+		var code string
+		err := db.conn.QueryRowContext(ctx, `
+			SELECT zip_code FROM zipcodes WHERE `+opts.filter(q.condition)+`
+			ORDER BY `+q.order+` LIMIT 1
+		`, q.bound).Scan(&code)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, code[:len(prefix)])
+	}
+
+	n, _ := strconv.Atoi(prefix)
+	best, bestDistance := "", 0
+	for _, c := range candidates {
+		m, _ := strconv.Atoi(c)
+		distance := m - n
+		if distance < 0 {
+			distance = -distance
+		}
+		if best == "" || distance < bestDistance {
+			best, bestDistance = c, distance
+		}
+	}
+	return best, nil
+}
+
+// SearchByRadius finds the zipcodes within radiusMeters of a point, nearest
+// first (ties by zip code), with Distance set in meters. Coordinates are
+// stored as text, so rows with missing or unparseable ones are skipped.
+func (db *DB) SearchByRadius(ctx context.Context, lat, lng, radiusMeters float64) ([]Zipcode, error) {
+	return db.withinRadius(ctx, lat, lng, radiusMeters)
+}
+
+// SearchByGeohash finds zipcodes whose geohash starts with prefix
+func (db *DB) SearchByGeohash(ctx context.Context, prefix string, opts QueryOptions) ([]Zipcode, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT `+zipcodeColumns+`
+		FROM zipcodes WHERE `+opts.filter("geohash LIKE ?")+`
+		ORDER BY geohash, zip_code
+		LIMIT 1000
+	`, strings.ToLower(prefix)+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -204,7 +912,7 @@ func (db *DB) SearchByPrefix(prefix string) ([]Zipcode, error) {
 }
 
 // AutoComplete provides autocomplete suggestions
-func (db *DB) AutoComplete(query string, limit int) ([]string, error) {
+func (db *DB) AutoComplete(ctx context.Context, query string, limit int) ([]string, error) {
 	if limit <= 0 {
 		limit = 10
 	}
@@ -214,11 +922,11 @@ func (db *DB) AutoComplete(query string, limit int) ([]string, error) {
 		return []string{}, nil
 	}
 
-	rows, err := db.conn.Query(`
+	rows, err := db.conn.QueryContext(ctx, `
 		SELECT DISTINCT city || ', ' || state as suggestion
 		FROM zipcodes
 		WHERE LOWER(city) LIKE LOWER(?) OR UPPER(state) LIKE UPPER(?)
-		ORDER BY city
+		ORDER BY city, state
 		LIMIT ?
 	`, query+"%", query+"%", limit)
 	if err != nil {
@@ -226,7 +934,7 @@ func (db *DB) AutoComplete(query string, limit int) ([]string, error) {
 	}
 	defer rows.Close()
 
-	var suggestions []string
+	suggestions := []string{}
 	for rows.Next() {
 		var suggestion string
 		if err := rows.Scan(&suggestion); err != nil {
@@ -238,13 +946,67 @@ func (db *DB) AutoComplete(query string, limit int) ([]string, error) {
 	return suggestions, nil
 }
 
+// Suggestion is a structured autocomplete result: a city with the zipcode to
+// prefill (its lowest) and how many zipcodes it has
+type Suggestion struct {
+	Label    string `json:"label"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	ZipCode  string `json:"zip_code"`
+	ZipCount int    `json:"zip_count"`
+}
+
+// AutoCompleteStructured matches like AutoComplete but returns Suggestions
+func (db *DB) AutoCompleteStructured(ctx context.Context, query string, limit int) ([]Suggestion, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []Suggestion{}, nil
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT city, state, MIN(zip_code), COUNT(*)
+		FROM zipcodes
+		WHERE LOWER(city) LIKE LOWER(?) OR UPPER(state) LIKE UPPER(?)
+		GROUP BY city, state
+		ORDER BY city, state
+		LIMIT ?
+	`, query+"%", query+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.City, &s.State, &s.ZipCode, &s.ZipCount); err != nil {
+			return nil, err
+		}
+		s.Label = s.City + ", " + s.State
+		suggestions = append(suggestions, s)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// Count returns the number of zipcodes loaded
+func (db *DB) Count(ctx context.Context) (int, error) {
+	var total int
+	err := db.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM zipcodes").Scan(&total)
+	return total, err
+}
+
 // GetStats returns database statistics
-func (db *DB) GetStats() (map[string]interface{}, error) {
+func (db *DB) GetStats(ctx context.Context) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
 	// Total zipcodes
 	var total int
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM zipcodes").Scan(&total)
+	err := db.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM zipcodes").Scan(&total)
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +1014,7 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 
 	// Total states
 	var states int
-	err = db.conn.QueryRow("SELECT COUNT(DISTINCT state) FROM zipcodes").Scan(&states)
+	err = db.conn.QueryRowContext(ctx, "SELECT COUNT(DISTINCT state) FROM zipcodes").Scan(&states)
 	if err != nil {
 		return nil, err
 	}
@@ -260,21 +1022,80 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 
 	// Total cities
 	var cities int
-	err = db.conn.QueryRow("SELECT COUNT(DISTINCT city) FROM zipcodes").Scan(&cities)
+	err = db.conn.QueryRowContext(ctx, "SELECT COUNT(DISTINCT city) FROM zipcodes").Scan(&cities)
 	if err != nil {
 		return nil, err
 	}
 	stats["total_cities"] = cities
 
+	// Total counties; names repeat across states, so count state/county pairs
+	var counties int
+	err = db.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM (SELECT DISTINCT state, county FROM zipcodes WHERE county != '')").Scan(&counties)
+	if err != nil {
+		return nil, err
+	}
+	stats["total_counties"] = counties
+
+	if len(db.states) > 0 {
+		stats["loaded_states"] = db.states
+	}
+	stats["dataset_version"] = db.DatasetVersion()
+
 	return stats, nil
 }
 
-// scanZipcodes is a helper to scan multiple zipcode rows
+// StateSummary is an aggregate overview of one state
+type StateSummary struct {
+	State        string       `json:"state"`
+	ZipcodeCount int          `json:"zipcode_count"`
+	CityCount    int          `json:"city_count"`
+	LargestCity  CityZipCount `json:"largest_city"`
+}
+
+// CityZipCount is a city and how many zipcodes it has
+type CityZipCount struct {
+	City         string `json:"city"`
+	ZipcodeCount int    `json:"zipcode_count"`
+}
+
+// GetStateSummary counts a state's zipcodes and cities and finds the city with
+// the most zipcodes (ties go to the alphabetically first city). Cities are
+// counted by normalized name. Returns nil when the state has no zipcodes.
+func (db *DB) GetStateSummary(ctx context.Context, state string, opts QueryOptions) (*StateSummary, error) {
+	summary := &StateSummary{State: strings.ToUpper(strings.TrimSpace(state))}
+
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT city_normalized)
+		FROM zipcodes WHERE `+opts.filter("UPPER(state) = ?"),
+		summary.State).Scan(&summary.ZipcodeCount, &summary.CityCount)
+	if err != nil {
+		return nil, err
+	}
+	if summary.ZipcodeCount == 0 {
+		return nil, nil
+	}
+
+	err = db.conn.QueryRowContext(ctx, `
+		SELECT MIN(city), COUNT(*) AS zipcodes
+		FROM zipcodes WHERE `+opts.filter("UPPER(state) = ?")+`
+		GROUP BY city_normalized
+		ORDER BY zipcodes DESC, city_normalized
+		LIMIT 1
+	`, summary.State).Scan(&summary.LargestCity.City, &summary.LargestCity.ZipcodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// scanZipcodes is a helper to scan multiple zipcode rows. No rows gives an
+// empty, non-nil slice so list responses encode "data": [] rather than null.
 func (db *DB) scanZipcodes(rows *sql.Rows) ([]Zipcode, error) {
-	var zipcodes []Zipcode
+	zipcodes := []Zipcode{}
 	for rows.Next() {
-		var zc Zipcode
-		if err := rows.Scan(&zc.State, &zc.City, &zc.County, &zc.ZipCode, &zc.Latitude, &zc.Longitude); err != nil {
+		zc, err := scanZipcode(rows)
+		if err != nil {
 			return nil, err
 		}
 		zipcodes = append(zipcodes, zc)
@@ -282,6 +1103,13 @@ func (db *DB) scanZipcodes(rows *sql.Rows) ([]Zipcode, error) {
 	return zipcodes, rows.Err()
 }
 
+// scanZipcode scans the current row selected with zipcodeColumns
+func scanZipcode(rows *sql.Rows) (Zipcode, error) {
+	var zc Zipcode
+	err := rows.Scan(&zc.State, &zc.City, &zc.County, &zc.ZipCode, &zc.Latitude, &zc.Longitude, &zc.Geohash, &zc.FIPS, &zc.Timezone)
+	return zc, err
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.conn.Close()
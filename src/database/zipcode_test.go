@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestDB opens a fresh database in a temp directory
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Initialize(filepath.Join(t.TempDir(), "zipcodes.db"))
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// allZipcodes returns every record in zip code order
+func allZipcodes(t *testing.T, db *DB) []Zipcode {
+	t.Helper()
+	var all []Zipcode
+	err := db.StreamAll(context.Background(), "", QueryOptions{}, func(zc *Zipcode) error {
+		all = append(all, *zc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamAll: %v", err)
+	}
+	return all
+}
+
+func TestLoadFromJSONFailureKeepsCurrentData(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.LoadFromJSON([]byte(`[
+		{"state": "MA", "city": "Agawam", "county": "Hampden", "zip_code": 1001, "latitude": "42.0702", "longitude": "-72.6227"},
+		{"state": "NY", "city": "Holtsville", "county": "Suffolk", "zip_code": 501, "latitude": "40.8154", "longitude": "-73.0451"}
+	]`)); err != nil {
+		t.Fatalf("first load: %v", err)
+	}
+	version := db.DatasetVersion()
+	before := allZipcodes(t, db)
+
+	// The repeated zip code breaks the UNIQUE constraint partway through the
+	// insert, after the first records are already in the shadow table
+	err := db.LoadFromJSON([]byte(`[
+		{"state": "MA", "city": "Boston", "zip_code": 2101},
+		{"state": "MA", "city": "Boston", "zip_code": 2108},
+		{"state": "MA", "city": "Boston", "zip_code": 2101}
+	]`))
+	if err == nil || !strings.Contains(err.Error(), "index 2") {
+		t.Fatalf("second load error = %v, want an insert failure at index 2", err)
+	}
+
+	count, err := db.Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(before) {
+		t.Errorf("count after failed load = %d, want %d", count, len(before))
+	}
+	if after := allZipcodes(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("records changed by failed load:\n got %+v\nwant %+v", after, before)
+	}
+	if got := db.DatasetVersion(); got != version {
+		t.Errorf("dataset version = %q after failed load, want %q", got, version)
+	}
+}
+
+func TestZipcodesTableMatchesShadowTable(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.LoadFromJSON([]byte(`[{"state": "MA", "city": "Boston", "zip_code": 2101}]`)); err != nil {
+		t.Fatal(err)
+	}
+	fresh := newTestDB(t)
+
+	// A database created from scratch and one whose table came from a load
+	// must end up with the same columns
+	if got, want := tableColumns(t, fresh), tableColumns(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("created columns %v, loaded columns %v", got, want)
+	}
+}
+
+// tableColumns lists the zipcodes table's column names in order
+func tableColumns(t *testing.T, db *DB) []string {
+	t.Helper()
+	rows, err := db.conn.Query("SELECT name FROM pragma_table_info('zipcodes') ORDER BY cid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestPadZipCodesJSON(t *testing.T) {
+	data := []byte(`[
+		{"state": "MA", "city": "Agawam", "county": "Hampden", "zip_code": 1001, "latitude": "42.0702", "longitude": "-72.6227"},
+		{"state": "NY", "city": "Holtsville", "county": "Suffolk", "zip_code": 501, "latitude": "", "longitude": ""},
+		{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": "02101", "latitude": 42.3706, "longitude": -71.027, "timezone": "America/New_York"}
+	]`)
+
+	var got []map[string]interface{}
+	if err := json.Unmarshal(PadZipCodesJSON(data), &got); err != nil {
+		t.Fatalf("padded JSON doesn't parse: %v", err)
+	}
+
+	want := []map[string]interface{}{
+		{"state": "MA", "city": "Agawam", "county": "Hampden", "zip_code": "01001", "latitude": "42.0702", "longitude": "-72.6227"},
+		{"state": "NY", "city": "Holtsville", "county": "Suffolk", "zip_code": "00501", "latitude": "", "longitude": ""},
+		{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": "02101", "latitude": 42.3706, "longitude": -71.027, "timezone": "America/New_York"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PadZipCodesJSON:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestPadZipCodesJSONLeavesInvalidData(t *testing.T) {
+	data := []byte(`{"zip_code": 501`)
+	if got := PadZipCodesJSON(data); string(got) != string(data) {
+		t.Errorf("PadZipCodesJSON(%s) = %s, want it unchanged", data, got)
+	}
+}
+
+func TestInChunks(t *testing.T) {
+	for _, n := range []int{0, 1, maxInVariables - 1, maxInVariables, maxInVariables + 1, 2*maxInVariables + 1} {
+		values := make([]int, n)
+		chunks := inChunks(values)
+
+		total := 0
+		for _, chunk := range chunks {
+			if len(chunk) > maxInVariables {
+				t.Errorf("n=%d: chunk of %d, over the %d cap", n, len(chunk), maxInVariables)
+			}
+			total += len(chunk)
+		}
+		if total != n {
+			t.Errorf("n=%d: chunks hold %d values", n, total)
+		}
+		if want := max(1, (n+maxInVariables-1)/maxInVariables); len(chunks) != want {
+			t.Errorf("n=%d: %d chunks, want %d", n, len(chunks), want)
+		}
+	}
+}
+
+func TestSearchByZipCodesAtChunkBoundaries(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.LoadFromJSON([]byte(`[
+		{"state": "NY", "city": "Holtsville", "zip_code": 501},
+		{"state": "MA", "city": "Agawam", "zip_code": 1001},
+		{"state": "MA", "city": "Boston", "zip_code": 2101}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Well past SQLite's 999-variable default, with the existing codes last
+	// so they land in the final chunk
+	for _, n := range []int{maxInVariables, maxInVariables + 1, 1000, 2500} {
+		codes := make([]string, 0, n)
+		for code := 90000; len(codes) < n-3; code++ {
+			codes = append(codes, FormatZipCode(code))
+		}
+		codes = append(codes, "02101", "00501", "01001")
+
+		results, err := db.SearchByZipCodes(context.Background(), codes)
+		if err != nil {
+			t.Fatalf("%d codes: %v", n, err)
+		}
+		var got []string
+		for _, zc := range results {
+			got = append(got, zc.ZipCode)
+		}
+		if want := []string{"00501", "01001", "02101"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d codes: found %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestSearchByCitiesAtChunkBoundaries(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.LoadFromJSON([]byte(`[
+		{"state": "MA", "city": "Agawam", "zip_code": 1001},
+		{"state": "MA", "city": "Boston", "zip_code": 2101}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{maxInVariables, maxInVariables + 1, 1000} {
+		cities := make([]string, 0, n)
+		for i := 0; len(cities) < n-2; i++ {
+			cities = append(cities, fmt.Sprintf("Nowhere %d", i))
+		}
+		cities = append(cities, "Boston", "Agawam")
+
+		// The state is one more variable on top of each chunk
+		results, err := db.SearchByCities(context.Background(), "MA", cities, QueryOptions{})
+		if err != nil {
+			t.Fatalf("%d cities: %v", n, err)
+		}
+		if len(results) != 2 {
+			t.Errorf("%d cities: %d results, want 2", n, len(results))
+		}
+	}
+}
+
+func TestMigrateIntegerZipCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zipcodes.db")
+
+	// The schema before zip_code was stored as zero-padded text
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`
+		CREATE TABLE zipcodes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			state TEXT NOT NULL,
+			city TEXT NOT NULL,
+			county TEXT,
+			zip_code INTEGER NOT NULL UNIQUE,
+			latitude TEXT,
+			longitude TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE zip_area_codes (
+			area_code TEXT NOT NULL,
+			zip_code INTEGER NOT NULL,
+			PRIMARY KEY (area_code, zip_code)
+		);
+		INSERT INTO zipcodes (state, city, county, zip_code, latitude, longitude) VALUES
+			('NY', 'Holtsville', 'Suffolk', 501, '40.8154', '-73.0451'),
+			('MA', 'Agawam', 'Hampden', 1001, '42.0702', '-72.6227');
+		INSERT INTO zip_area_codes (area_code, zip_code) VALUES ('631', 501);
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Initialize(path)
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer db.Close()
+
+	for _, table := range []string{"zipcodes", "zip_area_codes"} {
+		var columnType string
+		if err := db.conn.QueryRow("SELECT type FROM pragma_table_info('" + table + "') WHERE name = 'zip_code'").Scan(&columnType); err != nil {
+			t.Fatal(err)
+		}
+		if columnType != "TEXT" {
+			t.Errorf("%s.zip_code is %s, want TEXT", table, columnType)
+		}
+	}
+
+	zc, err := db.SearchByZipCode(context.Background(), "00501")
+	if err != nil || zc == nil {
+		t.Fatalf("SearchByZipCode(00501) = %v, %v", zc, err)
+	}
+	if zc.ZipCode != "00501" || zc.Geohash == "" {
+		t.Errorf("migrated record = %+v, want zip_code 00501 with its geohash backfilled", zc)
+	}
+
+	found, err := db.SearchByAreaCode(context.Background(), "631", QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ZipCode != "00501" {
+		t.Errorf("SearchByAreaCode(631) = %+v, want 00501", found)
+	}
+}
@@ -0,0 +1,168 @@
+package geoip
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// maxSamplePrefixes limits how many prefixes are kept per ASN in the index
+const maxSamplePrefixes = 10
+
+// ASNInfo describes an autonomous system from the reverse index
+type ASNInfo struct {
+	ASN            uint     `json:"asn"`
+	Org            string   `json:"org"`
+	NetworkCount   int      `json:"network_count"`
+	SamplePrefixes []string `json:"sample_prefixes"`
+}
+
+// asnEntry accumulates index data for one ASN while scanning
+type asnEntry struct {
+	info      ASNInfo
+	orgCounts map[string]int // normalized org -> occurrences
+}
+
+var (
+	asnIndex   map[uint]*ASNInfo
+	asnIndexMu sync.RWMutex
+)
+
+// normalizeASNOrg collapses runs of whitespace and trims an ASN org name
+func normalizeASNOrg(org string) string {
+	return strings.Join(strings.Fields(org), " ")
+}
+
+// canonicalASNOrg normalizes an org name from a lookup and, when it matches
+// the indexed org of its ASN ignoring case, returns the indexed spelling, so
+// "GOOGLE LLC" and "Google LLC" networks report the same name
+func canonicalASNOrg(number uint, org string) string {
+	org = normalizeASNOrg(org)
+
+	asnIndexMu.RLock()
+	info := asnIndex[number]
+	asnIndexMu.RUnlock()
+
+	if info != nil && strings.EqualFold(info.Org, org) {
+		return info.Org
+	}
+	return org
+}
+
+// buildASNIndex scans every network in the ASN database and builds an
+// ASN -> org/prefixes index, since mmdb files are keyed by IP not ASN
+func buildASNIndex(path string) error {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open ASN database: %w", err)
+	}
+	defer reader.Close()
+
+	var record struct {
+		Number uint   `maxminddb:"autonomous_system_number"`
+		Org    string `maxminddb:"autonomous_system_organization"`
+	}
+
+	entries := make(map[uint]*asnEntry)
+	networks := reader.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		subnet, err := networks.Network(&record)
+		if err != nil {
+			return fmt.Errorf("failed to read ASN network: %w", err)
+		}
+		if record.Number == 0 {
+			continue
+		}
+
+		entry, ok := entries[record.Number]
+		if !ok {
+			entry = &asnEntry{
+				info:      ASNInfo{ASN: record.Number},
+				orgCounts: make(map[string]int),
+			}
+			entries[record.Number] = entry
+		}
+
+		entry.info.NetworkCount++
+		if len(entry.info.SamplePrefixes) < maxSamplePrefixes {
+			entry.info.SamplePrefixes = append(entry.info.SamplePrefixes, subnet.String())
+		}
+
+		if org := normalizeASNOrg(record.Org); org != "" {
+			entry.orgCounts[org]++
+		}
+	}
+	if err := networks.Err(); err != nil {
+		return fmt.Errorf("failed to scan ASN database: %w", err)
+	}
+
+	index := make(map[uint]*ASNInfo, len(entries))
+	for number, entry := range entries {
+		entry.info.Org = representativeOrg(entry.orgCounts)
+		info := entry.info
+		index[number] = &info
+	}
+
+	asnIndexMu.Lock()
+	asnIndex = index
+	asnIndexMu.Unlock()
+
+	log.Printf("Built ASN index with %d autonomous systems", len(index))
+	return nil
+}
+
+// representativeOrg picks the most common org name for an ASN
+// Names are grouped case-insensitively ("Google LLC" vs "GOOGLE LLC") and the
+// most frequent spelling within the winning group is returned
+func representativeOrg(counts map[string]int) string {
+	groups := make(map[string]int)
+	for org, count := range counts {
+		groups[strings.ToLower(org)] += count
+	}
+
+	bestGroup := ""
+	for group, count := range groups {
+		if bestGroup == "" || count > groups[bestGroup] || (count == groups[bestGroup] && group < bestGroup) {
+			bestGroup = group
+		}
+	}
+
+	best := ""
+	for org, count := range counts {
+		if strings.ToLower(org) != bestGroup {
+			continue
+		}
+		if best == "" || count > counts[best] || (count == counts[best] && org < best) {
+			best = org
+		}
+	}
+
+	return best
+}
+
+// rebuildASNIndex rebuilds the ASN index in the background
+func rebuildASNIndex(path string) {
+	if path == "" {
+		return
+	}
+	go func() {
+		if err := buildASNIndex(path); err != nil {
+			log.Printf("Failed to build ASN index: %v", err)
+		}
+	}()
+}
+
+// LookupASN returns information about an ASN from the reverse index
+func LookupASN(number uint) (*ASNInfo, error) {
+	asnIndexMu.RLock()
+	defer asnIndexMu.RUnlock()
+
+	if asnIndex == nil {
+		return nil, fmt.Errorf("ASN index not available")
+	}
+
+	return asnIndex[number], nil
+}
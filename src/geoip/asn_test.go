@@ -0,0 +1,47 @@
+package geoip
+
+import "testing"
+
+func TestRepresentativeOrgIgnoresCase(t *testing.T) {
+	counts := map[string]int{
+		"GOOGLE LLC":  2,
+		"Google LLC":  3,
+		"google llc":  1,
+		"Example Inc": 4,
+	}
+	// The Google spellings together outnumber Example Inc
+	if got := representativeOrg(counts); got != "Google LLC" {
+		t.Errorf("representativeOrg = %q, want Google LLC", got)
+	}
+}
+
+func TestCanonicalASNOrg(t *testing.T) {
+	asnIndexMu.Lock()
+	old := asnIndex
+	asnIndex = map[uint]*ASNInfo{15169: {ASN: 15169, Org: "Google LLC"}}
+	asnIndexMu.Unlock()
+	t.Cleanup(func() {
+		asnIndexMu.Lock()
+		asnIndex = old
+		asnIndexMu.Unlock()
+	})
+
+	tests := []struct {
+		number uint
+		org    string
+		want   string
+	}{
+		{15169, "GOOGLE LLC", "Google LLC"},
+		{15169, "  google   llc ", "Google LLC"},
+		{15169, "Google LLC", "Google LLC"},
+		// A different name for the ASN is kept, only normalized
+		{15169, "GOOGLE  CLOUD", "GOOGLE CLOUD"},
+		// ASNs missing from the index are only normalized
+		{64512, " Private\tNetwork ", "Private Network"},
+	}
+	for _, tt := range tests {
+		if got := canonicalASNOrg(tt.number, tt.org); got != tt.want {
+			t.Errorf("canonicalASNOrg(%d, %q) = %q, want %q", tt.number, tt.org, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package geoip
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -28,6 +29,12 @@ type DatabaseFiles struct {
 
 // DownloadDatabases downloads the latest GeoIP databases from sapics/ip-location-db via jsdelivr CDN
 func DownloadDatabases(dataDir string) (*DatabaseFiles, error) {
+	return DownloadDatabasesContext(context.Background(), dataDir)
+}
+
+// DownloadDatabasesContext downloads the databases, aborting if ctx is cancelled
+// Existing files are only replaced once a download completes
+func DownloadDatabasesContext(ctx context.Context, dataDir string) (*DatabaseFiles, error) {
 	// Create data directory if it doesn't exist
 	geoipDir := filepath.Join(dataDir, "geoip")
 	if err := os.MkdirAll(geoipDir, 0755); err != nil {
@@ -52,21 +59,33 @@ func DownloadDatabases(dataDir string) (*DatabaseFiles, error) {
 	for dbPath, url := range databases {
 		filename := filepath.Base(dbPath)
 		fmt.Printf("Downloading %s...\n", filename)
-		if err := downloadFile(url, dbPath); err != nil {
+		if err := downloadFile(ctx, url, dbPath); err != nil {
 			return nil, fmt.Errorf("failed to download %s: %w", filename, err)
 		}
 		fmt.Printf("Downloaded: %s\n", filename)
 	}
 
+	// The files are in place; a missing version record only loses updated_at
+	if err := saveVersionFile(dataDir); err != nil {
+		fmt.Printf("Warning: failed to record GeoIP database version: %v\n", err)
+	}
+
 	return dbFiles, nil
 }
 
 // downloadFile downloads a file from a URL and saves it to the specified path
-func downloadFile(url, filepath string) error {
+// The data is written to a temporary file first so an interrupted download
+// never leaves a truncated database in place
+func downloadFile(ctx context.Context, url, filepath string) error {
 	client := &http.Client{Timeout: defaultTimeout}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
 	// Download file
-	resp, err := client.Get(url)
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -76,27 +95,46 @@ func downloadFile(url, filepath string) error {
 		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
 	}
 
-	// Create output file
-	outFile, err := os.Create(filepath)
+	// Create temporary output file
+	tmpPath := filepath + ".tmp"
+	outFile, err := os.Create(tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer outFile.Close()
 
 	// Copy data
 	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		outFile.Close()
+		os.Remove(tmpPath)
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+	if err := outFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
 
 	return nil
 }
 
-// CheckForUpdates checks if there are newer databases available
-// Note: sapics databases are updated daily via jsdelivr CDN
-func CheckForUpdates(currentVersion string) (bool, string, error) {
-	// sapics databases are updated daily, so we can't easily check versions
-	// Return false for now - caller should update based on time intervals
-	return false, currentVersion, nil
+// CheckForUpdates reports whether the databases in dataDir are missing or
+// were built more than maxAge ago, judged by the oldest file's mmdb build
+// epoch, and returns that build date as the current version.
+// Note: sapics databases are rebuilt daily and the CDN publishes no version
+// to compare against, so staleness is the only signal.
+func CheckForUpdates(dataDir string, maxAge time.Duration) (bool, string, error) {
+	built, ok, err := filesBuildDate(dataDir)
+	if err != nil {
+		return false, "", err
+	}
+	if !ok {
+		return true, "", nil
+	}
+	return time.Since(built) > maxAge, built.Format(versionLayout), nil
 }
 
 // GetDatabasePaths returns the paths to the database files
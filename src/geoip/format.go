@@ -0,0 +1,190 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/utils"
+)
+
+// Formatter renders lookup results in one output format
+type Formatter interface {
+	// ContentType is the response Content-Type
+	ContentType() string
+	// Format writes a single lookup result
+	Format(loc *Location, w io.Writer) error
+	// FormatList writes the results of a batch lookup
+	FormatList(locs []*Location, w io.Writer) error
+}
+
+// formatters is the registry used by the handlers, keyed by ?format= name
+var formatters = map[string]Formatter{
+	"json": jsonFormatter{},
+	"text": textFormatter{},
+	"csv":  csvFormatter{},
+}
+
+// RegisterFormatter adds or replaces the formatter for a ?format= name
+// Call during startup, before the server handles requests.
+func RegisterFormatter(name string, f Formatter) {
+	formatters[strings.ToLower(name)] = f
+}
+
+// FormatterFor returns the formatter registered under name
+func FormatterFor(name string) (Formatter, bool) {
+	f, ok := formatters[strings.ToLower(strings.TrimSpace(name))]
+	return f, ok
+}
+
+// FormatNames lists the registered format names, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// locationField is one exported Location field, named by its json tag
+type locationField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// locationFields lists Location's fields in declaration order, so every
+// format picks up new fields without changes here
+var locationFields = func() []locationField {
+	t := reflect.TypeOf(Location{})
+	fields := make([]locationField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, locationField{name: name, index: i, omitEmpty: opts == "omitempty"})
+	}
+	return fields
+}()
+
+// value renders the field of loc as a string, "" for omitted zero values
+func (f locationField) value(loc *Location) string {
+	v := reflect.ValueOf(loc).Elem().Field(f.index)
+	if f.omitEmpty && v.IsZero() {
+		return ""
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// jsonFormatter writes a bare Location, and the batch envelope for lists
+type jsonFormatter struct{}
+
+func (jsonFormatter) ContentType() string { return "application/json" }
+
+func (jsonFormatter) Format(loc *Location, w io.Writer) error {
+	return json.NewEncoder(w).Encode(loc)
+}
+
+func (jsonFormatter) FormatList(locs []*Location, w io.Writer) error {
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"count":   len(locs),
+		"results": locs,
+	})
+}
+
+// textFormatter writes "Label: value" lines, one block per location
+type textFormatter struct{}
+
+func (textFormatter) ContentType() string { return "text/plain; charset=utf-8" }
+
+func (textFormatter) Format(loc *Location, w io.Writer) error {
+	_, err := io.WriteString(w, formatTextResponse(loc))
+	return err
+}
+
+func (f textFormatter) FormatList(locs []*Location, w io.Writer) error {
+	for i, loc := range locs {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := f.Format(loc, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvFormatter writes a header row of json field names and one row per location
+type csvFormatter struct{}
+
+func (csvFormatter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (f csvFormatter) Format(loc *Location, w io.Writer) error {
+	return f.FormatList([]*Location{loc}, w)
+}
+
+func (csvFormatter) FormatList(locs []*Location, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	row := make([]string, len(locationFields))
+	for i, field := range locationFields {
+		row[i] = field.name
+	}
+	cw.Write(row)
+	for _, loc := range locs {
+		for i, field := range locationFields {
+			row[i] = field.value(loc)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// textLabel turns a json field name into a text label ("asn_org" -> "Asn Org")
+func textLabel(name string) string {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// textLayoutFields are the fields formatTextResponse lays out by hand; any
+// other Location field is appended generically
+var textLayoutFields = map[string]bool{
+	"ip": true, "country": true, "country_code": true, "city": true,
+	"latitude": true, "longitude": true, "timezone": true, "asn": true, "asn_org": true,
+}
+
+// writeExtraTextFields appends the fields without a hand-made text layout
+func writeExtraTextFields(sb *strings.Builder, loc *Location) {
+	for _, field := range locationFields {
+		if textLayoutFields[field.name] {
+			continue
+		}
+		if value := field.value(loc); value != "" {
+			sb.WriteString(textLabel(field.name) + ": " + utils.SanitizeText(value) + "\n")
+		}
+	}
+}
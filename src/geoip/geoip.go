@@ -3,7 +3,9 @@ package geoip
 import (
 	"fmt"
 	"net"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/oschwald/geoip2-golang"
 )
@@ -14,6 +16,7 @@ type GeoIP struct {
 	cityIPv6DB *geoip2.Reader // City database for IPv6 addresses
 	countryDB  *geoip2.Reader // Country database (combined IPv4/IPv6)
 	asnDB      *geoip2.Reader // ASN database (combined IPv4/IPv6)
+	dir        string         // Directory the databases were loaded from
 	mu         sync.RWMutex
 }
 
@@ -28,6 +31,9 @@ type Location struct {
 	Timezone    string  `json:"timezone"`
 	ASN         uint    `json:"asn,omitempty"`
 	ASNOrg      string  `json:"asn_org,omitempty"`
+	// Error is set instead of the location fields when one item of a batch
+	// lookup fails, e.g. for an invalid IP
+	Error string `json:"error,omitempty"`
 }
 
 var (
@@ -39,7 +45,7 @@ var (
 func Initialize(cityIPv4DBPath, cityIPv6DBPath, countryDBPath, asnDBPath string) error {
 	var err error
 	once.Do(func() {
-		instance = &GeoIP{}
+		instance = &GeoIP{dir: databaseDir(cityIPv4DBPath, cityIPv6DBPath, countryDBPath, asnDBPath)}
 
 		// Load City IPv4 database
 		if cityIPv4DBPath != "" {
@@ -75,17 +81,69 @@ func Initialize(cityIPv4DBPath, cityIPv6DBPath, countryDBPath, asnDBPath string)
 				err = fmt.Errorf("failed to open ASN database: %w", err)
 				return
 			}
+			rebuildASNIndex(asnDBPath)
 		}
 	})
 
 	return err
 }
 
+// databaseDir returns the directory of the first non-empty database path
+func databaseDir(paths ...string) string {
+	for _, path := range paths {
+		if path != "" {
+			return filepath.Dir(path)
+		}
+	}
+	return ""
+}
+
 // GetInstance returns the GeoIP singleton instance
 func GetInstance() *GeoIP {
 	return instance
 }
 
+// DatabaseStatus describes one GeoIP database reader
+type DatabaseStatus struct {
+	Name      string     `json:"name"`
+	Loaded    bool       `json:"loaded"`
+	BuildDate *time.Time `json:"build_date,omitempty"`
+	AgeDays   *int       `json:"age_days,omitempty"`
+}
+
+// Databases reports which databases are loaded and when each was built
+func (g *GeoIP) Databases() []DatabaseStatus {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	readers := []struct {
+		name   string
+		reader *geoip2.Reader
+	}{
+		{"city_ipv4", g.cityIPv4DB},
+		{"city_ipv6", g.cityIPv6DB},
+		{"country", g.countryDB},
+		{"asn", g.asnDB},
+	}
+
+	statuses := make([]DatabaseStatus, 0, len(readers))
+	for _, r := range readers {
+		status := DatabaseStatus{Name: r.name, Loaded: r.reader != nil}
+		if r.reader != nil {
+			built := time.Unix(int64(r.reader.Metadata().BuildEpoch), 0).UTC()
+			status.BuildDate = &built
+			age := int(time.Since(built).Hours() / 24)
+			status.AgeDays = &age
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
 // Lookup performs a GeoIP lookup for the given IP address
 func (g *GeoIP) Lookup(ip string) (*Location, error) {
 	if g == nil {
@@ -139,7 +197,7 @@ func (g *GeoIP) Lookup(ip string) (*Location, error) {
 		record, err := g.asnDB.ASN(parsedIP)
 		if err == nil {
 			location.ASN = record.AutonomousSystemNumber
-			location.ASNOrg = record.AutonomousSystemOrganization
+			location.ASNOrg = canonicalASNOrg(record.AutonomousSystemNumber, record.AutonomousSystemOrganization)
 		}
 	}
 
@@ -147,54 +205,53 @@ func (g *GeoIP) Lookup(ip string) (*Location, error) {
 }
 
 // Reload reloads the GeoIP databases (for updates)
+// The new files are all opened before any reader is replaced, so a missing or
+// corrupt file leaves the loaded databases in service and returns an error.
 func (g *GeoIP) Reload(cityIPv4DBPath, cityIPv6DBPath, countryDBPath, asnDBPath string) error {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-
-	// Close existing databases
-	if g.cityIPv4DB != nil {
-		g.cityIPv4DB.Close()
-	}
-	if g.cityIPv6DB != nil {
-		g.cityIPv6DB.Close()
-	}
-	if g.countryDB != nil {
-		g.countryDB.Close()
-	}
-	if g.asnDB != nil {
-		g.asnDB.Close()
+	files := []struct {
+		name   string
+		path   string
+		reader *geoip2.Reader
+	}{
+		{"city IPv4", cityIPv4DBPath, nil},
+		{"city IPv6", cityIPv6DBPath, nil},
+		{"country", countryDBPath, nil},
+		{"ASN", asnDBPath, nil},
 	}
 
-	// Reload databases
-	var err error
-	if cityIPv4DBPath != "" {
-		g.cityIPv4DB, err = geoip2.Open(cityIPv4DBPath)
-		if err != nil {
-			return fmt.Errorf("failed to reload city IPv4 database: %w", err)
+	for i := range files {
+		if files[i].path == "" {
+			continue
 		}
-	}
-
-	if cityIPv6DBPath != "" {
-		g.cityIPv6DB, err = geoip2.Open(cityIPv6DBPath)
+		reader, err := geoip2.Open(files[i].path)
 		if err != nil {
-			return fmt.Errorf("failed to reload city IPv6 database: %w", err)
-		}
-	}
-
-	if countryDBPath != "" {
-		g.countryDB, err = geoip2.Open(countryDBPath)
-		if err != nil {
-			return fmt.Errorf("failed to reload country database: %w", err)
+			for _, opened := range files[:i] {
+				if opened.reader != nil {
+					opened.reader.Close()
+				}
+			}
+			return fmt.Errorf("failed to reload %s database: %w", files[i].name, err)
 		}
+		files[i].reader = reader
 	}
 
-	if asnDBPath != "" {
-		g.asnDB, err = geoip2.Open(asnDBPath)
-		if err != nil {
-			return fmt.Errorf("failed to reload ASN database: %w", err)
+	g.mu.Lock()
+	old := []*geoip2.Reader{g.cityIPv4DB, g.cityIPv6DB, g.countryDB, g.asnDB}
+	g.cityIPv4DB = files[0].reader
+	g.cityIPv6DB = files[1].reader
+	g.countryDB = files[2].reader
+	g.asnDB = files[3].reader
+	g.dir = databaseDir(cityIPv4DBPath, cityIPv6DBPath, countryDBPath, asnDBPath)
+	g.mu.Unlock()
+
+	// Lookups hold the read lock, so none are using the old readers now
+	for _, reader := range old {
+		if reader != nil {
+			reader.Close()
 		}
 	}
 
+	rebuildASNIndex(asnDBPath)
 	return nil
 }
 
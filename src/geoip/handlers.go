@@ -2,51 +2,76 @@ package geoip
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/apimgr/zipcodes/src/utils"
+	"github.com/go-chi/chi/v5"
 )
 
 // LookupHandler handles GeoIP lookup requests
+// The response is JSON unless ?format= names another registered format
 func LookupHandler(w http.ResponseWriter, r *http.Request) {
-	// Get IP from query parameter or use client IP
-	ip := r.URL.Query().Get("ip")
-	if ip == "" {
-		ip = getClientIP(r)
-	}
-
-	// Perform lookup
-	location, err := LookupIP(ip)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(location)
+	lookup(w, r, "json")
 }
 
 // LookupTextHandler handles GeoIP lookup requests with plain text response
 func LookupTextHandler(w http.ResponseWriter, r *http.Request) {
+	lookup(w, r, "text")
+}
+
+// lookup serves a single lookup in ?format=, or defaultFormat when absent
+func lookup(w http.ResponseWriter, r *http.Request, defaultFormat string) {
+	formatter, ok := requestFormatter(w, r, defaultFormat)
+	if !ok {
+		return
+	}
+
 	// Get IP from query parameter or use client IP
 	ip := r.URL.Query().Get("ip")
 	if ip == "" {
-		ip = getClientIP(r)
+		ip = utils.ClientIP(r)
 	}
 
 	// Perform lookup
 	location, err := LookupIP(ip)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		history.Record(database.LookupGeoIP, ip, false, "")
+		// The error echoes the ip parameter, so escape it like the fields
+		http.Error(w, utils.SanitizeText(err.Error()), http.StatusInternalServerError)
 		return
 	}
+	history.Record(database.LookupGeoIP, ip, location.CountryCode != "", location.CountryCode)
+
+	w.Header().Set("Content-Type", formatter.ContentType())
+	formatter.Format(location, w)
+}
 
-	// Return text response
-	w.Header().Set("Content-Type", "text/plain")
-	response := formatTextResponse(location)
-	w.Write([]byte(response))
+// requestFormatter resolves ?format= (defaultFormat when absent) to a
+// registered formatter, writing a 400 for unknown names
+func requestFormatter(w http.ResponseWriter, r *http.Request, defaultFormat string) (Formatter, bool) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = defaultFormat
+	}
+	formatter, ok := FormatterFor(name)
+	if !ok {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error": map[string]string{
+				"code":    "INVALID_PARAMETER",
+				"message": "format must be one of: " + strings.Join(FormatNames(), ", "),
+			},
+		})
+	}
+	return formatter, ok
 }
 
 // BatchLookupHandler handles batch GeoIP lookups
@@ -56,85 +81,198 @@ func BatchLookupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var request struct {
-		IPs []string `json:"ips"`
+	formatter, ok := requestFormatter(w, r, "json")
+	if !ok {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	ips, code, message := decodeBatchRequest(r)
+	if code != "" {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": code, "message": message},
+		})
 		return
 	}
 
 	// Limit batch size
-	if len(request.IPs) > 100 {
-		http.Error(w, "Maximum 100 IPs per request", http.StatusBadRequest)
+	if limit := settings.MaxBatchSize(); len(ips) > limit {
+		respondJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":           "BATCH_TOO_LARGE",
+				"message":        "maximum " + strconv.Itoa(limit) + " IPs per request",
+				"max_batch_size": limit,
+			},
+		})
 		return
 	}
 
-	// Perform lookups
-	results := make([]*Location, 0, len(request.IPs))
-	for _, ip := range request.IPs {
-		location, err := LookupIP(ip)
-		if err != nil {
-			// Include error in response but continue
-			results = append(results, &Location{
-				IP:      ip,
-				Country: "Error: " + err.Error(),
-			})
-			continue
-		}
-		results = append(results, location)
+	results := lookupBatch(ips)
+
+	w.Header().Set("Content-Type", formatter.ContentType())
+	formatter.FormatList(results, w)
+}
+
+// batchWorkers bounds the goroutines serving one batch lookup
+const batchWorkers = 8
+
+// lookupBatch looks up ips on up to batchWorkers goroutines, returning the
+// results in input order. A bad item gets its own error and the rest still
+// run; an address missing from the databases is not an error, it just comes
+// back with empty fields.
+func lookupBatch(ips []string) []*Location {
+	results := make([]*Location, len(ips))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(ips)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = lookupBatchItem(strings.TrimSpace(ips[i]))
+			}
+		}()
+	}
+	for i := range ips {
+		indexes <- i
 	}
+	close(indexes)
+	wg.Wait()
 
-	// Return JSON response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"count":   len(results),
-		"results": results,
-	})
+	return results
+}
+
+// lookupBatchItem looks up one batch entry
+func lookupBatchItem(ip string) *Location {
+	if net.ParseIP(ip) == nil {
+		return &Location{IP: ip, Error: "invalid IP address"}
+	}
+	location, err := LookupIP(ip)
+	if err != nil {
+		return &Location{IP: ip, Error: err.Error()}
+	}
+	return location
 }
 
-// getClientIP extracts the real client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
+// batchRequestExample is shown in batch body errors
+const batchRequestExample = `expected {"ips": ["8.8.8.8", "2001:4860:4860::8888"]}`
+
+// decodeBatchRequest reads the {"ips": [...]} body of a batch lookup. On
+// failure it returns an error code and a message telling malformed JSON
+// (INVALID_JSON) apart from valid JSON of the wrong shape (INVALID_BODY).
+func decodeBatchRequest(r *http.Request) (ips []string, code, message string) {
+	var request struct {
+		IPs *[]string `json:"ips"`
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&request)
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		return nil, "INVALID_BODY", "request body is empty; " + batchRequestExample
+	case errors.As(err, &syntaxErr):
+		return nil, "INVALID_JSON", fmt.Sprintf("request body is not valid JSON (at byte %d): %s", syntaxErr.Offset, syntaxErr.Error())
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, "INVALID_JSON", "request body is not valid JSON: unexpected end of input"
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return nil, "INVALID_BODY", "request body must be a JSON object; " + batchRequestExample
 		}
+		return nil, "INVALID_BODY", "ips must be an array of IP address strings; " + batchRequestExample
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return nil, "INVALID_BODY", "unknown field " + field + "; " + batchRequestExample
+	default:
+		// Errors from reading the body (e.g. BODY_TOO_LARGE is handled upstream)
+		return nil, "INVALID_BODY", "invalid request body: " + err.Error()
 	}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
+	if request.IPs == nil {
+		return nil, "INVALID_BODY", "ips is required; " + batchRequestExample
+	}
+	return *request.IPs, "", ""
+}
+
+// ASNHandler handles GET /api/v1/geoip/asn/{number}
+func ASNHandler(w http.ResponseWriter, r *http.Request) {
+	param := strings.TrimPrefix(strings.ToUpper(chi.URLParam(r, "number")), "AS")
+	number, err := strconv.ParseUint(param, 10, 32)
+	if err != nil || number == 0 {
+		respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "INVALID_FORMAT", "message": "invalid ASN"},
+		})
+		return
 	}
 
-	// Use RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	info, err := LookupASN(uint(number))
 	if err != nil {
-		return r.RemoteAddr
+		respondJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "UNAVAILABLE", "message": err.Error()},
+		})
+		return
+	}
+
+	if info == nil {
+		respondJSON(w, http.StatusNotFound, map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "NOT_FOUND", "message": "ASN not found"},
+		})
+		return
 	}
 
-	return ip
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    info,
+	})
+}
+
+// respondJSON writes a JSON response with the given status
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+var settings *database.Settings
+
+// SetSettings sets the settings cache used by the handlers
+func SetSettings(s *database.Settings) {
+	settings = s
+}
+
+// history records single lookups for the admin history report
+var history *database.LookupHistory
+
+// SetLookupHistory sets where GeoIP lookups are recorded
+func SetLookupHistory(h *database.LookupHistory) {
+	history = h
 }
 
 // formatTextResponse formats a Location as plain text
 func formatTextResponse(loc *Location) string {
 	var sb strings.Builder
 
-	sb.WriteString("IP: " + loc.IP + "\n")
+	sb.WriteString("IP: " + utils.SanitizeText(loc.IP) + "\n")
 
 	if loc.Country != "" {
-		sb.WriteString("Country: " + loc.Country)
+		sb.WriteString("Country: " + utils.SanitizeText(loc.Country))
 		if loc.CountryCode != "" {
-			sb.WriteString(" (" + loc.CountryCode + ")")
+			sb.WriteString(" (" + utils.SanitizeText(loc.CountryCode) + ")")
 		}
 		sb.WriteString("\n")
 	}
 
 	if loc.City != "" {
-		sb.WriteString("City: " + loc.City + "\n")
+		sb.WriteString("City: " + utils.SanitizeText(loc.City) + "\n")
 	}
 
 	if loc.Latitude != 0 || loc.Longitude != 0 {
@@ -146,18 +284,20 @@ func formatTextResponse(loc *Location) string {
 	}
 
 	if loc.Timezone != "" {
-		sb.WriteString("Timezone: " + loc.Timezone + "\n")
+		sb.WriteString("Timezone: " + utils.SanitizeText(loc.Timezone) + "\n")
 	}
 
 	if loc.ASN != 0 {
 		sb.WriteString("ASN: ")
 		sb.WriteString(formatUint(loc.ASN))
 		if loc.ASNOrg != "" {
-			sb.WriteString(" (" + loc.ASNOrg + ")")
+			sb.WriteString(" (" + utils.SanitizeText(loc.ASNOrg) + ")")
 		}
 		sb.WriteString("\n")
 	}
 
+	writeExtraTextFields(&sb, loc)
+
 	return sb.String()
 }
 
@@ -1,15 +1,26 @@
 package geoip
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
+// defaultStopTimeout is how long Stop waits for the update goroutine to exit
+const defaultStopTimeout = 10 * time.Second
+
+// defaultMaxAge is how old the databases may get before a check downloads
+// new ones
+const defaultMaxAge = 7 * 24 * time.Hour
+
 // UpdaterConfig holds configuration for the database updater
 type UpdaterConfig struct {
 	DataDir        string
 	CheckInterval  time.Duration // How often to check for updates
+	MaxAge         time.Duration // Refresh databases built longer ago than this
 	AutoUpdate     bool          // Whether to automatically update
 	OnUpdateFunc   func()        // Callback after successful update
 	OnErrorFunc    func(error)   // Callback on error
@@ -18,7 +29,9 @@ type UpdaterConfig struct {
 // Updater manages automatic GeoIP database updates
 type Updater struct {
 	config  *UpdaterConfig
-	stopCh  chan struct{}
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
 	running bool
 }
 
@@ -27,60 +40,89 @@ func NewUpdater(config *UpdaterConfig) *Updater {
 	if config.CheckInterval == 0 {
 		config.CheckInterval = 24 * time.Hour // Default: check daily
 	}
+	if config.MaxAge == 0 {
+		config.MaxAge = defaultMaxAge
+	}
 
 	return &Updater{
 		config: config,
-		stopCh: make(chan struct{}),
 	}
 }
 
 // Start begins the automatic update checker
 func (u *Updater) Start() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
 	if u.running {
 		return
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
 	u.running = true
-	go u.run()
+	go u.run(ctx, u.done)
 }
 
-// Stop stops the automatic update checker
+// Stop stops the automatic update checker, waiting up to defaultStopTimeout
 func (u *Updater) Stop() {
-	if !u.running {
-		return
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+	defer cancel()
+
+	if err := u.Shutdown(ctx); err != nil {
+		log.Printf("GeoIP updater did not stop cleanly: %v", err)
 	}
+}
 
+// Shutdown cancels any in-flight download and waits for the update goroutine
+// to exit or for ctx to expire
+func (u *Updater) Shutdown(ctx context.Context) error {
+	u.mu.Lock()
+	if !u.running {
+		u.mu.Unlock()
+		return nil
+	}
 	u.running = false
-	close(u.stopCh)
+	u.cancel()
+	done := u.done
+	u.mu.Unlock()
+
+	select {
+	case <-done:
+		log.Println("GeoIP updater stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for GeoIP updater: %w", ctx.Err())
+	}
 }
 
 // run is the main update loop
-func (u *Updater) run() {
+func (u *Updater) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
 	ticker := time.NewTicker(u.config.CheckInterval)
 	defer ticker.Stop()
 
 	// Check immediately on start
-	u.checkAndUpdate()
+	u.checkAndUpdate(ctx)
 
 	for {
 		select {
 		case <-ticker.C:
-			u.checkAndUpdate()
-		case <-u.stopCh:
+			u.checkAndUpdate(ctx)
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
 // checkAndUpdate checks for updates and downloads if available
-func (u *Updater) checkAndUpdate() {
+func (u *Updater) checkAndUpdate(ctx context.Context) {
 	log.Println("Checking for GeoIP database updates...")
 
-	// Get current version (from file metadata or release tag)
-	currentVersion := u.getCurrentVersion()
-
-	// Check for updates
-	hasUpdate, newVersion, err := CheckForUpdates(currentVersion)
+	// Compare the build date of the files on disk against MaxAge
+	hasUpdate, currentVersion, err := CheckForUpdates(u.config.DataDir, u.config.MaxAge)
 	if err != nil {
 		log.Printf("Error checking for updates: %v", err)
 		if u.config.OnErrorFunc != nil {
@@ -94,7 +136,7 @@ func (u *Updater) checkAndUpdate() {
 		return
 	}
 
-	log.Printf("New GeoIP database version available: %s (current: %s)", newVersion, currentVersion)
+	log.Printf("GeoIP databases are older than %s (version: %s)", u.config.MaxAge, currentVersion)
 
 	// Only auto-update if configured
 	if !u.config.AutoUpdate {
@@ -104,8 +146,12 @@ func (u *Updater) checkAndUpdate() {
 
 	// Download new databases
 	log.Println("Downloading updated databases...")
-	dbFiles, err := DownloadDatabases(u.config.DataDir)
+	dbFiles, err := DownloadDatabasesContext(ctx, u.config.DataDir)
 	if err != nil {
+		if ctx.Err() != nil {
+			log.Println("GeoIP database download cancelled")
+			return
+		}
 		log.Printf("Error downloading databases: %v", err)
 		if u.config.OnErrorFunc != nil {
 			u.config.OnErrorFunc(err)
@@ -124,10 +170,7 @@ func (u *Updater) checkAndUpdate() {
 		}
 	}
 
-	// Save new version
-	u.saveCurrentVersion(newVersion)
-
-	log.Printf("Successfully updated GeoIP databases to version %s", newVersion)
+	log.Printf("Successfully updated GeoIP databases to version %s", u.getCurrentVersion())
 
 	// Call update callback
 	if u.config.OnUpdateFunc != nil {
@@ -135,17 +178,14 @@ func (u *Updater) checkAndUpdate() {
 	}
 }
 
-// getCurrentVersion reads the current database version
+// getCurrentVersion reads the version recorded by the last download (see
+// saveVersionFile), or "" if there is none
 func (u *Updater) getCurrentVersion() string {
-	// TODO: Store version in a file or database
-	// For now, return empty to always check
-	return ""
-}
-
-// saveCurrentVersion saves the current database version
-func (u *Updater) saveCurrentVersion(version string) {
-	// TODO: Store version in a file or database
-	// For now, do nothing
+	record, err := readVersionFile(filepath.Join(u.config.DataDir, "geoip"))
+	if err != nil {
+		return ""
+	}
+	return record.Version
 }
 
 // ManualUpdate triggers a manual database update
@@ -169,26 +209,59 @@ func (u *Updater) ManualUpdate() error {
 	return nil
 }
 
-// GetScheduledTask returns a function suitable for use with a cron scheduler
+// UpdateDatabases downloads the latest databases into dataDir and reloads the
+// running instance. It is the geoip-update scheduled task.
+func UpdateDatabases(ctx context.Context, dataDir string) error {
+	dbFiles, err := DownloadDatabasesContext(ctx, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to download databases: %w", err)
+	}
+
+	if instance := GetInstance(); instance != nil {
+		if err := instance.Reload(dbFiles.CityIPv4DB, dbFiles.CityIPv6DB, dbFiles.CountryDB, dbFiles.ASNDB); err != nil {
+			return fmt.Errorf("failed to reload databases: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ReloadFromDisk reloads the databases already in dataDir, for files that
+// were replaced out-of-band. It fails without touching the loaded databases
+// if the required files are missing or any of them can't be opened. Starts
+// GeoIP if it wasn't initialized at startup.
+func ReloadFromDisk(dataDir string) error {
+	if !DatabasesExist(dataDir) {
+		return fmt.Errorf("GeoIP database files missing in %s", filepath.Join(dataDir, "geoip"))
+	}
+
+	// Only one city database is required; skip whichever is absent
+	dbFiles := GetDatabasePaths(dataDir)
+	if !fileExists(dbFiles.CityIPv4DB) {
+		dbFiles.CityIPv4DB = ""
+	}
+	if !fileExists(dbFiles.CityIPv6DB) {
+		dbFiles.CityIPv6DB = ""
+	}
+
+	instance := GetInstance()
+	if instance == nil {
+		return Initialize(dbFiles.CityIPv4DB, dbFiles.CityIPv6DB, dbFiles.CountryDB, dbFiles.ASNDB)
+	}
+	return instance.Reload(dbFiles.CityIPv4DB, dbFiles.CityIPv6DB, dbFiles.CountryDB, dbFiles.ASNDB)
+}
+
+// GetScheduledTask returns a function suitable for use with a cron scheduler.
+// The server's own scheduler runs UpdateDatabases as the geoip-update task.
 func GetScheduledTask(dataDir string) func() {
 	return func() {
 		log.Println("Scheduled GeoIP database update starting...")
 
-		// Download databases
-		dbFiles, err := DownloadDatabases(dataDir)
-		if err != nil {
+		if err := UpdateDatabases(context.Background(), dataDir); err != nil {
 			log.Printf("Scheduled update failed: %v", err)
 			return
 		}
 
-		// Reload databases
-		if instance := GetInstance(); instance != nil {
-			if err := instance.Reload(dbFiles.CityIPv4DB, dbFiles.CityIPv6DB, dbFiles.CountryDB, dbFiles.ASNDB); err != nil {
-				log.Printf("Failed to reload databases: %v", err)
-				return
-			}
-		}
-
 		log.Println("Scheduled GeoIP database update completed successfully")
 	}
 }
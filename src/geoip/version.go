@@ -0,0 +1,124 @@
+package geoip
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// versionFileName is the file in the geoip directory recording the last
+// successful download
+const versionFileName = "version.json"
+
+// versionLayout formats a build date as a database version
+const versionLayout = "2006-01-02"
+
+// versionRecord is the content of version.json
+type versionRecord struct {
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Info describes the loaded databases as a set. Version is the build date of
+// the oldest loaded database (the mmdb build epoch), so it only advances once
+// every database has been refreshed.
+type Info struct {
+	Version   string     `json:"version,omitempty"`
+	BuildDate *time.Time `json:"build_date,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// DatabaseInfo reports the version of the loaded databases and when they were
+// last downloaded. It is empty when GeoIP isn't initialized; UpdatedAt is nil
+// when the files were never downloaded by this server (e.g. copied in).
+func DatabaseInfo() Info {
+	g := GetInstance()
+	if g == nil {
+		return Info{}
+	}
+
+	var info Info
+	for _, db := range g.Databases() {
+		if db.BuildDate != nil && (info.BuildDate == nil || db.BuildDate.Before(*info.BuildDate)) {
+			info.BuildDate = db.BuildDate
+		}
+	}
+	if info.BuildDate != nil {
+		info.Version = info.BuildDate.Format(versionLayout)
+	}
+
+	g.mu.RLock()
+	dir := g.dir
+	g.mu.RUnlock()
+	if record, err := readVersionFile(dir); err == nil {
+		info.UpdatedAt = &record.UpdatedAt
+	}
+	return info
+}
+
+// filesBuildDate returns the build date of the oldest database file in
+// dataDir, opening each just long enough to read its metadata. ok is false
+// when no database file exists.
+func filesBuildDate(dataDir string) (built time.Time, ok bool, err error) {
+	files := GetDatabasePaths(dataDir)
+	for _, path := range []string{files.CityIPv4DB, files.CityIPv6DB, files.CountryDB, files.ASNDB} {
+		if !fileExists(path) {
+			continue
+		}
+		reader, err := geoip2.Open(path)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+		}
+		t := time.Unix(int64(reader.Metadata().BuildEpoch), 0).UTC()
+		reader.Close()
+		if !ok || t.Before(built) {
+			built, ok = t, true
+		}
+	}
+	return built, ok, nil
+}
+
+// readVersionFile reads version.json from the geoip directory dir
+func readVersionFile(dir string) (*versionRecord, error) {
+	data, err := os.ReadFile(filepath.Join(dir, versionFileName))
+	if err != nil {
+		return nil, err
+	}
+	var record versionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", versionFileName, err)
+	}
+	return &record, nil
+}
+
+// saveVersionFile records the build date of the databases just downloaded to
+// dataDir, replacing version.json atomically
+func saveVersionFile(dataDir string) error {
+	built, ok, err := filesBuildDate(dataDir)
+	if err != nil {
+		return err
+	}
+	record := versionRecord{UpdatedAt: time.Now().UTC()}
+	if ok {
+		record.Version = built.Format(versionLayout)
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir, "geoip", versionFileName)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", versionFileName, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %w", versionFileName, err)
+	}
+	return nil
+}
@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	_ "embed"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // Timezone offsets without relying on the host zoneinfo
 
 	"github.com/apimgr/zipcodes/src/database"
 	"github.com/apimgr/zipcodes/src/geoip"
 	"github.com/apimgr/zipcodes/src/paths"
+	"github.com/apimgr/zipcodes/src/scheduler"
 	"github.com/apimgr/zipcodes/src/server"
 	"github.com/apimgr/zipcodes/src/utils"
 )
@@ -27,10 +36,23 @@ var (
 	BuildDate = "unknown"
 )
 
+// quiet suppresses the decorative startup output (--quiet or QUIET=1)
+var quiet bool
+
+// status prints startup progress unless running quietly; warnings and errors
+// are printed regardless
+func status(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
 func main() {
 	// Command-line flags
 	showVersion := flag.Bool("version", false, "Show version information")
 	showStatus := flag.Bool("status", false, "Show server status and exit")
+	statusURL := flag.String("status-url", "", "Health check this URL for --status instead of finding the local instance")
+	resetAdmin := flag.Bool("reset-admin", false, "Regenerate the admin password and token, print them and exit")
 	showHelp := flag.Bool("help", false, "Show help message")
 	port := flag.String("port", "", "Set port (default: random 64000-64999)")
 	address := flag.String("address", "0.0.0.0", "Set listen address")
@@ -38,7 +60,17 @@ func main() {
 	configDir := flag.String("config", "", "Set config directory")
 	logsDir := flag.String("logs", "", "Set logs directory")
 	dbPath := flag.String("db-path", "", "Set SQLite database path")
+	dataFile := flag.String("data-file", "", "Load zipcodes from a JSON file instead of the embedded dataset")
+	fipsFile := flag.String("fips-file", "", "Load a county FIPS mapping (JSON) used to fill the fips field")
+	areaCodeFile := flag.String("areacode-file", "", "Load a telephone area code mapping (JSON) for /api/v1/areacode")
+	states := flag.String("states", "", "Only load these comma-separated states (default: all)")
+	candidateFile := flag.String("candidate-file", "", "Load a candidate zipcodes JSON file served for ?dataset=candidate")
+	portFile := flag.String("print-port-file", "", "Write the bound port to this file once listening")
+	tlsCert := flag.String("tls-cert", "", "Serve HTTPS with this PEM certificate (needs --tls-key)")
+	tlsKey := flag.String("tls-key", "", "Private key (PEM) for --tls-cert")
+	shutdownTimeoutFlag := flag.Duration("shutdown-timeout", 0, "How long shutdown waits for in-flight requests (default 30s)")
 	devMode := flag.Bool("dev", false, "Run in development mode")
+	quietFlag := flag.Bool("quiet", false, "Suppress startup banners and never print admin credentials")
 
 	flag.Parse()
 
@@ -55,20 +87,41 @@ func main() {
 		fmt.Println("  --help            Show this help message")
 		fmt.Println("  --version         Show version information")
 		fmt.Println("  --status          Show server status and exit with code")
+		fmt.Println("  --status-url URL  Health check URL for --status (default: from the runtime file)")
+		fmt.Println("  --reset-admin     Regenerate admin credentials (honors ADMIN_* env), print them and exit")
 		fmt.Println("  --port PORT       Set port (default: random 64000-64999)")
 		fmt.Println("  --address ADDR    Set listen address (default: 0.0.0.0)")
 		fmt.Println("  --config DIR      Set config directory")
 		fmt.Println("  --data DIR        Set data directory")
 		fmt.Println("  --logs DIR        Set logs directory")
 		fmt.Println("  --db-path PATH    Set SQLite database path")
+		fmt.Println("  --data-file PATH  Load zipcodes from a JSON file (default: embedded)")
+		fmt.Println("  --fips-file PATH  Load a county FIPS mapping (JSON)")
+		fmt.Println("  --areacode-file PATH  Load a telephone area code mapping (JSON)")
+		fmt.Println("  --states LIST     Only load these states, e.g. NY,NJ,CT (default: all)")
+		fmt.Println("  --candidate-file PATH  Load a candidate dataset (JSON) served for ?dataset=candidate")
+		fmt.Println("  --print-port-file PATH  Write the bound port to PATH once listening")
+		fmt.Println("  --tls-cert PATH   Serve HTTPS with this PEM certificate (with --tls-key)")
+		fmt.Println("  --tls-key PATH    Private key (PEM) for --tls-cert")
+		fmt.Println("  --shutdown-timeout DURATION  Drain time for in-flight requests on SIGINT/SIGTERM (default: 30s)")
 		fmt.Println("  --dev             Run in development mode")
+		fmt.Println("  --quiet           Suppress startup banners; credentials only go to the credentials file")
 		fmt.Println("\nEnvironment Variables:")
 		fmt.Println("  CONFIG_DIR        Configuration directory")
 		fmt.Println("  DATA_DIR          Data directory")
 		fmt.Println("  LOGS_DIR          Logs directory")
 		fmt.Println("  DB_PATH           SQLite database path")
+		fmt.Println("  ZIPCODES_FILE     Zipcodes JSON file")
+		fmt.Println("  ZIPCODES_FIPS_FILE County FIPS mapping JSON file")
+		fmt.Println("  ZIPCODES_AREACODE_FILE Area code mapping JSON file")
+		fmt.Println("  ZIPCODES_STATES   Comma-separated states to load")
+		fmt.Println("  ZIPCODES_CANDIDATE_FILE Candidate zipcodes JSON file")
 		fmt.Println("  PORT              Server port")
 		fmt.Println("  ADDRESS           Listen address")
+		fmt.Println("  TLS_CERT          HTTPS certificate file (same as --tls-cert)")
+		fmt.Println("  TLS_KEY           HTTPS private key file (same as --tls-key)")
+		fmt.Println("  SHUTDOWN_TIMEOUT  Shutdown drain time, e.g. 60s")
+		fmt.Println("  QUIET             Set to 1 for --quiet")
 		fmt.Println("  ADMIN_USER        Admin username (first run only)")
 		fmt.Println("  ADMIN_PASSWORD    Admin password (first run only)")
 		fmt.Println("  ADMIN_TOKEN       Admin API token (first run only)")
@@ -76,23 +129,45 @@ func main() {
 	}
 
 	// Handle status flag
-	if *showStatus {
-		os.Exit(checkServerStatus())
+	if *showStatus || *statusURL != "" {
+		os.Exit(checkServerStatus(*statusURL, *port, *dataDir))
 	}
 
 	// Store configuration
 	config := &Config{
-		Port:      *port,
-		Address:   *address,
-		DataDir:   *dataDir,
-		ConfigDir: *configDir,
-		LogsDir:   *logsDir,
-		DBPath:    *dbPath,
-		DevMode:   *devMode,
+		Port:            *port,
+		Address:         *address,
+		DataDir:         *dataDir,
+		ConfigDir:       *configDir,
+		LogsDir:         *logsDir,
+		DBPath:          *dbPath,
+		DataFile:        *dataFile,
+		FIPSFile:        *fipsFile,
+		AreaCodeFile:    *areaCodeFile,
+		States:          *states,
+		CandidateFile:   *candidateFile,
+		PortFile:        *portFile,
+		TLSCert:         *tlsCert,
+		TLSKey:          *tlsKey,
+		ShutdownTimeout: *shutdownTimeoutFlag,
+		DevMode:         *devMode,
+	}
+	quiet = *quietFlag
+	if v, err := strconv.ParseBool(os.Getenv("QUIET")); err == nil && v {
+		quiet = true
+	}
+
+	// Handle reset-admin flag
+	if *resetAdmin {
+		if err := ResetAdmin(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
 	// Start server
-	fmt.Printf("Starting zipcodes v%s...\n", Version)
+	status("Starting zipcodes v%s...\n", Version)
 	if err := StartServer(config); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -100,16 +175,61 @@ func main() {
 }
 
 type Config struct {
-	Port      string
-	Address   string
-	DataDir   string
-	ConfigDir string
-	LogsDir   string
-	DBPath    string
-	DevMode   bool
+	Port          string
+	Address       string
+	DataDir       string
+	ConfigDir     string
+	LogsDir       string
+	DBPath        string
+	DataFile      string
+	FIPSFile      string
+	AreaCodeFile  string
+	States        string
+	CandidateFile string
+	PortFile      string
+	// TLSCert and TLSKey fall back to TLS_CERT and TLS_KEY
+	TLSCert string
+	TLSKey  string
+	// ShutdownTimeout bounds the drain on SIGINT/SIGTERM; 0 falls back to
+	// SHUTDOWN_TIMEOUT, then shutdownTimeout
+	ShutdownTimeout time.Duration
+	DevMode         bool
 }
 
 func StartServer(config *Config) error {
+	// Determine port with priority order:
+	// 1. Command-line flag
+	// 2. Environment variable PORT
+	// 3. Random port 64000-64999 (spec default)
+	port := config.Port
+	if port == "" {
+		port = os.Getenv("PORT")
+	}
+	if port == "" {
+		// Generate random port in range 64000-64999
+		// Note: rand is auto-seeded in Go 1.20+, no need for rand.Seed()
+		port = strconv.Itoa(64000 + rand.Intn(1000))
+	}
+
+	// Validate port
+	if _, err := strconv.Atoi(port); err != nil {
+		return fmt.Errorf("invalid port: %s", port)
+	}
+
+	// Get listen address (flag or env or default)
+	address := config.Address
+	if address == "" {
+		address = os.Getenv("ADDRESS")
+	}
+	if address == "" {
+		address = "0.0.0.0"
+	}
+
+	// Fail fast if the address can't be bound, before the slow DB and GeoIP setup
+	if err := utils.CheckBindAddress(address, port); err != nil {
+		return err
+	}
+
 	// Get OS-specific directories with priority order:
 	// 1. Command-line flags (highest)
 	// 2. Environment variables
@@ -130,95 +250,396 @@ func StartServer(config *Config) error {
 		return fmt.Errorf("failed to create logs directory: %w", err)
 	}
 
-	fmt.Printf("📂 Config directory: %s\n", configDir)
-	fmt.Printf("📂 Data directory: %s\n", dataDir)
-	fmt.Printf("📂 Logs directory: %s\n", logsDir)
+	status("📂 Config directory: %s\n", configDir)
+	status("📂 Data directory: %s\n", dataDir)
+	status("📂 Logs directory: %s\n", logsDir)
 
-	// Determine database path with priority order:
-	// 1. Command-line flag
-	// 2. Environment variable DB_PATH
-	// 3. Default: {DATA_DIR}/zipcodes.db
-	dbPath := config.DBPath
-	if dbPath == "" {
-		dbPath = os.Getenv("DB_PATH")
-	}
-	if dbPath == "" {
-		dbPath = filepath.Join(dataDir, "zipcodes.db")
-	}
-
-	fmt.Printf("📂 Database path: %s\n", dbPath)
+	dbPath := databasePath(config, dataDir)
+	status("📂 Database path: %s\n", dbPath)
 	db, err := database.NewAppDB(dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer db.Close()
 
-	fmt.Println("✅ Database initialized successfully")
+	status("✅ Database initialized successfully\n")
+
+	// Load zipcode data from the data file (flag or env) or the embedded JSON
+	dataFile := config.DataFile
+	if dataFile == "" {
+		dataFile = os.Getenv("ZIPCODES_FILE")
+	}
+	dataset := zipcodesData
+	if dataFile != "" {
+		if data, err := os.ReadFile(dataFile); err == nil {
+			status("📥 Loading zipcode data from %s...\n", dataFile)
+			dataset = data
+		} else {
+			fmt.Printf("⚠️  Warning: cannot read data file %s: %v\n", dataFile, err)
+			status("📥 Loading zipcode data from embedded JSON...\n")
+			dataFile = ""
+		}
+	} else {
+		status("📥 Loading zipcode data from embedded JSON...\n")
+	}
 
-	// Load zipcode data from embedded JSON
-	fmt.Println("📥 Loading zipcode data from embedded JSON...")
+	// Regional deployments can load a subset of states
+	states := config.States
+	if states == "" {
+		states = os.Getenv("ZIPCODES_STATES")
+	}
+	if states != "" {
+		db.SetStates(strings.Split(states, ","))
+		status("📍 Loading states: %s\n", strings.Join(db.States(), ", "))
+	}
 
-	if err := db.LoadFromJSON(zipcodesData); err != nil {
+	if err := db.LoadFromJSON(dataset); err != nil {
 		return fmt.Errorf("failed to load zipcode data: %w", err)
 	}
 
+	// County FIPS codes come from an optional supplementary mapping; the last
+	// loaded mapping is kept in the database across restarts
+	fipsFile := config.FIPSFile
+	if fipsFile == "" {
+		fipsFile = os.Getenv("ZIPCODES_FIPS_FILE")
+	}
+	if fipsFile != "" {
+		if data, err := os.ReadFile(fipsFile); err != nil {
+			fmt.Printf("⚠️  Warning: cannot read FIPS file %s: %v\n", fipsFile, err)
+		} else if n, err := db.LoadCountyFIPS(data); err != nil {
+			fmt.Printf("⚠️  Warning: failed to load FIPS mapping: %v\n", err)
+		} else {
+			status("✅ Loaded %d county FIPS codes from %s\n", n, fipsFile)
+		}
+	}
+
+	// Telephone area codes likewise come from an optional mapping that is kept
+	// across restarts
+	areaCodeFile := config.AreaCodeFile
+	if areaCodeFile == "" {
+		areaCodeFile = os.Getenv("ZIPCODES_AREACODE_FILE")
+	}
+	if areaCodeFile != "" {
+		if data, err := os.ReadFile(areaCodeFile); err != nil {
+			fmt.Printf("⚠️  Warning: cannot read area code file %s: %v\n", areaCodeFile, err)
+		} else if n, err := db.LoadAreaCodes(data); err != nil {
+			fmt.Printf("⚠️  Warning: failed to load area code mapping: %v\n", err)
+		} else {
+			status("✅ Loaded area codes for %d zipcodes from %s\n", n, areaCodeFile)
+		}
+	}
+
+	// A candidate dataset can be loaded side by side with the primary one for
+	// A/B validation before promoting it; it is served for ?dataset=candidate
+	candidateFile := config.CandidateFile
+	if candidateFile == "" {
+		candidateFile = os.Getenv("ZIPCODES_CANDIDATE_FILE")
+	}
+	var candidate *database.DB
+	var candidateData []byte
+	if candidateFile != "" {
+		status("📥 Loading candidate zipcode data from %s...\n", candidateFile)
+		candidate, candidateData, err = loadCandidate(candidateFile, candidatePath(dbPath), db.States(), fipsFile, areaCodeFile)
+		if err != nil {
+			fmt.Printf("⚠️  Warning: candidate dataset unavailable: %v\n", err)
+		} else {
+			defer candidate.Close()
+			status("✅ Candidate dataset %s loaded\n", candidate.DatasetVersion())
+		}
+	}
+
+	settings := database.NewSettings(db.GetConn())
+
 	// Initialize GeoIP databases
+	var updater *geoip.Updater
 	if err := initializeGeoIP(dataDir); err != nil {
 		fmt.Printf("⚠️  Warning: GeoIP initialization failed: %v\n", err)
 		fmt.Println("   GeoIP features will be unavailable")
 	} else {
-		fmt.Println("✅ GeoIP databases initialized successfully")
+		status("✅ GeoIP databases initialized successfully\n")
+
+		// Keep databases fresh in the background when enabled
+		if settings.GetBool("geoip.auto_update", false) {
+			updater = geoip.NewUpdater(&geoip.UpdaterConfig{
+				DataDir:    dataDir,
+				AutoUpdate: true,
+			})
+			updater.Start()
+		}
 	}
 
-	// Determine port with priority order:
-	// 1. Command-line flag
-	// 2. Environment variable PORT
-	// 3. Random port 64000-64999 (spec default)
+	// Run enabled scheduled_tasks rows in the background
+	sched := scheduler.New(db.GetConn())
+	sched.RegisterBuiltins(db, settings, dataDir)
+	sched.Start()
+
+	// Display admin credentials if they were just created (with port)
+	var serverInfo func() string
+	if settings.GetBool("geoip.show_server_location", true) {
+		serverInfo = serverLocation
+	}
+	if err := database.DisplayAdminCredentials(db.GetConn(), port, address, serverInfo, quiet); err != nil {
+		fmt.Printf("Warning: Failed to display credentials: %v\n", err)
+	}
+
+	// HTTPS certificate from the flags or TLS_CERT/TLS_KEY
+	tlsCert, tlsKey := config.TLSCert, config.TLSKey
+	if tlsCert == "" {
+		tlsCert = os.Getenv("TLS_CERT")
+	}
+	if tlsKey == "" {
+		tlsKey = os.Getenv("TLS_KEY")
+	}
+
+	// Create and start server
+	srv := server.New(db, &server.Config{
+		Port:          port,
+		DataDir:       dataDir,
+		LogsDir:       logsDir,
+		ZipcodesData:  dataset,
+		Candidate:     candidate,
+		CandidateData: candidateData,
+		PortFile:      config.PortFile,
+		RuntimeFile:   server.RuntimeFilePath(dataDir),
+		Version:       Version,
+		Commit:        Commit,
+		BuildDate:     BuildDate,
+		Quiet:         quiet,
+		TLSCert:       tlsCert,
+		TLSKey:        tlsKey,
+	})
+
+	// Get display address (external IP, hostname, or fallback)
+	displayAddr := utils.GetDisplayAddress(address)
+
+	status("\n🚀 Server starting...\n")
+	status("   URL: http://%s:%s\n\n", displayAddr, port)
+
+	// Stop on SIGINT/SIGTERM, draining in-flight requests for up to drain
+	drain := drainTimeout(config.ShutdownTimeout)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Start(displayAddr, address)
+	}()
+
+	// In dev mode, pick up edits to the data file without a restart
+	if config.DevMode && dataFile != "" {
+		go watchDataFile(ctx, dataFile, srv.ReloadDataset)
+	}
+
+	select {
+	case err := <-errCh:
+		sched.Stop()
+		if updater != nil {
+			updater.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	status("\n🛑 Shutting down (waiting up to %s for in-flight requests)...\n", drain)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+
+	// Stop background work first so no download is left half-written
+	if err := sched.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if updater != nil {
+		if err := updater.Shutdown(shutdownCtx); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	status("✅ Server stopped\n")
+	return nil
+}
+
+// databasePath determines the database path with priority order:
+// 1. Command-line flag
+// 2. Environment variable DB_PATH
+// 3. Default: {DATA_DIR}/zipcodes.db
+func databasePath(config *Config, dataDir string) string {
+	dbPath := config.DBPath
+	if dbPath == "" {
+		dbPath = os.Getenv("DB_PATH")
+	}
+	if dbPath == "" {
+		dbPath = filepath.Join(dataDir, "zipcodes.db")
+	}
+	return dbPath
+}
+
+// ResetAdmin regenerates the admin credentials in the configured database,
+// writes them to the credentials file and prints them once. The credentials
+// file URL uses --port/PORT, or server.http_port when neither is set.
+func ResetAdmin(config *Config) error {
+	configDir, dataDir, _ := paths.GetDirs("zipcodes", config.ConfigDir, config.DataDir, config.LogsDir)
+	os.Setenv("CONFIG_DIR", configDir)
+
+	db, err := database.NewAppDB(databasePath(config, dataDir))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
 	port := config.Port
 	if port == "" {
 		port = os.Getenv("PORT")
 	}
 	if port == "" {
-		// Generate random port in range 64000-64999
-		// Note: rand is auto-seeded in Go 1.20+, no need for rand.Seed()
-		port = strconv.Itoa(64000 + rand.Intn(1000))
+		port = strconv.Itoa(database.NewSettings(db.GetConn()).GetInt("server.http_port", 64080))
 	}
-
-	// Validate port
-	if _, err := strconv.Atoi(port); err != nil {
-		return fmt.Errorf("invalid port: %s", port)
-	}
-
-	// Get listen address (flag or env or default)
 	address := config.Address
 	if address == "" {
 		address = os.Getenv("ADDRESS")
 	}
-	if address == "" {
-		address = "0.0.0.0"
+
+	return database.ResetAdminCredentials(db.GetConn(), port, address)
+}
+
+// dataFilePollInterval is how often --dev checks the data file for changes
+const dataFilePollInterval = 2 * time.Second
+
+// candidatePath is where the candidate dataset is stored: a second database
+// next to the primary one, e.g. zipcodes-candidate.db
+func candidatePath(dbPath string) string {
+	ext := filepath.Ext(dbPath)
+	return strings.TrimSuffix(dbPath, ext) + "-candidate" + ext
+}
+
+// loadCandidate loads a candidate dataset into its own database, with the
+// same state filter and FIPS and area code mappings as the primary dataset
+func loadCandidate(dataFile, dbPath string, states []string, fipsFile, areaCodeFile string) (*database.DB, []byte, error) {
+	data, err := os.ReadFile(dataFile)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Display admin credentials if they were just created (with port)
-	if err := database.DisplayAdminCredentials(db.GetConn(), port, address); err != nil {
-		fmt.Printf("Warning: Failed to display credentials: %v\n", err)
+	candidate, err := database.Initialize(dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	candidate.SetStates(states)
+	if err := candidate.LoadFromJSON(data); err != nil {
+		candidate.Close()
+		return nil, nil, err
 	}
 
-	// Create and start server
-	srv := server.New(db, port, zipcodesData)
+	if fipsFile != "" {
+		if mapping, err := os.ReadFile(fipsFile); err == nil {
+			if _, err := candidate.LoadCountyFIPS(mapping); err != nil {
+				fmt.Printf("⚠️  Warning: failed to load FIPS mapping for candidate: %v\n", err)
+			}
+		}
+	}
+	if areaCodeFile != "" {
+		if mapping, err := os.ReadFile(areaCodeFile); err == nil {
+			if _, err := candidate.LoadAreaCodes(mapping); err != nil {
+				fmt.Printf("⚠️  Warning: failed to load area code mapping for candidate: %v\n", err)
+			}
+		}
+	}
 
-	// Get display address (external IP, hostname, or fallback)
-	displayAddr := utils.GetDisplayAddress(address)
+	return candidate, data, nil
+}
 
-	fmt.Println("\n🚀 Server starting...")
-	fmt.Printf("   URL: http://%s:%s\n\n", displayAddr, port)
+// watchDataFile polls path and calls reload with its contents whenever its
+// size or modification time changes, until ctx is done
+func watchDataFile(ctx context.Context, path string, reload func([]byte) error) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
 
-	return srv.Start(displayAddr, address)
+	lastMod, lastSize := stat()
+	ticker := time.NewTicker(dataFilePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mod, size := stat()
+			if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+				continue
+			}
+			lastMod, lastSize = mod, size
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				log.Printf("Failed to read data file: %v", err)
+				continue
+			}
+			if err := reload(data); err != nil {
+				log.Printf("Failed to reload data file: %v", err)
+				continue
+			}
+			log.Printf("Reloaded zipcode data from %s", path)
+		}
+	}
+}
+
+// shutdownTimeout bounds how long shutdown waits for requests and background
+// work when neither --shutdown-timeout nor SHUTDOWN_TIMEOUT is set
+const shutdownTimeout = 30 * time.Second
+
+// drainTimeout resolves the shutdown timeout: the flag value, then
+// SHUTDOWN_TIMEOUT (a Go duration such as 60s), then shutdownTimeout
+func drainTimeout(flagValue time.Duration) time.Duration {
+	if flagValue > 0 {
+		return flagValue
+	}
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			return d
+		}
+		fmt.Printf("⚠️  Warning: invalid SHUTDOWN_TIMEOUT %q, using %s\n", v, shutdownTimeout)
+	}
+	return shutdownTimeout
+}
+
+// serverLocation describes this machine's outbound IP and, when GeoIP is
+// loaded and knows the address, where it is. Private addresses resolve to
+// nothing and are shown bare.
+func serverLocation() string {
+	ip := utils.GetOutboundIP()
+	if ip == "" {
+		return ""
+	}
+	if geoip.GetInstance() == nil {
+		return ip
+	}
+
+	loc, err := geoip.LookupIP(ip)
+	if err != nil || loc.Country == "" {
+		return ip
+	}
+	if loc.City != "" {
+		return fmt.Sprintf("%s (%s, %s)", ip, loc.City, loc.Country)
+	}
+	return fmt.Sprintf("%s (%s)", ip, loc.Country)
 }
 
 func initializeGeoIP(dataDir string) error {
 	// Check if databases already exist
 	if !geoip.DatabasesExist(dataDir) {
-		fmt.Println("GeoIP databases not found. Downloading from GitHub...")
+		status("GeoIP databases not found. Downloading from GitHub...\n")
 
 		// Download databases
 		dbFiles, err := geoip.DownloadDatabases(dataDir)
@@ -226,21 +647,21 @@ func initializeGeoIP(dataDir string) error {
 			return fmt.Errorf("failed to download databases: %w", err)
 		}
 
-		fmt.Printf("Downloaded databases:\n")
+		status("Downloaded databases:\n")
 		if dbFiles.CityIPv4DB != "" {
-			fmt.Printf("  - City IPv4: %s\n", dbFiles.CityIPv4DB)
+			status("  - City IPv4: %s\n", dbFiles.CityIPv4DB)
 		}
 		if dbFiles.CityIPv6DB != "" {
-			fmt.Printf("  - City IPv6: %s\n", dbFiles.CityIPv6DB)
+			status("  - City IPv6: %s\n", dbFiles.CityIPv6DB)
 		}
 		if dbFiles.CountryDB != "" {
-			fmt.Printf("  - Country: %s\n", dbFiles.CountryDB)
+			status("  - Country: %s\n", dbFiles.CountryDB)
 		}
 		if dbFiles.ASNDB != "" {
-			fmt.Printf("  - ASN: %s\n", dbFiles.ASNDB)
+			status("  - ASN: %s\n", dbFiles.ASNDB)
 		}
 	} else {
-		fmt.Println("Found existing GeoIP databases")
+		status("Found existing GeoIP databases\n")
 	}
 
 	// Get database paths
@@ -255,15 +676,33 @@ func initializeGeoIP(dataDir string) error {
 }
 
 // checkServerStatus checks if the server is running and healthy
+// The health URL is, in order: statusURL, --port on loopback, the runtime
+// file in the data directory, then PORT on loopback.
 // Returns exit code: 0 = healthy, 1 = unhealthy
-func checkServerStatus() int {
-	// Get port from environment or default
-	port := os.Getenv("PORT")
-	if port == "" {
-		// Try to find a running instance by checking common ports
-		// or reading from PID file
-		fmt.Println("Status: Unknown (no PORT specified)")
-		fmt.Println("Hint: Set PORT environment variable or use --port flag")
+func checkServerStatus(statusURL, port, dataDir string) int {
+	var runtime *server.RuntimeInfo
+	if statusURL == "" {
+		_, dir, _ := paths.GetDirs("zipcodes", "", dataDir, "")
+		runtime, _ = server.ReadRuntimeFile(server.RuntimeFilePath(dir))
+	}
+
+	healthURL := statusURL
+	localTLS := false
+	if healthURL == "" && port != "" {
+		healthURL, localTLS = localHealthURL(port, runtime)
+	}
+	if healthURL == "" && runtime != nil {
+		healthURL = runtime.HealthURL()
+		localTLS = runtime.TLS
+	}
+	if healthURL == "" {
+		if port = os.Getenv("PORT"); port != "" {
+			healthURL, localTLS = localHealthURL(port, runtime)
+		}
+	}
+	if healthURL == "" {
+		fmt.Println("Status: Unknown (no runtime file and no PORT specified)")
+		fmt.Println("Hint: Start the server first, or use --status-url, --port or PORT")
 		return 1
 	}
 
@@ -271,8 +710,12 @@ func checkServerStatus() int {
 	client := &http.Client{
 		Timeout: 3 * time.Second,
 	}
+	if localTLS {
+		// The local instance is probed over loopback, which its certificate
+		// (issued for the public domain) never names
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
 
-	healthURL := fmt.Sprintf("http://127.0.0.1:%s/healthz", port)
 	resp, err := client.Get(healthURL)
 	if err != nil {
 		fmt.Printf("Status: Unhealthy (cannot connect to %s)\n", healthURL)
@@ -283,10 +726,22 @@ func checkServerStatus() int {
 
 	if resp.StatusCode == http.StatusOK {
 		fmt.Println("Status: Healthy")
-		fmt.Printf("Server: Running on port %s\n", port)
+		fmt.Printf("Server: Running at %s\n", healthURL)
 		return 0
 	}
 
 	fmt.Printf("Status: Unhealthy (HTTP %d)\n", resp.StatusCode)
 	return 1
 }
+
+// localHealthURL is the loopback /healthz URL for a --port or PORT given on
+// the command line. It is https when the runtime file records that the
+// instance on that port serves TLS, since a plain HTTP probe would fail.
+func localHealthURL(port string, runtime *server.RuntimeInfo) (string, bool) {
+	tls := runtime != nil && runtime.TLS && runtime.Port == port
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://127.0.0.1:%s/healthz", scheme, port), tls
+}
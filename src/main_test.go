@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/apimgr/zipcodes/src/server"
+)
+
+func TestLocalHealthURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    string
+		runtime *server.RuntimeInfo
+		want    string
+		wantTLS bool
+	}{
+		{"no runtime file", "8080", nil, "http://127.0.0.1:8080/healthz", false},
+		{"plain HTTP instance", "8080", &server.RuntimeInfo{Port: "8080"}, "http://127.0.0.1:8080/healthz", false},
+		{"TLS instance on the port", "8443", &server.RuntimeInfo{Port: "8443", TLS: true}, "https://127.0.0.1:8443/healthz", true},
+		{"TLS instance on another port", "8080", &server.RuntimeInfo{Port: "8443", TLS: true}, "http://127.0.0.1:8080/healthz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotTLS := localHealthURL(tt.port, tt.runtime)
+			if got != tt.want || gotTLS != tt.wantTLS {
+				t.Errorf("localHealthURL(%q) = %q, %v; want %q, %v", tt.port, got, gotTLS, tt.want, tt.wantTLS)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/apimgr/zipcodes/src/geoip"
+)
+
+// RegisterBuiltins registers the geoip-update, audit-prune, history-prune and
+// backup commands
+func (s *Scheduler) RegisterBuiltins(db *database.AppDB, settings *database.Settings, dataDir string) {
+	s.Register("geoip-update", func(ctx context.Context) error {
+		return geoip.UpdateDatabases(ctx, dataDir)
+	})
+
+	s.Register("audit-prune", func(ctx context.Context) error {
+		days := settings.GetInt("audit.retention_days", 90)
+		if days <= 0 {
+			return nil
+		}
+		n, err := database.PruneAuditLog(db.GetConn(), time.Duration(days)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		log.Printf("Scheduler: pruned %d audit log entries older than %d days", n, days)
+		return nil
+	})
+
+	s.Register("history-prune", func(ctx context.Context) error {
+		days := settings.GetInt("history.retention_days", 30)
+		if days <= 0 {
+			return nil
+		}
+		n, err := database.PruneLookupHistory(db.GetConn(), time.Duration(days)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		log.Printf("Scheduler: pruned %d lookup history entries older than %d days", n, days)
+		return nil
+	})
+
+	s.Register("backup", func(ctx context.Context) error {
+		return backup(ctx, db, filepath.Join(dataDir, "backups"), settings.GetInt("backup.keep", 7))
+	})
+}
+
+// backup snapshots the database into dir and removes all but the newest keep
+// backups (keep <= 0 keeps everything)
+func backup(ctx context.Context, db *database.AppDB, dir string, keep int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, "zipcodes-"+time.Now().UTC().Format("20060102-150405")+".db")
+	if err := db.Backup(ctx, path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+
+	// Timestamped names sort oldest first
+	matches, err := filepath.Glob(filepath.Join(dir, "zipcodes-*.db"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for len(matches) > keep {
+		if err := os.Remove(matches[0]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/apimgr/zipcodes/src/database"
+)
+
+// pollInterval is how often due tasks are checked; cron has minute resolution
+const pollInterval = 30 * time.Second
+
+// defaultStopTimeout is how long Stop waits for a running task to finish
+const defaultStopTimeout = 10 * time.Second
+
+// invalidRetry is when a task with an unparseable expression is looked at again
+const invalidRetry = time.Hour
+
+// Command is a named action a scheduled task can run
+type Command func(ctx context.Context) error
+
+// Scheduler runs enabled scheduled_tasks rows on their cron schedule
+type Scheduler struct {
+	db       *sql.DB
+	commands map[string]Command
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+	running  bool
+}
+
+// New creates a scheduler with no registered commands
+func New(db *sql.DB) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		commands: make(map[string]Command),
+	}
+}
+
+// Register makes a command available to tasks under name
+func (s *Scheduler) Register(name string, cmd Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[name] = cmd
+}
+
+// Start reschedules enabled tasks from now and begins the run loop
+// Runs missed while the server was down are skipped, not caught up.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+
+	s.reschedule(time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.running = true
+	go s.run(ctx, s.done)
+}
+
+// Stop stops the scheduler, waiting up to defaultStopTimeout
+func (s *Scheduler) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		log.Printf("Scheduler did not stop cleanly: %v", err)
+	}
+}
+
+// Shutdown cancels any running task and waits for the run loop to exit or
+// for ctx to expire
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return nil
+	}
+	s.cancel()
+	done := s.done
+	s.running = false
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+		log.Println("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for scheduler: %w", ctx.Err())
+	}
+}
+
+// run is the main scheduling loop
+func (s *Scheduler) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.runDue(ctx, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reschedule sets next_run of every enabled task to its next occurrence after now
+func (s *Scheduler) reschedule(now time.Time) {
+	tasks, err := database.ListScheduledTasks(s.db)
+	if err != nil {
+		log.Printf("Scheduler: failed to load tasks: %v", err)
+		return
+	}
+
+	for _, task := range tasks {
+		if !task.Enabled {
+			continue
+		}
+		schedule, err := cron.ParseStandard(task.CronExpression)
+		if err != nil {
+			log.Printf("Scheduler: task %s has invalid cron expression %q: %v", task.Name, task.CronExpression, err)
+			continue
+		}
+		if err := database.SetTaskNextRun(s.db, task.ID, schedule.Next(now)); err != nil {
+			log.Printf("Scheduler: failed to schedule task %s: %v", task.Name, err)
+		}
+	}
+}
+
+// runDue runs every enabled task whose next_run has passed, one at a time
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	tasks, err := database.ListScheduledTasks(s.db)
+	if err != nil {
+		log.Printf("Scheduler: failed to load tasks: %v", err)
+		return
+	}
+
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			return
+		}
+		if !task.Enabled || task.NextRun.After(now) {
+			continue
+		}
+		s.runTask(ctx, task)
+	}
+}
+
+// runTask executes one task and records its outcome and next run
+func (s *Scheduler) runTask(ctx context.Context, task database.ScheduledTask) {
+	started := time.Now()
+
+	schedule, err := cron.ParseStandard(task.CronExpression)
+	if err != nil {
+		s.record(task, started, started.Add(invalidRetry), fmt.Errorf("invalid cron expression: %w", err))
+		return
+	}
+
+	s.mu.Lock()
+	cmd, ok := s.commands[task.Command]
+	s.mu.Unlock()
+
+	if !ok {
+		err = fmt.Errorf("unknown command %q", task.Command)
+	} else {
+		log.Printf("Scheduler: running task %s", task.Name)
+		err = cmd(ctx)
+	}
+
+	if err != nil {
+		log.Printf("Scheduler: task %s failed: %v", task.Name, err)
+	} else {
+		log.Printf("Scheduler: task %s completed in %s", task.Name, time.Since(started).Round(time.Millisecond))
+	}
+	s.record(task, started, schedule.Next(time.Now()), err)
+}
+
+// record stores a task run, logging if the update itself fails
+func (s *Scheduler) record(task database.ScheduledTask, ranAt, next time.Time, runErr error) {
+	if err := database.RecordTaskRun(s.db, task.ID, ranAt, next, runErr); err != nil {
+		log.Printf("Scheduler: failed to record run of task %s: %v", task.Name, err)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/utils"
+)
+
+// DataSource credits one data source behind the API
+type DataSource struct {
+	Source  string `json:"source"`
+	License string `json:"license,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Notice  string `json:"notice,omitempty"`
+}
+
+// Attribution is the body of /api/v1/attribution
+type Attribution struct {
+	Zipcodes DataSource `json:"zipcodes"`
+	GeoIP    DataSource `json:"geoip"`
+}
+
+// Attribution defaults; operators can override each in the attribution.* settings
+const (
+	defaultZipcodesSource = "US Postal Service ZIP Code data"
+	defaultZipcodesURL    = "https://github.com/apimgr/zipcodes"
+	defaultGeoIPSource    = "MaxMind GeoLite2 and sapics/ip-location-db"
+	defaultGeoIPLicense   = "CC BY-SA 4.0"
+	defaultGeoIPURL       = "https://github.com/sapics/ip-location-db"
+	defaultGeoIPNotice    = "This product includes GeoLite2 data created by MaxMind, available from https://www.maxmind.com."
+)
+
+// attribution collects the configured data source credits
+func (s *Server) attribution() Attribution {
+	return Attribution{
+		Zipcodes: DataSource{
+			Source:  s.settings.GetString("attribution.zipcodes_source", defaultZipcodesSource),
+			License: s.settings.GetString("attribution.zipcodes_license", ""),
+			URL:     s.settings.GetString("attribution.zipcodes_url", defaultZipcodesURL),
+		},
+		GeoIP: DataSource{
+			Source:  s.settings.GetString("attribution.geoip_source", defaultGeoIPSource),
+			License: s.settings.GetString("attribution.geoip_license", defaultGeoIPLicense),
+			URL:     s.settings.GetString("attribution.geoip_url", defaultGeoIPURL),
+			Notice:  s.settings.GetString("attribution.geoip_notice", defaultGeoIPNotice),
+		},
+	}
+}
+
+// attributionHandler serves GET /api/v1/attribution
+func (s *Server) attributionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    s.attribution(),
+	})
+}
+
+// String renders a source as one line: "source (license)"
+func (d DataSource) String() string {
+	line := d.Source
+	if d.License != "" {
+		line += " (" + d.License + ")"
+	}
+	return line
+}
+
+// attributionHeader sets X-Data-Attribution to the credit of the data source
+// behind a route group when attribution.header is on
+func (s *Server) attributionHeader(source func(Attribution) DataSource) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.settings.GetBool("attribution.header", false) {
+				if line := strings.TrimSpace(source(s.attribution()).String()); line != "" {
+					w.Header().Set("X-Data-Attribution", utils.SanitizeText(line))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// zipcodesSource and geoipSource pick a group's credit for attributionHeader
+func zipcodesSource(a Attribution) DataSource { return a.Zipcodes }
+func geoipSource(a Attribution) DataSource    { return a.GeoIP }
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// backupHandler streams a consistent snapshot of the SQLite database (API)
+// The snapshot is taken with VACUUM INTO a temporary file in the data
+// directory, which is removed once sent. With ?compress=gzip the file is
+// gzipped on the fly and served as .db.gz.
+func (s *Server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	compress := r.URL.Query().Get("compress")
+	if compress != "" && compress != "gzip" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"success":false,"error":{"code":"INVALID_PARAMETER","message":"compress must be gzip"}}`))
+		return
+	}
+
+	tmp, err := os.CreateTemp(s.config.DataDir, "backup-*.db")
+	if err != nil {
+		s.backupError(w, err)
+		return
+	}
+	path := tmp.Name()
+	tmp.Close()
+	// VACUUM INTO refuses to overwrite an existing file
+	os.Remove(path)
+	defer os.Remove(path)
+
+	if err := s.db.Backup(r.Context(), path); err != nil {
+		s.backupError(w, err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.backupError(w, err)
+		return
+	}
+	defer f.Close()
+
+	filename := "zipcodes-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if compress == "gzip" {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".gz"))
+		gz := gzip.NewWriter(w)
+		if _, err := io.Copy(gz, f); err != nil {
+			log.Printf("Backup stream failed: %v", err)
+			return
+		}
+		if err := gz.Close(); err != nil {
+			log.Printf("Backup stream failed: %v", err)
+		}
+		return
+	}
+
+	if info, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("Backup stream failed: %v", err)
+	}
+}
+
+// backupError reports a failure to create the snapshot
+func (s *Server) backupError(w http.ResponseWriter, err error) {
+	log.Printf("Backup failed: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(`{"success":false,"error":{"code":"BACKUP_FAILED","message":"failed to create database backup"}}`))
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+)
+
+// Cache-Control defaults per route class; each can be overridden with the
+// cache_control.<class> setting (empty sends no header)
+var defaultCacheControl = map[string]string{
+	// The raw dataset only changes with a new build or --data-file
+	"dataset": "public, max-age=86400",
+	// Zipcode lookups and searches are stable between dataset reloads
+	"zipcode": "public, max-age=3600",
+	// Lookups of an explicit ?ip= are the same for every client
+	"geoip": "public, max-age=3600",
+	// Lookups of the caller's own IP differ per client and must never be
+	// stored by browsers, proxies or CDNs
+	"geoip_self": "no-store",
+}
+
+// cacheControl sets Cache-Control for a route class on successful responses.
+// Error responses get no-store so a transient failure isn't cached, and a
+// value the handler set itself is left alone. The innermost class wins when
+// groups and routes both set one.
+func (s *Server) cacheControl(class string) func(http.Handler) http.Handler {
+	return s.cacheControlFunc(func(*http.Request) string { return class })
+}
+
+// geoipCacheControl picks geoip_self when the lookup uses the caller's IP
+// (no ?ip= or POST batches) and geoip otherwise. With
+// features.geoip_require_auth on, every lookup is geoip_self so a shared
+// cache can't hand an authenticated response to anonymous clients.
+func (s *Server) geoipCacheControl(next http.Handler) http.Handler {
+	return s.cacheControlFunc(func(r *http.Request) string {
+		if r.Method == http.MethodGet && r.URL.Query().Get("ip") != "" &&
+			!s.settings.GetBool("features.geoip_require_auth", false) {
+			return "geoip"
+		}
+		return "geoip_self"
+	})(next)
+}
+
+// cacheControlFunc is cacheControl with the class chosen per request
+func (s *Server) cacheControlFunc(classify func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class := classify(r)
+			value := s.settings.GetString("cache_control."+class, defaultCacheControl[class])
+			next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+		})
+	}
+}
+
+// cacheControlWriter adds Cache-Control when the status is written
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		h := cw.Header()
+		if h.Get("Cache-Control") == "" {
+			if status >= http.StatusBadRequest {
+				h.Set("Cache-Control", "no-store")
+			} else if cw.value != "" {
+				h.Set("Cache-Control", cw.value)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses (NDJSON) working through the wrapper
+func (cw *cacheControlWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
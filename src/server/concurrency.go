@@ -0,0 +1,91 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// concurrencyRetryAfter is the Retry-After, in seconds, sent with a 503 when
+// the server is at server.max_concurrent
+const concurrencyRetryAfter = "1"
+
+// concurrencyLogEvery throttles the "limit reached" log line so a sustained
+// overload logs a running count instead of one line per rejected request
+const concurrencyLogEvery = 10 * time.Second
+
+// concurrencyLimiter caps the number of requests being handled at once. It is
+// a last line of defense against overload, independent of the per-client rate
+// limit: past the cap, requests are turned away with 503 straight away rather
+// than queueing up behind the slow ones.
+type concurrencyLimiter struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	rejected int
+	lastLog  time.Time
+}
+
+// maxConcurrent reads server.max_concurrent (0 = unlimited). The semaphore is
+// sized once, so changes take effect on restart.
+func (s *Server) maxConcurrent() int {
+	n := s.settings.GetInt("server.max_concurrent", 0)
+	if n < 0 {
+		log.Printf("Invalid server.max_concurrent %d (must be 0 or more), not limiting concurrent requests", n)
+		return 0
+	}
+	return n
+}
+
+// limitConcurrency returns middleware allowing at most max requests in
+// flight; max <= 0 disables it. Health checks are never turned away, so a
+// busy instance isn't mistaken for a dead one by its orchestrator.
+func limitConcurrency(max int) func(http.Handler) http.Handler {
+	if max <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	cl := &concurrencyLimiter{slots: make(chan struct{}, max)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthCheck(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case cl.slots <- struct{}{}:
+				defer func() { <-cl.slots }()
+				next.ServeHTTP(w, r)
+			default:
+				cl.logRejected(max)
+				w.Header().Set("Retry-After", concurrencyRetryAfter)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"success":false,"error":{"code":"SERVER_BUSY","message":"server is at capacity, retry shortly"}}`))
+			}
+		})
+	}
+}
+
+// logRejected counts a turned-away request and logs at most once per
+// concurrencyLogEvery
+func (cl *concurrencyLimiter) logRejected(max int) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.rejected++
+	if time.Since(cl.lastLog) < concurrencyLogEvery {
+		return
+	}
+	log.Printf("Concurrent request limit reached (server.max_concurrent=%d): %d requests rejected with 503; consider scaling up or raising the limit",
+		max, cl.rejected)
+	cl.rejected = 0
+	cl.lastLog = time.Now()
+}
+
+// isHealthCheck reports whether r is for one of the health endpoints
+func isHealthCheck(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/api/v1/health"
+}
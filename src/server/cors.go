@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/utils"
+)
+
+// defaultCORSOriginsKey holds the allowed origins for routes without their own policy
+const defaultCORSOriginsKey = "proxy.cors_origins"
+
+// corsPolicies maps route groups to the setting holding their allowed origins.
+// Policies are chosen by path in one global middleware rather than per chi
+// group so preflight OPTIONS requests, which match no route, get the same
+// policy as the request they precede.
+var corsPolicies = []struct {
+	prefix string
+	key    string
+}{
+	{"/api/v1/geoip", "proxy.cors_origins_geoip"},
+}
+
+// corsOrigins returns the allowed origins for path; an empty policy falls
+// back to the default
+func (s *Server) corsOrigins(path string) []string {
+	for _, p := range corsPolicies {
+		if strings.HasPrefix(path, p.prefix) {
+			if origins := utils.ParseHeaderList(s.settings.GetString(p.key, "")); len(origins) > 0 {
+				return origins
+			}
+			break
+		}
+	}
+	return utils.ParseHeaderList(s.settings.GetString(defaultCORSOriginsKey, "*"))
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" if the origin isn't allowed
+func allowedOrigin(origins []string, origin string) string {
+	for _, o := range origins {
+		if o == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// cors applies the CORS policy of the route group a request belongs to and
+// answers OPTIONS with the methods of the matched route in Allow (and
+// Access-Control-Allow-Methods for allowed origins); unknown paths get 404
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allow := allowedOrigin(s.corsOrigins(r.URL.Path), r.Header.Get("Origin"))
+		if allow != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+		if allow != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		}
+
+		if r.Method == "OPTIONS" {
+			if allow == "" && r.Header.Get("Origin") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			// Advertise what the matched route actually supports
+			methods := s.allowedMethods(r.URL.Path)
+			if methods == nil {
+				s.notFoundHandler(w, r)
+				return
+			}
+			w.Header().Set("Allow", allowHeader(methods))
+			if allow != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allowHeader(methods))
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxDecompressedBody caps how large a gzip request body may inflate to, so a
+// small upload can't expand into gigabytes (a zip bomb)
+const maxDecompressedBody = 10 << 20
+
+// decompressBody inflates request bodies sent with Content-Encoding: gzip
+// before the handlers decode them, so batch clients can upload compactly.
+// Corrupt gzip data gets 400 INVALID_BODY and bodies inflating past
+// maxDecompressedBody get 413 BODY_TOO_LARGE. Other requests pass through.
+func decompressBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding != "gzip" && encoding != "x-gzip" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeBodyError(w, http.StatusBadRequest, "INVALID_BODY", "request body is not valid gzip")
+			return
+		}
+		defer gz.Close()
+
+		body, err := io.ReadAll(io.LimitReader(gz, maxDecompressedBody+1))
+		if err != nil {
+			writeBodyError(w, http.StatusBadRequest, "INVALID_BODY", "request body is not valid gzip")
+			return
+		}
+		if len(body) > maxDecompressedBody {
+			writeBodyError(w, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", "decompressed request body exceeds 10 MB")
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeBodyError writes the standard JSON error for a rejected request body
+func writeBodyError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"success":false,"error":{"code":"` + code + `","message":"` + message + `"}}`))
+}
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"html/template"
 	"net/http"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/api"
+	"github.com/apimgr/zipcodes/src/utils"
+	"github.com/graphql-go/graphql"
 )
 
 // handleSwaggerUI serves the Swagger UI for API documentation with site theme
@@ -91,11 +97,12 @@ func (s *Server) handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
 
 // handleOpenAPISpec serves the OpenAPI specification JSON
 func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	attribution := s.attribution()
 	spec := map[string]interface{}{
 		"openapi": "3.0.0",
 		"info": map[string]interface{}{
 			"title":       "Zipcode Lookup API",
-			"description": "US Postal Code lookup and search API with 340,000+ zipcodes",
+			"description": "US Postal Code lookup and search API with 340,000+ zipcodes\n\nData: " + attribution.Zipcodes.String() + "; GeoIP: " + attribution.GeoIP.String() + ". " + attribution.GeoIP.Notice,
 			"version":     "1.0.0",
 			"contact": map[string]string{
 				"name": "Zipcode Lookup API",
@@ -105,16 +112,56 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 				"name": "MIT",
 				"url":  "https://opensource.org/licenses/MIT",
 			},
+			"x-data-attribution": attribution,
 		},
-		"servers": []map[string]string{
-			{"url": "/api/v1", "description": "API v1"},
-		},
+		"servers": s.openAPIServers(r),
 		"tags": []map[string]string{
 			{"name": "zipcodes", "description": "Zipcode data endpoints"},
 			{"name": "geoip", "description": "GeoIP location endpoints"},
 			{"name": "admin", "description": "Admin endpoints (authentication required)"},
 		},
 		"paths": map[string]interface{}{
+			"/export": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Export the dataset as GeoJSON",
+					"description": "Stream every zipcode (or one state) as a GeoJSON FeatureCollection or NDJSON of Features, optionally gzipped. Records without coordinates have a null geometry unless geo=true.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "format",
+							"in":          "query",
+							"description": "geojson (FeatureCollection, default) or ndjson (one Feature per line)",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"geojson", "ndjson"}},
+						},
+						{
+							"name":        "compress",
+							"in":          "query",
+							"description": "gzip to download a .gz file",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"gzip"}},
+						},
+						{
+							"name":        "state",
+							"in":          "query",
+							"description": "Only export this state (2 letters)",
+							"schema":      map[string]string{"type": "string"},
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only export zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "GeoJSON (application/geo+json) or NDJSON (application/x-ndjson) stream",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid format, compress or state",
+						},
+					},
+				},
+			},
 			"/zipcodes.json": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
@@ -141,7 +188,7 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
 					"summary":     "Search zipcodes",
-					"description": "Search zipcodes by code, city, state, or prefix",
+					"description": "Search zipcodes by code, city, state, prefix, or \"lat, lon\" coordinates (returns the nearest zipcode with its distance)",
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "q",
@@ -166,8 +213,36 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 									"value":   "New York, NY",
 									"summary": "Search by city and state",
 								},
+								"coordinates": map[string]string{
+									"value":   "37.7749, -122.4194",
+									"summary": "Nearest zipcode to coordinates",
+								},
 							},
 						},
+						{
+							"name":        "format",
+							"in":          "query",
+							"description": "json (default) or csv, which returns the matching zipcodes as CSV",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"json", "csv"}},
+						},
+						{
+							"name":        "limit",
+							"in":          "query",
+							"description": "Page size for prefix and city queries (default 100 for prefixes, features.city_search_limit for cities; above 1000 is a 400)",
+							"schema":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 1000},
+						},
+						{
+							"name":        "offset",
+							"in":          "query",
+							"description": "Number of results to skip",
+							"schema":      map[string]interface{}{"type": "integer", "minimum": 0},
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates (count and total reflect filtered results; geo_excluded counts the matches left out)",
+							"schema":      map[string]string{"type": "boolean"},
+						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
@@ -185,91 +260,618 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 							"content": map[string]interface{}{
 								"application/json": map[string]interface{}{
 									"schema": map[string]interface{}{
-										"$ref": "#/components/schemas/ErrorResponse",
+										"$ref": "#/components/schemas/ErrorResponse",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/zipcode/{code}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcode details",
+					"description": "Get detailed information for a specific zipcode. A ZIP+4 code returns the 5-digit record with the add-on as plus4.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "code",
+							"in":          "path",
+							"description": "5-digit zipcode or ZIP+4 code (94102-1234)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string", "pattern": "^[0-9]{5}(-?[0-9]{4})?$"},
+							"example":     "94102",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/ZipcodeResponse",
+									},
+								},
+							},
+						},
+						"400": map[string]interface{}{
+							"description": "Malformed zipcode (INVALID_FORMAT): not 5 digits or ZIP+4",
+						},
+						"404": map[string]interface{}{
+							"description": "Valid zipcode that doesn't exist (NOT_FOUND)",
+						},
+					},
+				},
+			},
+			"/zipcode/{code}.txt": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcode as plain text",
+					"description": "Get zipcode information in plain text format",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "code",
+							"in":          "path",
+							"description": "5-digit zipcode or ZIP+4 code (94102-1234)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string", "pattern": "^[0-9]{5}(-?[0-9]{4})?$"},
+							"example":     "94102",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"text/plain": map[string]interface{}{
+									"schema": map[string]string{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/zipcode/{code}.xml": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcode as XML",
+					"description": "Get zipcode information as an XML <response> document. Any envelope endpoint also returns XML for Accept: application/xml.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "code",
+							"in":          "path",
+							"description": "5-digit zipcode or ZIP+4 code (94102-1234)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string", "pattern": "^[0-9]{5}(-?[0-9]{4})?$"},
+							"example":     "94102",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/xml": map[string]interface{}{
+									"schema": map[string]string{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/zipcode/city/{city}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcodes by city",
+					"description": "Get the zipcodes for a city name, one page at a time; total is the full match count",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "city",
+							"in":          "path",
+							"description": "City name",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "San Francisco",
+						},
+						{
+							"name":        "format",
+							"in":          "query",
+							"description": "json (default) or csv, which returns the matching zipcodes as CSV",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"json", "csv"}},
+						},
+						{
+							"name":        "limit",
+							"in":          "query",
+							"description": "Page size (default features.city_search_limit = 200; above 1000 is a 400)",
+							"schema":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 1000},
+						},
+						{
+							"name":        "offset",
+							"in":          "query",
+							"description": "Number of results to skip",
+							"schema":      map[string]interface{}{"type": "integer", "minimum": 0},
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates (count and total reflect filtered results; geo_excluded counts the matches left out)",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/SearchResponse",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/zipcode/city/{city}/all": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get a city name across all states",
+					"description": "Group every city with this name by state, with a zipcode count and a representative zipcode (closest to the city's centroid) per state",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "city",
+							"in":          "path",
+							"description": "City name",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "Springfield",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "One entry per state, ordered by state",
+						},
+					},
+				},
+			},
+			"/zipcode/state/{state}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcodes by state",
+					"description": "Get the zipcodes for a state, one page at a time; total is the full match count and has_more says whether another page follows",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "state",
+							"in":          "path",
+							"description": "State code (2 letters)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "CA",
+						},
+						{
+							"name":        "limit",
+							"in":          "query",
+							"description": "Page size (default 100; above 1000 is a 400)",
+							"schema":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 1000},
+						},
+						{
+							"name":        "offset",
+							"in":          "query",
+							"description": "Number of results to skip",
+							"schema":      map[string]interface{}{"type": "integer", "minimum": 0},
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates (count and total reflect filtered results; geo_excluded counts the matches left out)",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/SearchResponse",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/state/{state}/summary": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Summarize a state",
+					"description": "Zipcode count, number of cities and the city with the most zipcodes (a rough largest-city proxy) for a state",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "state",
+							"in":          "path",
+							"description": "State code (2 letters)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "CA",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only count zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "State summary",
+						},
+						"404": map[string]interface{}{
+							"description": "No zipcodes for the state",
+						},
+					},
+				},
+			},
+			"/zipcode/state/{state}/bounds": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Bounding box of a state",
+					"description": "Minimum and maximum latitude and longitude of the state's zipcodes plus the mean of their coordinates, for fitting a map. Records without coordinates are skipped.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "state",
+							"in":          "path",
+							"description": "State code (2 letters)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "CA",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Bounds and centroid",
+						},
+						"404": map[string]interface{}{
+							"description": "No zipcodes with coordinates for the state",
+						},
+					},
+				},
+			},
+			"/zipcode/city/{city}/bounds": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Bounding box of a city",
+					"description": "Minimum and maximum latitude and longitude of the city's zipcodes plus the mean of their coordinates. Without state, every city of that name is included.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "city",
+							"in":          "path",
+							"description": "City name",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "Providence",
+						},
+						{
+							"name":        "state",
+							"in":          "query",
+							"description": "State code (2 letters) to narrow the city",
+							"schema":      map[string]string{"type": "string"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Bounds and centroid",
+						},
+						"404": map[string]interface{}{
+							"description": "No zipcodes with coordinates for the city",
+						},
+					},
+				},
+			},
+			"/zipcode/state/{state}.ndjson": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Stream zipcodes by state",
+					"description": "Stream every zipcode in a state as newline-delimited JSON, one record per line, without a row cap",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "state",
+							"in":          "path",
+							"description": "State code (2 letters)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "CA",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "One Zipcode object per line",
+							"content": map[string]interface{}{
+								"application/x-ndjson": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/Zipcode",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/zipcode/state/{state}.csv": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Download zipcodes by state as CSV",
+					"description": "Stream every zipcode in a state as CSV with a zip_code,city,state,county,latitude,longitude header row; zip_code is zero-padded",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "state",
+							"in":          "path",
+							"description": "State code (2 letters)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "CA",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "CSV file, one zipcode per row",
+							"content": map[string]interface{}{
+								"text/csv": map[string]interface{}{
+									"schema": map[string]string{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/zipcode/fips/{code}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcodes by county FIPS",
+					"description": "Get the zipcodes in a county by its 5-digit FIPS code. Empty unless a county FIPS mapping has been loaded.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "code",
+							"in":          "path",
+							"description": "5-digit county FIPS code",
+							"required":    true,
+							"schema":      map[string]string{"type": "string", "pattern": "^[0-9]{5}$"},
+							"example":     "06037",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/SearchResponse",
+									},
+								},
+							},
+						},
+						"400": map[string]interface{}{
+							"description": "Code is not exactly 5 digits",
+						},
+					},
+				},
+			},
+			"/areacode/{code}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcodes by area code",
+					"description": "Get the zipcodes served by a telephone area code, ordered by state. Requires an area code mapping to be loaded.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "code",
+							"in":          "path",
+							"description": "3-digit NANP area code",
+							"required":    true,
+							"schema":      map[string]string{"type": "string", "pattern": "^[2-9][0-8][0-9]$"},
+							"example":     "212",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/SearchResponse",
+									},
+								},
+							},
+						},
+						"400": map[string]interface{}{
+							"description": "Not a valid NANP area code",
+						},
+						"404": map[string]interface{}{
+							"description": "No zipcodes for the area code",
+						},
+					},
+				},
+			},
+			"/metro": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "List metros",
+					"description": "List the built-in metropolitan areas with the counties each covers",
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+						},
+					},
+				},
+			},
+			"/metro/{slug}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Get zipcodes by metro",
+					"description": "Get the zipcodes across a metropolitan area's counties, ordered by state. The metro definition is returned under metro.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "slug",
+							"in":          "path",
+							"description": "Metro slug (see /metro)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "bay-area",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/SearchResponse",
 									},
 								},
 							},
 						},
+						"404": map[string]interface{}{
+							"description": "Unknown metro",
+						},
 					},
 				},
 			},
-			"/zipcode/{code}": map[string]interface{}{
+			"/zipcode/scf/{prefix}": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
-					"summary":     "Get zipcode details",
-					"description": "Get detailed information for a specific zipcode",
+					"summary":     "Get zipcodes by SCF",
+					"description": "Get the zipcodes of a Sectional Center Facility (first 3 digits) with the states covered, city count and centroid",
 					"parameters": []map[string]interface{}{
 						{
-							"name":        "code",
+							"name":        "prefix",
 							"in":          "path",
-							"description": "5-digit zipcode",
+							"description": "3-digit SCF prefix",
 							"required":    true,
-							"schema":      map[string]string{"type": "string"},
-							"example":     "94102",
+							"schema":      map[string]string{"type": "string", "pattern": "^[0-9]{3}$"},
+							"example":     "902",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates",
+							"schema":      map[string]string{"type": "boolean"},
 						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "Successful response",
+							"description": "Zipcodes in the SCF with an scf metadata object",
 							"content": map[string]interface{}{
 								"application/json": map[string]interface{}{
 									"schema": map[string]interface{}{
-										"$ref": "#/components/schemas/ZipcodeResponse",
+										"$ref": "#/components/schemas/SearchResponse",
 									},
 								},
 							},
 						},
+						"400": map[string]interface{}{
+							"description": "Prefix is not exactly 3 digits",
+						},
 						"404": map[string]interface{}{
-							"description": "Zipcode not found",
+							"description": "No zipcodes in the SCF",
 						},
 					},
 				},
 			},
-			"/zipcode/{code}.txt": map[string]interface{}{
+			"/zipcode/geohash/{hash}": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
-					"summary":     "Get zipcode as plain text",
-					"description": "Get zipcode information in plain text format",
+					"summary":     "Get zipcodes by geohash",
+					"description": "Get all zipcodes whose geohash starts with the given prefix (shorter prefixes cover larger areas, max 1000 results)",
 					"parameters": []map[string]interface{}{
 						{
-							"name":        "code",
+							"name":        "hash",
 							"in":          "path",
-							"description": "5-digit zipcode",
+							"description": "Geohash prefix (1-12 characters)",
 							"required":    true,
 							"schema":      map[string]string{"type": "string"},
-							"example":     "94102",
+							"example":     "9q8yy",
+						},
+						{
+							"name":        "geo",
+							"in":          "query",
+							"description": "Only return zipcodes with coordinates (count reflects filtered results)",
+							"schema":      map[string]string{"type": "boolean"},
 						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
 							"description": "Successful response",
 							"content": map[string]interface{}{
-								"text/plain": map[string]interface{}{
-									"schema": map[string]string{"type": "string"},
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/SearchResponse",
+									},
 								},
 							},
 						},
+						"400": map[string]interface{}{
+							"description": "Invalid geohash",
+						},
 					},
 				},
 			},
-			"/zipcode/city/{city}": map[string]interface{}{
+			"/zipcode/{code}/neighbors": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
-					"summary":     "Get zipcodes by city",
-					"description": "Get all zipcodes for a specific city",
+					"summary":     "Get adjacent zipcodes",
+					"description": "Approximates geographically adjacent zipcodes using a radius scaled to local density (1.5x the distance to the 6th-nearest distinct location, clamped to 2-50 km). Results are nearest first with a distance field.",
 					"parameters": []map[string]interface{}{
 						{
-							"name":        "city",
+							"name":        "code",
 							"in":          "path",
-							"description": "City name",
+							"description": "5-digit zipcode",
 							"required":    true,
+							"schema":      map[string]string{"type": "string", "pattern": "^[0-9]{5}$"},
+							"example":     "94102",
+						},
+						{
+							"name":        "unit",
+							"in":          "query",
+							"description": "Distance unit: km (default) or mi",
 							"schema":      map[string]string{"type": "string"},
-							"example":     "San Francisco",
+						},
+						{
+							"name":        "group",
+							"in":          "query",
+							"description": "city collapses results to nearby_cities: distinct cities with their nearest zipcode, count and min_distance",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"city"}},
 						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "Successful response",
+							"description": "Adjacent zipcodes and the radius used",
 							"content": map[string]interface{}{
 								"application/json": map[string]interface{}{
 									"schema": map[string]interface{}{
@@ -278,27 +880,49 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 								},
 							},
 						},
+						"404": map[string]interface{}{
+							"description": "Zipcode not found",
+						},
 					},
 				},
 			},
-			"/zipcode/state/{state}": map[string]interface{}{
+			"/zipcode/resolve": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
-					"summary":     "Get zipcodes by state",
-					"description": "Get all zipcodes for a specific state",
+					"summary":     "Resolve a city or address to zipcodes",
+					"description": "City-level partial geocode: returns the zipcodes for a city/state ordered by distance from the city's centroid, plus the centroid. Street names and house numbers in q are ignored.",
 					"parameters": []map[string]interface{}{
+						{
+							"name":        "city",
+							"in":          "query",
+							"description": "City name",
+							"schema":      map[string]string{"type": "string"},
+							"example":     "Washington",
+						},
 						{
 							"name":        "state",
-							"in":          "path",
-							"description": "State code (2 letters)",
-							"required":    true,
+							"in":          "query",
+							"description": "State code (optional)",
+							"schema":      map[string]string{"type": "string"},
+							"example":     "DC",
+						},
+						{
+							"name":        "q",
+							"in":          "query",
+							"description": "Free-text address used when city is omitted",
+							"schema":      map[string]string{"type": "string"},
+							"example":     "1600 Pennsylvania Ave, Washington, DC",
+						},
+						{
+							"name":        "unit",
+							"in":          "query",
+							"description": "Distance unit: km (default) or mi",
 							"schema":      map[string]string{"type": "string"},
-							"example":     "CA",
 						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "Successful response",
+							"description": "Candidate zipcodes, most central first",
 							"content": map[string]interface{}{
 								"application/json": map[string]interface{}{
 									"schema": map[string]interface{}{
@@ -307,6 +931,71 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 								},
 							},
 						},
+						"404": map[string]interface{}{
+							"description": "City not found",
+						},
+					},
+				},
+			},
+			"/zipcode/cities": map[string]interface{}{
+				"post": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Bulk city search",
+					"description": "Get zipcodes for multiple cities in one request (max 100 cities by default, see features.max_batch_size; duplicates removed)",
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"example": map[string]interface{}{
+									"cities": []map[string]string{
+										{"city": "Austin", "state": "TX"},
+										{"city": "Boston", "state": "MA"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Results grouped per input city",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid request body",
+						},
+						"413": map[string]interface{}{
+							"description": "More cities than features.max_batch_size (BATCH_TOO_LARGE, with max_batch_size)",
+						},
+					},
+				},
+			},
+			"/zipcode/centroid": map[string]interface{}{
+				"post": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Centroid of zipcodes",
+					"description": "Geographic center of a list of zipcodes (max 100 by default, see features.max_batch_size), averaged on the sphere. Codes without coordinates are listed in skipped, unknown codes in not_found.",
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"example": map[string]interface{}{
+									"codes": []string{"90001", "90002", "90003"},
+								},
+							},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Centroid with the count of codes used and the codes skipped",
+						},
+						"400": map[string]interface{}{
+							"description": "Invalid request body or invalid zipcode",
+						},
+						"413": map[string]interface{}{
+							"description": "More codes than features.max_batch_size (BATCH_TOO_LARGE, with max_batch_size)",
+						},
+						"404": map[string]interface{}{
+							"description": "None of the zipcodes have coordinates",
+						},
 					},
 				},
 			},
@@ -319,7 +1008,7 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 						{
 							"name":        "q",
 							"in":          "query",
-							"description": "Search query",
+							"description": "Search query (queries shorter than the configured minimum, default 2, return no suggestions)",
 							"required":    true,
 							"schema":      map[string]string{"type": "string"},
 						},
@@ -329,6 +1018,12 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 							"description": "Maximum number of suggestions (1-50, default: 10)",
 							"schema":      map[string]string{"type": "integer"},
 						},
+						{
+							"name":        "structured",
+							"in":          "query",
+							"description": "Return {label, city, state, zip_code, zip_count} objects instead of \"City, ST\" strings",
+							"schema":      map[string]string{"type": "boolean"},
+						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
@@ -384,11 +1079,174 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 					},
 				},
 			},
+			"/zipcode/near": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Zipcodes within a radius",
+					"description": "Zipcodes within radius of a point, nearest first, each with its distance in the requested unit. Records without coordinates are skipped.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "lat",
+							"in":          "query",
+							"description": "Latitude",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+						{
+							"name":        "lng",
+							"in":          "query",
+							"description": "Longitude (lon is also accepted)",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+						{
+							"name":        "radius",
+							"in":          "query",
+							"description": "Search radius in unit, greater than 0 and at most 500 miles",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+						{
+							"name":        "unit",
+							"in":          "query",
+							"description": "Unit of radius and distance: km (default) or mi",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"km", "mi"}},
+						},
+						{
+							"name":        "limit",
+							"in":          "query",
+							"description": "Maximum results (default 100, max 1000)",
+							"schema":      map[string]string{"type": "integer"},
+						},
+						{
+							"name":        "group",
+							"in":          "query",
+							"description": "city collapses results to nearby_cities: distinct cities with their nearest zipcode, count and min_distance; limit and total then count cities",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"city"}},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Zipcodes sorted by distance, with total inside the radius",
+						},
+						"400": map[string]interface{}{
+							"description": "Missing or invalid coordinates or radius",
+						},
+					},
+				},
+			},
+			"/geocode/reverse": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Reverse geocode to the nearest zipcode",
+					"description": "The zipcode closest to a point, with its distance in the requested unit. Useful for turning GeoIP coordinates into a zipcode.",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "lat",
+							"in":          "query",
+							"description": "Latitude",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+						{
+							"name":        "lng",
+							"in":          "query",
+							"description": "Longitude (lon is also accepted)",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+						{
+							"name":        "unit",
+							"in":          "query",
+							"description": "Unit of distance: km (default) or mi",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"km", "mi"}},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "The nearest zipcode with distance",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/ZipcodeResponse",
+									},
+								},
+							},
+						},
+						"400": map[string]interface{}{
+							"description": "Missing or invalid coordinates",
+						},
+						"404": map[string]interface{}{
+							"description": "No zipcode within 100 km (NOT_FOUND)",
+						},
+					},
+				},
+			},
+			"/zipcode/timezone": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes"},
+					"summary":     "Timezone at coordinates",
+					"description": "IANA timezone of a US location from embedded, county-level boundary data (no external service), with its current UTC offset and abbreviation",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "lat",
+							"in":          "query",
+							"description": "Latitude",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+						{
+							"name":        "lng",
+							"in":          "query",
+							"description": "Longitude (lon is also accepted)",
+							"required":    true,
+							"schema":      map[string]string{"type": "number"},
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Timezone, utc_offset and abbreviation",
+						},
+						"400": map[string]interface{}{
+							"description": "Missing or invalid coordinates",
+						},
+						"404": map[string]interface{}{
+							"description": "Coordinates are outside the US",
+						},
+					},
+				},
+			},
+			"/attribution": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"zipcodes", "geoip"},
+					"summary":     "Data attribution",
+					"description": "Source, license and required notices of the zipcode dataset and the GeoIP databases (configurable in the attribution.* settings)",
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+						},
+					},
+				},
+			},
 			"/geoip": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"geoip"},
 					"summary":     "Lookup request IP",
 					"description": "Get geolocation information for the request IP address",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "ip",
+							"in":          "query",
+							"description": "IP address to look up (default: the request IP)",
+							"schema":      map[string]string{"type": "string"},
+						},
+						{
+							"name":        "format",
+							"in":          "query",
+							"description": "Response format: json (default), text or csv",
+							"schema":      map[string]interface{}{"type": "string", "enum": []string{"json", "text", "csv"}},
+						},
+					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
 							"description": "Successful response",
@@ -413,15 +1271,43 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 					},
 				},
 			},
+			"/geoip/asn/{number}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"tags":        []string{"geoip"},
+					"summary":     "Lookup ASN",
+					"description": "Get the representative organization name, network count and sample prefixes for an autonomous system",
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "number",
+							"in":          "path",
+							"description": "AS number (e.g. 15169 or AS15169)",
+							"required":    true,
+							"schema":      map[string]string{"type": "string"},
+							"example":     "15169",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Successful response",
+						},
+						"404": map[string]interface{}{
+							"description": "ASN not found",
+						},
+					},
+				},
+			},
 			"/health": map[string]interface{}{
 				"get": map[string]interface{}{
 					"tags":        []string{"zipcodes"},
 					"summary":     "Health check",
-					"description": "Check API health status",
+					"description": "Per-subsystem health: database probe (row count, latency), GeoIP databases (availability, build age) and uptime",
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
 							"description": "Service is healthy",
 						},
+						"503": map[string]interface{}{
+							"description": "Database probe failed",
+						},
 					},
 				},
 			},
@@ -437,12 +1323,16 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 				"Zipcode": map[string]interface{}{
 					"type": "object",
 					"properties": map[string]interface{}{
-						"zipcode":   map[string]string{"type": "integer", "description": "5-digit zipcode"},
+						"zip_code":  map[string]string{"type": "string", "description": "5-digit zipcode, zero-padded (e.g. \"00601\")"},
 						"city":      map[string]string{"type": "string", "description": "City name"},
 						"state":     map[string]string{"type": "string", "description": "State abbreviation"},
 						"county":    map[string]string{"type": "string", "description": "County name"},
 						"latitude":  map[string]string{"type": "string", "description": "Latitude coordinate"},
 						"longitude": map[string]string{"type": "string", "description": "Longitude coordinate"},
+						"geohash":   map[string]string{"type": "string", "description": "6-character geohash of the coordinates (omitted without coordinates)"},
+						"fips":      map[string]string{"type": "string", "description": "5-digit county FIPS code (omitted unless a FIPS mapping is loaded)"},
+						"timezone":  map[string]string{"type": "string", "description": "IANA timezone (e.g. \"America/Chicago\"), approximated offline from state and coordinates"},
+						"plus4":     map[string]string{"type": "string", "description": "4-digit ZIP+4 add-on echoed from a ZIP+4 lookup (omitted otherwise)"},
 					},
 				},
 				"ZipcodeResponse": map[string]interface{}{
@@ -493,6 +1383,20 @@ func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(spec)
 }
 
+// openAPIServers lists the absolute URL of the API as the client reached it,
+// so "Try it out" works through proxies, followed by the relative path
+func (s *Server) openAPIServers(r *http.Request) []map[string]string {
+	servers := []map[string]string{}
+	proxy := s.settings.ProxyConfig()
+	if utils.RequestHost(r, proxy) != "" {
+		servers = append(servers, map[string]string{
+			"url":         utils.ExternalURL(r, proxy, "/api/v1"),
+			"description": "This server",
+		})
+	}
+	return append(servers, map[string]string{"url": "/api/v1", "description": "API v1 (relative)"})
+}
+
 // handleGraphQLPlayground serves the GraphQL Playground with site theme
 func (s *Server) handleGraphQLPlayground(w http.ResponseWriter, r *http.Request) {
 	tmpl := `<!DOCTYPE html>
@@ -563,14 +1467,35 @@ func (s *Server) handleGraphQLPlayground(w http.ResponseWriter, r *http.Request)
 	t.Execute(w, nil)
 }
 
-// handleGraphQL handles GraphQL queries
+// handleGraphQL executes a GraphQL query (schema in graphql.go) against the
+// request's dataset. As GraphQL clients expect, the status is 200 even when
+// the query fails; problems are reported in the standard errors array.
 func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
-	// For now, return a simple message
-	// Full GraphQL implementation would go here
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message":    "GraphQL endpoint - Full implementation coming soon",
-		"playground": "/graphql",
+
+	var req graphqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(graphqlError("request body must be JSON with a query: " + err.Error()))
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		json.NewEncoder(w).Encode(graphqlError("query is required"))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(r.Context(), graphqlDatasetKey{}, api.Dataset(r)),
 	})
+	json.NewEncoder(w).Encode(result)
+}
+
+// graphqlError is a GraphQL response carrying only an error
+func graphqlError(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	}
 }
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/apimgr/zipcodes/src/geoip"
+)
+
+// geoipReloadHandler reloads the GeoIP databases from the data directory after
+// they were replaced on disk and reports their build dates (API). Missing or
+// invalid files get 422 and the loaded databases stay in service.
+func (s *Server) geoipReloadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := geoip.ReloadFromDisk(s.config.DataDir); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   map[string]string{"code": "GEOIP_RELOAD_FAILED", "message": err.Error()},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"databases": geoip.GetInstance().Databases(),
+		},
+	})
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/graphql-go/graphql"
+)
+
+// graphqlRequest is a GraphQL-over-HTTP POST body
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlCoordinates is the coordinates object of a Zipcode
+type graphqlCoordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+var graphqlCoordinatesType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Coordinates",
+	Description: "A point in decimal degrees",
+	Fields: graphql.Fields{
+		"latitude": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(graphqlCoordinates).Latitude, nil
+			},
+		},
+		"longitude": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(graphqlCoordinates).Longitude, nil
+			},
+		},
+	},
+})
+
+// zipcodeField resolves a string field of a database.Zipcode
+func zipcodeField(description string, get func(*database.Zipcode) string) *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.String,
+		Description: description,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			zc := p.Source.(database.Zipcode)
+			return get(&zc), nil
+		},
+	}
+}
+
+var graphqlZipcodeType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Zipcode",
+	Description: "A US ZIP code",
+	Fields: graphql.Fields{
+		"zipcode":  zipcodeField("Zero-padded 5-digit ZIP code", func(zc *database.Zipcode) string { return zc.ZipCode }),
+		"city":     zipcodeField("City name", func(zc *database.Zipcode) string { return zc.City }),
+		"state":    zipcodeField("2-letter state code", func(zc *database.Zipcode) string { return zc.State }),
+		"county":   zipcodeField("County name", func(zc *database.Zipcode) string { return zc.County }),
+		"fips":     zipcodeField("5-digit county FIPS code", func(zc *database.Zipcode) string { return zc.FIPS }),
+		"timezone": zipcodeField("IANA timezone", func(zc *database.Zipcode) string { return zc.Timezone }),
+		"geohash":  zipcodeField("6-character geohash", func(zc *database.Zipcode) string { return zc.Geohash }),
+		"plus4":    zipcodeField("ZIP+4 add-on from the query, empty for a 5-digit lookup", func(zc *database.Zipcode) string { return zc.Plus4 }),
+		"coordinates": &graphql.Field{
+			Type:        graphqlCoordinatesType,
+			Description: "Location, null when the record has no coordinates",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				zc := p.Source.(database.Zipcode)
+				lat, lon, ok := zc.Coordinates()
+				if !ok {
+					return nil, nil
+				}
+				return graphqlCoordinates{Latitude: lat, Longitude: lon}, nil
+			},
+		},
+	},
+})
+
+// statsField resolves one entry of the database.GetStats map
+func statsField(key string, typ graphql.Output) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(map[string]interface{})[key], nil
+		},
+	}
+}
+
+var graphqlStatsType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Stats",
+	Description: "Dataset statistics",
+	Fields: graphql.Fields{
+		"totalZipcodes":  statsField("total_zipcodes", graphql.Int),
+		"totalCities":    statsField("total_cities", graphql.Int),
+		"totalStates":    statsField("total_states", graphql.Int),
+		"totalCounties":  statsField("total_counties", graphql.Int),
+		"datasetVersion": statsField("dataset_version", graphql.String),
+	},
+})
+
+// graphqlSchema is the schema served at POST /api/v1/graphql. Resolvers read
+// the request's dataset from the context (see graphqlDataset).
+var graphqlSchema = func() graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"zipcode": &graphql.Field{
+					Type:        graphqlZipcodeType,
+					Description: "Look up one ZIP code (94102 or 94102-1234); null when it doesn't exist",
+					Args: graphql.FieldConfigArgument{
+						"code": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					},
+					Resolve: resolveZipcode,
+				},
+				"search": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphqlZipcodeType))),
+					Description: "ZIP codes in a city, a state, or a city within a state",
+					Args: graphql.FieldConfigArgument{
+						"city":  &graphql.ArgumentConfig{Type: graphql.String},
+						"state": &graphql.ArgumentConfig{Type: graphql.String},
+					},
+					Resolve: resolveSearch,
+				},
+				"stats": &graphql.Field{
+					Type:        graphqlStatsType,
+					Description: "Dataset statistics",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return graphqlDataset(p).GetStats(p.Context)
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+	return schema
+}()
+
+// graphqlDatasetKey carries the request's dataset in the resolver context
+type graphqlDatasetKey struct{}
+
+// graphqlDataset returns the dataset the query runs against
+func graphqlDataset(p graphql.ResolveParams) *database.DB {
+	return p.Context.Value(graphqlDatasetKey{}).(*database.DB)
+}
+
+func resolveZipcode(p graphql.ResolveParams) (interface{}, error) {
+	code, plus4, err := database.ParseZipPlus4(p.Args["code"].(string))
+	if err != nil {
+		return nil, err
+	}
+	zc, err := graphqlDataset(p).SearchByZipCode(p.Context, code)
+	if err != nil || zc == nil {
+		return nil, err
+	}
+	zc.Plus4 = plus4
+	return *zc, nil
+}
+
+func resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	city, _ := p.Args["city"].(string)
+	state, _ := p.Args["state"].(string)
+	city, state = strings.TrimSpace(city), strings.TrimSpace(state)
+
+	db := graphqlDataset(p)
+	switch {
+	case city != "" && state != "":
+		return db.SearchByStateAndCity(p.Context, state, city, database.QueryOptions{})
+	case city != "":
+		return db.SearchByCity(p.Context, city, database.QueryOptions{}, database.MaxPageSize, 0)
+	case state != "":
+		return db.SearchByState(p.Context, state, database.QueryOptions{}, database.MaxPageSize, 0)
+	}
+	return nil, errors.New("search needs a city, a state or both")
+}
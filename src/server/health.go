@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/geoip"
+)
+
+// HealthStatus is the body of /healthz and /api/v1/health
+type HealthStatus struct {
+	Status    string         `json:"status"`
+	Timestamp string         `json:"timestamp"`
+	Uptime    int64          `json:"uptime_seconds"`
+	Database  DatabaseHealth `json:"database"`
+	GeoIP     GeoIPHealth    `json:"geoip"`
+	Features  HealthFeatures `json:"features"`
+}
+
+// DatabaseHealth reports the result of probing the zipcode database
+type DatabaseHealth struct {
+	Status    string  `json:"status"`
+	Type      string  `json:"type"`
+	Zipcodes  int     `json:"zipcodes"`
+	Version   string  `json:"dataset_version,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// GeoIPHealth reports which GeoIP databases are loaded and how old they are,
+// with the version and last download of the set (see geoip.DatabaseInfo)
+type GeoIPHealth struct {
+	Status string `json:"status"`
+	geoip.Info
+	Databases []geoip.DatabaseStatus `json:"databases"`
+}
+
+// HealthFeatures reports which features are currently served
+type HealthFeatures struct {
+	ZipcodeLookup bool `json:"zipcode_lookup"`
+	GeoIPLookup   bool `json:"geoip_lookup"`
+	APIEnabled    bool `json:"api_enabled"`
+}
+
+// healthCheckHandler reports per-subsystem health
+// Responds 503 when the database probe fails; GeoIP is optional and only
+// reported as unavailable
+func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	health := HealthStatus{
+		Status:    "healthy",
+		Timestamp: time.Now().Format(time.RFC3339),
+		Uptime:    s.metrics.Snapshot().Uptime,
+		Database:  s.databaseHealth(r.Context()),
+		GeoIP:     geoipHealth(),
+	}
+	health.Features = HealthFeatures{
+		ZipcodeLookup: health.Database.Status == "connected",
+		GeoIPLookup:   health.GeoIP.Status == "available",
+		APIEnabled:    s.settings.GetBool("features.api_enabled", true),
+	}
+
+	status := http.StatusOK
+	if health.Database.Status != "connected" {
+		health.Status = "unhealthy"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+// databaseHealth counts the loaded zipcodes and times the query
+func (s *Server) databaseHealth(ctx context.Context) DatabaseHealth {
+	health := DatabaseHealth{Status: "connected", Type: "sqlite"}
+
+	start := time.Now()
+	count, err := s.db.Count(ctx)
+	health.LatencyMs = math.Round(float64(time.Since(start).Microseconds())) / 1000
+	if err != nil {
+		health.Status = "error"
+		health.Error = err.Error()
+		return health
+	}
+	health.Zipcodes = count
+	health.Version = s.db.DatasetVersion()
+	return health
+}
+
+// geoipHealth reports the GeoIP databases, if GeoIP was initialized
+func geoipHealth() GeoIPHealth {
+	g := geoip.GetInstance()
+	if g == nil {
+		return GeoIPHealth{Status: "unavailable", Databases: []geoip.DatabaseStatus{}}
+	}
+	return GeoIPHealth{Status: "available", Info: geoip.DatabaseInfo(), Databases: g.Databases()}
+}
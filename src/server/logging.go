@@ -0,0 +1,43 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/apimgr/zipcodes/src/admin"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// setupLogging opens the access and error logs in the logs directory
+// Request logs go to access.log and the standard logger also writes to error.log
+func (s *Server) setupLogging() func(http.Handler) http.Handler {
+	if s.config.LogsDir == "" {
+		return middleware.Logger
+	}
+
+	accessLog, err := openLogFile(filepath.Join(s.config.LogsDir, admin.AccessLogFile))
+	if err != nil {
+		log.Printf("Warning: failed to open access log: %v", err)
+		return middleware.Logger
+	}
+
+	errorLog, err := openLogFile(filepath.Join(s.config.LogsDir, admin.ErrorLogFile))
+	if err != nil {
+		log.Printf("Warning: failed to open error log: %v", err)
+	} else {
+		log.SetOutput(io.MultiWriter(os.Stderr, errorLog))
+	}
+
+	return middleware.RequestLogger(&middleware.DefaultLogFormatter{
+		Logger:  log.New(io.MultiWriter(os.Stdout, accessLog), "", log.LstdFlags),
+		NoColor: true,
+	})
+}
+
+// openLogFile opens a log file for appending, creating it if needed
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
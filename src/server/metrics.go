@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// statsStreamInterval is how often live stats are pushed to clients
+const statsStreamInterval = 2 * time.Second
+
+// Metrics collects in-memory request counters
+type Metrics struct {
+	startTime      time.Time
+	requests       atomic.Uint64
+	errors         atomic.Uint64
+	zipcodeLookups atomic.Uint64
+	geoipLookups   atomic.Uint64
+	latency        atomic.Int64 // total nanoseconds spent serving requests
+
+	// endpoints maps "METHOD /route/{pattern}" to *endpointCounters
+	endpoints sync.Map
+}
+
+// endpointCounters holds the cumulative counters for one route
+type endpointCounters struct {
+	requests atomic.Uint64
+	errors   atomic.Uint64
+	latency  atomic.Int64
+}
+
+// EndpointMetrics is a point-in-time copy of one route's counters
+type EndpointMetrics struct {
+	Endpoint     string  `json:"endpoint"`
+	Requests     uint64  `json:"requests"`
+	Errors       uint64  `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// MetricsSnapshot is a point-in-time copy of the counters
+type MetricsSnapshot struct {
+	Uptime         int64   `json:"uptime_seconds"`
+	Requests       uint64  `json:"requests"`
+	Errors         uint64  `json:"errors"`
+	ZipcodeLookups uint64  `json:"zipcode_lookups"`
+	GeoIPLookups   uint64  `json:"geoip_lookups"`
+	RequestRate    float64 `json:"request_rate"`
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{startTime: time.Now()}
+}
+
+// Middleware counts requests, server errors and lookups by endpoint
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		elapsed := time.Since(start).Nanoseconds()
+
+		failed := ww.Status() >= http.StatusInternalServerError
+		m.requests.Add(1)
+		m.latency.Add(elapsed)
+		if failed {
+			m.errors.Add(1)
+		}
+
+		ec := m.endpoint(r)
+		ec.requests.Add(1)
+		ec.latency.Add(elapsed)
+		if failed {
+			ec.errors.Add(1)
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/v1/zipcode"):
+			m.zipcodeLookups.Add(1)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/geoip"):
+			m.geoipLookups.Add(1)
+		}
+	})
+}
+
+// endpoint returns the counters for the route that served r, keyed by the
+// route pattern so path parameters don't create one entry per zipcode
+func (m *Metrics) endpoint(r *http.Request) *endpointCounters {
+	pattern := "unmatched"
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		pattern = rctx.RoutePattern()
+	}
+	key := r.Method + " " + pattern
+
+	if ec, ok := m.endpoints.Load(key); ok {
+		return ec.(*endpointCounters)
+	}
+	ec, _ := m.endpoints.LoadOrStore(key, &endpointCounters{})
+	return ec.(*endpointCounters)
+}
+
+// Endpoints returns per-route counters sorted by request count
+func (m *Metrics) Endpoints() []EndpointMetrics {
+	list := []EndpointMetrics{}
+	m.endpoints.Range(func(key, value interface{}) bool {
+		ec := value.(*endpointCounters)
+		requests := ec.requests.Load()
+		list = append(list, EndpointMetrics{
+			Endpoint:     key.(string),
+			Requests:     requests,
+			Errors:       ec.errors.Load(),
+			AvgLatencyMs: avgLatencyMs(ec.latency.Load(), requests),
+		})
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Requests != list[j].Requests {
+			return list[i].Requests > list[j].Requests
+		}
+		return list[i].Endpoint < list[j].Endpoint
+	})
+	return list
+}
+
+// avgLatencyMs converts a nanosecond total into a mean in milliseconds
+func avgLatencyMs(totalNanos int64, count uint64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Round(float64(totalNanos)/float64(count)/1e6*1000) / 1000
+}
+
+// Snapshot returns the current counter values
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Uptime:         int64(time.Since(m.startTime).Seconds()),
+		Requests:       m.requests.Load(),
+		Errors:         m.errors.Load(),
+		ZipcodeLookups: m.zipcodeLookups.Load(),
+		GeoIPLookups:   m.geoipLookups.Load(),
+	}
+}
+
+// metricsHandler returns cumulative request metrics as JSON (API)
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	snap := s.metrics.Snapshot()
+	endpoints := s.metrics.Endpoints()
+	if endpoints == nil {
+		endpoints = []EndpointMetrics{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"uptime_seconds":  snap.Uptime,
+			"requests":        snap.Requests,
+			"errors":          snap.Errors,
+			"avg_latency_ms":  avgLatencyMs(s.metrics.latency.Load(), snap.Requests),
+			"zipcode_lookups": snap.ZipcodeLookups,
+			"geoip_lookups":   snap.GeoIPLookups,
+			"endpoints":       endpoints,
+		},
+	})
+}
+
+// statsStreamHandler pushes live counters as Server-Sent Events (API)
+func (s *Server) statsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(statsStreamInterval)
+	defer ticker.Stop()
+
+	last := s.metrics.Snapshot()
+	lastTime := time.Now()
+	if !writeStatsEvent(w, last) {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case now := <-ticker.C:
+			snap := s.metrics.Snapshot()
+			if elapsed := now.Sub(lastTime).Seconds(); elapsed > 0 {
+				snap.RequestRate = math.Round(float64(snap.Requests-last.Requests)/elapsed*100) / 100
+			}
+			last, lastTime = snap, now
+
+			if !writeStatsEvent(w, snap) {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStatsEvent writes one stats event and reports whether the client is still connected
+func writeStatsEvent(w http.ResponseWriter, snap MetricsSnapshot) bool {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(w, "event: stats\ndata: %s\n\n", data)
+	return err == nil
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// jsonNaming re-keys JSON responses to camelCase when a request asks for
+// ?naming=camel. Handlers always produce snake_case; the response body is
+// rewritten here so every endpoint converts the same way without a second
+// set of struct tags. Only object keys change, values are left alone.
+// NDJSON streams are converted line by line as they are written; other
+// non-JSON responses (text, CSV) pass through untouched.
+func (s *Server) jsonNaming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("naming") {
+		case "", "snake":
+			next.ServeHTTP(w, r)
+		case "camel":
+			nw := &namingWriter{ResponseWriter: w}
+			next.ServeHTTP(nw, r)
+			nw.finish()
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "INVALID_PARAMETER", "message": "naming must be snake or camel"},
+			})
+		}
+	})
+}
+
+// namingWriter holds back JSON bodies so their keys can be rewritten once
+// the handler is done, and rewrites NDJSON one complete line at a time.
+// Other content types are written straight through.
+type namingWriter struct {
+	http.ResponseWriter
+	status    int
+	decided   bool
+	buffering bool
+	lines     bool
+	buf       bytes.Buffer
+}
+
+func (nw *namingWriter) WriteHeader(status int) {
+	if nw.decided {
+		return
+	}
+	nw.decided = true
+	nw.status = status
+	mediaType, _, _ := mime.ParseMediaType(nw.Header().Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		nw.buffering = true
+		return
+	case "application/x-ndjson":
+		nw.lines = true
+		nw.Header().Del("Content-Length")
+	}
+	nw.ResponseWriter.WriteHeader(status)
+}
+
+func (nw *namingWriter) Write(b []byte) (int, error) {
+	if !nw.decided {
+		nw.WriteHeader(http.StatusOK)
+	}
+	if nw.buffering {
+		return nw.buf.Write(b)
+	}
+	if nw.lines {
+		nw.buf.Write(b)
+		return len(b), nw.writeLines(false)
+	}
+	return nw.ResponseWriter.Write(b)
+}
+
+// writeLines converts and sends each complete NDJSON line in the buffer, and
+// with final set, whatever is left over
+func (nw *namingWriter) writeLines(final bool) error {
+	for {
+		data := nw.buf.Bytes()
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			if !final || len(data) == 0 {
+				return nil
+			}
+			i = len(data) - 1
+		}
+		line := data[:i+1]
+		if out, err := camelCaseJSON(line); err == nil {
+			line = out
+		}
+		if _, err := nw.ResponseWriter.Write(line); err != nil {
+			return err
+		}
+		nw.buf.Next(i + 1)
+	}
+}
+
+// Flush passes through for streamed responses; buffered JSON is sent by finish
+func (nw *namingWriter) Flush() {
+	if nw.buffering {
+		return
+	}
+	if f, ok := nw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (nw *namingWriter) Unwrap() http.ResponseWriter {
+	return nw.ResponseWriter
+}
+
+// finish writes the buffered JSON with camelCase keys. A body that doesn't
+// parse is sent as it was.
+func (nw *namingWriter) finish() {
+	if nw.lines {
+		nw.writeLines(true)
+		return
+	}
+	if !nw.buffering {
+		return
+	}
+	body := nw.buf.Bytes()
+	if out, err := camelCaseJSON(body); err == nil {
+		body = out
+	}
+	nw.Header().Del("Content-Length")
+	nw.ResponseWriter.WriteHeader(nw.status)
+	nw.ResponseWriter.Write(body)
+}
+
+// camelCaseJSON re-encodes a JSON document with every object key camelCased.
+// Numbers are kept as written.
+func camelCaseJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(camelCaseKeys(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// camelCaseKeys walks a decoded JSON value renaming object keys
+func camelCaseKeys(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[snakeToCamel(k)] = camelCaseKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i, val := range t {
+			t[i] = camelCaseKeys(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// snakeToCamel converts zip_code to zipCode; keys without an inner
+// underscore are returned unchanged
+func snakeToCamel(key string) string {
+	if !strings.Contains(strings.Trim(key, "_"), "_") {
+		return key
+	}
+	parts := strings.Split(key, "_")
+	var sb strings.Builder
+	sb.Grow(len(key))
+	first := true
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if first {
+			sb.WriteString(part)
+			first = false
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// routeMethods are the methods probed when answering OPTIONS, in Allow order
+var routeMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// allowedMethods returns the methods the router serves for path, plus
+// OPTIONS, or nil if no route matches. HEAD is served for every GET route
+// (middleware.GetHead).
+func (s *Server) allowedMethods(path string) []string {
+	var methods []string
+	for _, m := range routeMethods {
+		probe := m
+		if m == "HEAD" {
+			probe = "GET"
+		}
+		if s.router.Match(chi.NewRouteContext(), probe, path) {
+			methods = append(methods, m)
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	return append(methods, "OPTIONS")
+}
+
+// allowHeader formats methods for the Allow header
+func allowHeader(methods []string) string {
+	return strings.Join(methods, ", ")
+}
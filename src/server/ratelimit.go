@@ -0,0 +1,117 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/apimgr/zipcodes/src/utils"
+)
+
+const (
+	defaultRateLimitRPM             = 120
+	defaultAutocompleteRateLimitRPM = 60
+	rateLimitIdleTTL                = 10 * time.Minute // Evict buckets idle this long
+)
+
+// rateBucket is a per-client token bucket
+type rateBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter limits requests per client IP using token buckets
+type RateLimiter struct {
+	settings   *database.Settings
+	settingKey string // Setting holding the requests per minute
+	defaultRPM int
+	mu         sync.Mutex
+	buckets    map[string]*rateBucket
+	lastSweep  time.Time
+}
+
+// NewRateLimiter creates a rate limiter whose requests per minute are read
+// from settingKey, falling back to defaultRPM
+func NewRateLimiter(settings *database.Settings, settingKey string, defaultRPM int) *RateLimiter {
+	return &RateLimiter{
+		settings:   settings,
+		settingKey: settingKey,
+		defaultRPM: defaultRPM,
+		buckets:    make(map[string]*rateBucket),
+		lastSweep:  time.Now(),
+	}
+}
+
+// rpm returns the configured requests per minute (0 disables limiting)
+func (rl *RateLimiter) rpm() int {
+	return rl.settings.GetInt(rl.settingKey, rl.defaultRPM)
+}
+
+// take consumes a token for key and reports whether the request is allowed,
+// the tokens left and how long until the bucket is full again
+func (rl *RateLimiter) take(key string, limit int) (bool, int, time.Duration) {
+	now := time.Now()
+	capacity := float64(limit)
+	refill := capacity / 60 // tokens per second
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for k, b := range rl.buckets {
+			if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: capacity, lastSeen: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.lastSeen).Seconds()*refill)
+	b.lastSeen = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	reset := time.Duration((capacity - b.tokens) / refill * float64(time.Second))
+	return allowed, int(b.tokens), reset
+}
+
+// Middleware enforces the rate limit and reports its state in response headers
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := rl.rpm()
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, remaining, reset := rl.take(utils.ClientIP(r), limit)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(reset).Unix(), 10))
+
+		if !allowed {
+			// Time until one token is available
+			retryAfter := int(math.Ceil(60 / float64(limit)))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"success":false,"error":{"code":"RATE_LIMITED","message":"too many requests"}}`))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RuntimeFileName is the file in the data directory describing the running
+// instance, so --status can find it without PORT or other configuration
+const RuntimeFileName = "runtime.json"
+
+// RuntimeInfo is the content of the runtime file
+type RuntimeInfo struct {
+	PID       int       `json:"pid"`
+	Address   string    `json:"address"`
+	Port      string    `json:"port"`
+	TLS       bool      `json:"tls,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// RuntimeFilePath returns the runtime file location for a data directory
+func RuntimeFilePath(dataDir string) string {
+	return filepath.Join(dataDir, RuntimeFileName)
+}
+
+// ReadRuntimeFile loads the runtime file written by a running server
+func ReadRuntimeFile(path string) (*RuntimeInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var info RuntimeInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// HealthURL returns the /healthz URL of the instance, https when it serves
+// TLS. Wildcard bind addresses are probed over loopback.
+func (info *RuntimeInfo) HealthURL() string {
+	host := info.Address
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if info.TLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, info.Port) + "/healthz"
+}
+
+// writeRuntimeFile records the bound address and port of this process and
+// whether it serves TLS
+func writeRuntimeFile(path, address, port string, tls bool) error {
+	data, err := json.MarshalIndent(RuntimeInfo{
+		PID:       os.Getpid(),
+		Address:   address,
+		Port:      port,
+		TLS:       tls,
+		StartedAt: time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
@@ -1,19 +1,26 @@
 package server
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
-	"time"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/apimgr/zipcodes/src/admin"
 	"github.com/apimgr/zipcodes/src/api"
 	"github.com/apimgr/zipcodes/src/database"
 	"github.com/apimgr/zipcodes/src/geoip"
+	"github.com/apimgr/zipcodes/src/utils"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 //go:embed static
@@ -24,54 +31,113 @@ var templateFiles embed.FS
 
 // Server represents the HTTP server
 type Server struct {
-	router *chi.Mux
-	db     *database.AppDB
-	port   string
+	router      *chi.Mux
+	db          *database.AppDB
+	settings    *database.Settings
+	rateLimiter *RateLimiter
+	acLimiter   *RateLimiter // Tighter limit for autocomplete keystrokes
+	metrics     *Metrics
+	config      *Config
+	port        string
+	httpServer  *http.Server
+
+	// redirectServer is the plain HTTP listener redirecting to HTTPS, if any
+	redirectServer *http.Server
+}
+
+// Config holds the options used to construct a Server
+type Config struct {
+	Port         string
+	DataDir      string
+	LogsDir      string
+	ZipcodesData []byte
+
+	// Candidate, if set, is a second dataset served for ?dataset=candidate;
+	// CandidateData is its raw JSON for /api/v1/zipcodes.json
+	Candidate     *database.DB
+	CandidateData []byte
+
+	// PortFile, if set, receives the bound port once the listener is open
+	PortFile string
+
+	// RuntimeFile, if set, receives a RuntimeInfo once the listener is open
+	// and is removed on shutdown (see RuntimeFilePath)
+	RuntimeFile string
+
+	// Build info reported by /version
+	Version   string
+	Commit    string
+	BuildDate string
+
+	// Quiet logs a single ready line once listening instead of the startup lines
+	Quiet bool
+
+	// TLSCert and TLSKey are PEM files served over HTTPS (see setupTLS)
+	TLSCert string
+	TLSKey  string
 }
 
 // New creates a new server instance
-func New(db *database.AppDB, port string, zipcodesData []byte) *Server {
+func New(db *database.AppDB, config *Config) *Server {
+	port := config.Port
 	if port == "" {
 		port = "8080"
 	}
 
 	s := &Server{
-		router: chi.NewRouter(),
-		db:     db,
-		port:   port,
+		router:   chi.NewRouter(),
+		db:       db,
+		settings: database.NewSettings(db.GetConn()),
+		config:   config,
+		port:     port,
 	}
+	s.rateLimiter = NewRateLimiter(s.settings, "security.rate_limit_rpm", defaultRateLimitRPM)
+	s.acLimiter = NewRateLimiter(s.settings, "security.autocomplete_rate_limit_rpm", defaultAutocompleteRateLimitRPM)
+	s.metrics = NewMetrics()
 
 	// Set embedded JSON data for API handlers
-	api.SetZipcodesJSON(zipcodesData)
+	api.SetZipcodesJSON(config.ZipcodesData)
+	if config.Candidate != nil {
+		api.SetCandidate(config.Candidate, config.CandidateData)
+	}
 
 	s.setupMiddleware()
 	s.setupRoutes()
 
+	s.httpServer = &http.Server{Handler: s.router}
+
 	return s
 }
 
+// defaultCompressionLevel is the gzip level used when server.compression_level
+// is unset or invalid
+const defaultCompressionLevel = 5
+
+// compressionLevel reads server.compression_level (1 fastest - 9 smallest).
+// The middleware is built once, so changes take effect on restart.
+func (s *Server) compressionLevel() int {
+	level := s.settings.GetInt("server.compression_level", defaultCompressionLevel)
+	if level < 1 || level > 9 {
+		log.Printf("Invalid server.compression_level %d (must be 1-9), using %d", level, defaultCompressionLevel)
+		return defaultCompressionLevel
+	}
+	return level
+}
+
 // setupMiddleware configures middleware
 func (s *Server) setupMiddleware() {
-	s.router.Use(middleware.Logger)
+	s.router.Use(middleware.RequestID)
+	s.router.Use(s.clientIP)
+	s.router.Use(s.setupLogging())
 	s.router.Use(middleware.Recoverer)
-	s.router.Use(middleware.Compress(5))
-	s.router.Use(middleware.Timeout(60 * time.Second))
+	s.router.Use(s.metrics.Middleware)
+	s.router.Use(limitConcurrency(s.maxConcurrent()))
+	s.router.Use(middleware.Compress(s.compressionLevel()))
+	s.router.Use(middleware.GetHead)
+	s.router.Use(decompressBody)
 
-	// CORS headers
-	s.router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	})
+	// CORS headers (per route group, see cors.go)
+	s.router.Use(s.cors)
 
 	// Security headers
 	s.router.Use(func(next http.Handler) http.Handler {
@@ -85,79 +151,296 @@ func (s *Server) setupMiddleware() {
 	})
 }
 
+// adminPaths reads server.admin_path and server.admin_api_path, applied on
+// restart. An invalid value is logged and the default used.
+func (s *Server) adminPaths() admin.Paths {
+	web, err := database.CleanAdminPath(s.settings.GetString("server.admin_path", database.DefaultAdminPath), false)
+	if err != nil {
+		log.Printf("Invalid server.admin_path: %v, using %s", err, database.DefaultAdminPath)
+		web = database.DefaultAdminPath
+	}
+	api, err := database.CleanAdminPath(s.settings.GetString("server.admin_api_path", database.DefaultAdminAPIPath), true)
+	if err != nil {
+		log.Printf("Invalid server.admin_api_path: %v, using %s", err, database.DefaultAdminAPIPath)
+		api = database.DefaultAdminAPIPath
+	}
+	return admin.Paths{Web: web, API: api}
+}
+
 // setupRoutes configures all routes
 func (s *Server) setupRoutes() {
 	// Set database for API handlers (use the underlying DB)
 	api.SetDatabase(s.db.DB)
+	api.SetSettings(s.settings)
+	geoip.SetSettings(s.settings)
 
-	// Initialize admin handlers and middleware
-	adminHandler := admin.NewHandler(s.db.GetConn(), templateFiles)
-	adminMw := admin.NewMiddleware(s.db.GetConn())
-
-	// Static files
-	staticFS, _ := fs.Sub(staticFiles, "static")
-	s.router.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
-
-	// Health check
-	s.router.Get("/healthz", s.healthCheckHandler)
-
-	// Homepage
-	s.router.Get("/", s.indexHandler)
-
-	// Documentation routes (public)
-	s.router.Get("/openapi", s.handleSwaggerUI)
-	s.router.Get("/graphql", s.handleGraphQLPlayground)
-
-	// Admin routes (Basic Auth for web UI)
-	s.router.Route("/admin", func(r chi.Router) {
-		r.Use(adminMw.RequireBasicAuth)
-		r.Get("/", adminHandler.DashboardHandler)
-		r.Get("/settings", adminHandler.SettingsHandler)
-		r.Post("/settings", adminHandler.SettingsHandler)
-		r.Get("/database", adminHandler.DatabaseHandler)
-		r.Post("/database/test", adminHandler.DatabaseTestHandler)
-		r.Get("/logs", adminHandler.LogsHandler)
-		r.Get("/audit", adminHandler.AuditHandler)
-	})
+	// Lookup history, recorded only while features.track_lookups is on
+	history := database.NewLookupHistory(s.db.GetConn(), s.settings)
+	api.SetLookupHistory(history)
+	geoip.SetLookupHistory(history)
 
-	// API routes (public)
-	s.router.Route("/api/v1", func(r chi.Router) {
-		// Documentation endpoints
+	// Initialize admin handlers and middleware
+	adminPaths := s.adminPaths()
+	adminHandler := admin.NewHandler(s.db.GetConn(), s.settings, templateFiles, s.config.LogsDir, adminPaths)
+	adminMw := admin.NewMiddleware(s.db.GetConn(), s.settings, adminPaths.Web)
+
+	// Themed 404 for browsers, JSON for API clients
+	s.router.NotFound(s.notFoundHandler)
+
+	// Everything but the long-lived streams is bounded by requestTimeout;
+	// the streams are registered without it (see timeout)
+	s.router.Group(func(r chi.Router) {
+		r.Use(timeout(requestTimeout))
+
+		// Static files
+		staticFS, _ := fs.Sub(staticFiles, "static")
+		if static, err := s.staticHandler(staticFS); err != nil {
+			log.Printf("Failed to index static files: %v", err)
+		} else {
+			r.Method(http.MethodGet, "/static/*", static)
+		}
+
+		// Health check
+		r.Get("/healthz", s.healthCheckHandler)
+
+		// Homepage
+		r.Get("/", s.indexHandler)
+
+		// Build info at the root for monitoring and deploy checks
+		r.Get("/version", s.versionHandler)
+		r.Get("/version.json", s.versionHandler)
+		r.Get("/version.txt", s.versionTextHandler)
+
+		// Documentation routes (public)
 		r.Get("/openapi", s.handleSwaggerUI)
-		r.Get("/openapi.json", s.handleOpenAPISpec)
 		r.Get("/graphql", s.handleGraphQLPlayground)
-		r.Post("/graphql", s.handleGraphQL)
-
-		// Raw JSON file endpoint
-		r.Get("/zipcodes.json", api.RawJSONHandler)
 
-		// Zipcode endpoints
-		r.Get("/zipcode/search", api.SearchHandler)
-		r.Get("/zipcode/autocomplete", api.AutoCompleteHandler)
-		r.Get("/zipcode/stats", api.StatsHandler)
-		r.Get("/zipcode/{code}", api.GetByZipCodeHandler)
-		r.Get("/zipcode/{code}.txt", api.GetByZipCodeTextHandler)
-		r.Get("/zipcode/city/{city}", api.GetByCityHandler)
-		r.Get("/zipcode/state/{state}", api.GetByStateHandler)
+		// Admin routes (Basic Auth for web UI)
+		r.Route(adminPaths.Web, func(r chi.Router) {
+			r.Use(adminMw.RequireBasicAuth)
+			r.Use(adminMw.AuditWrites)
+			r.Get("/", adminHandler.DashboardHandler)
+			r.Get("/settings", adminHandler.SettingsHandler)
+			r.Post("/settings", adminHandler.SettingsHandler)
+			r.Get("/database", adminHandler.DatabaseHandler)
+			r.Post("/database/test", adminHandler.DatabaseTestHandler)
+			r.Get("/logs", adminHandler.LogsHandler)
+			r.Get("/audit", adminHandler.AuditHandler)
+		})
+	})
 
-		// GeoIP endpoints
-		r.Get("/geoip", geoip.LookupHandler)
-		r.Get("/geoip.txt", geoip.LookupTextHandler)
-		r.Post("/geoip/batch", geoip.BatchLookupHandler)
+	// API routes (public)
+	s.router.Route("/api/v1", func(r chi.Router) {
+		r.Use(s.rateLimiter.Middleware)
+
+		// Public endpoints can be switched off with features.api_enabled
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireAPIEnabled)
+			r.Use(s.jsonNaming)
+
+			r.Group(func(r chi.Router) {
+				r.Use(timeout(requestTimeout))
+
+				// Documentation endpoints
+				r.Get("/openapi", s.handleSwaggerUI)
+				r.Get("/openapi.json", s.handleOpenAPISpec)
+				r.Get("/graphql", s.handleGraphQLPlayground)
+				r.With(s.selectDataset, s.queryTimeout).Post("/graphql", s.handleGraphQL)
+
+				// Zipcode data carries X-Dataset-Version so clients can detect updates
+				r.Group(func(r chi.Router) {
+					r.Use(s.selectDataset)
+					r.Use(s.datasetVersionHeader)
+					r.Use(s.attributionHeader(zipcodesSource))
+					r.Use(s.cacheControl("zipcode"))
+					r.Use(s.queryTimeout)
+					r.Use(s.sharedCache)
+
+					// Raw JSON file endpoint
+					r.With(s.cacheControl("dataset")).Get("/zipcodes.json", api.RawJSONHandler)
+
+					// Zipcode endpoints
+					r.Get("/zipcode/search", api.SearchHandler)
+					r.With(s.acLimiter.Middleware).Get("/zipcode/autocomplete", api.AutoCompleteHandler)
+					r.Get("/zipcode/resolve", api.ResolveHandler)
+					r.Post("/zipcode/cities", api.BulkCitySearchHandler)
+					r.Post("/zipcode/centroid", api.CentroidHandler)
+					r.Get("/zipcode/stats", api.StatsHandler)
+					r.Get("/zipcode/timezone", api.TimezoneHandler)
+					r.Get("/zipcode/near", api.GetNearHandler)
+					r.Get("/geocode/reverse", api.ReverseGeocodeHandler)
+					r.Get("/zipcode/{code}", api.GetByZipCodeHandler)
+					r.Get("/zipcode/{code}.txt", api.GetByZipCodeHandler)
+					r.Get("/zipcode/{code}.xml", api.GetByZipCodeHandler)
+					r.Get("/zipcode/{code}/neighbors", api.GetNeighborsHandler)
+					r.Get("/zipcode/city/{city}", api.GetByCityHandler)
+					r.Get("/zipcode/city/{city}/all", api.GetByCityAllStatesHandler)
+					r.Get("/zipcode/city/{city}/bounds", api.GetCityBoundsHandler)
+					r.Get("/zipcode/state/{state}", api.GetByStateHandler)
+					r.Get("/zipcode/state/{state}/bounds", api.GetStateBoundsHandler)
+					r.Get("/state/{state}/summary", api.GetStateSummaryHandler)
+					r.Get("/zipcode/geohash/{hash}", api.GetByGeohashHandler)
+					r.Get("/zipcode/scf/{prefix}", api.GetBySCFHandler)
+					r.Get("/zipcode/fips/{code}", api.GetByFIPSHandler)
+					r.Get("/areacode/{code}", api.GetByAreaCodeHandler)
+					r.Get("/metro", api.ListMetrosHandler)
+					r.Get("/metro/{slug}", api.GetByMetroHandler)
+				})
+
+				// GeoIP endpoints (optionally gated by features.geoip_require_auth)
+				r.Group(func(r chi.Router) {
+					r.Use(s.requireGeoIPAuth)
+					r.Use(s.attributionHeader(geoipSource))
+					r.Use(s.geoipCacheControl)
+					r.Get("/geoip", geoip.LookupHandler)
+					r.Get("/geoip.txt", geoip.LookupTextHandler)
+					r.Post("/geoip/batch", geoip.BatchLookupHandler)
+					r.Get("/geoip/asn/{number}", geoip.ASNHandler)
+				})
+			})
+
+			// Bulk export and the per-state NDJSON and CSV streams run far
+			// longer than the request timeout or db.query_timeout allow, so
+			// they run without either, and outside the zipcode group's shared
+			// cache
+			r.Group(func(r chi.Router) {
+				r.Use(s.selectDataset)
+				r.Use(s.datasetVersionHeader)
+				r.Use(s.attributionHeader(zipcodesSource))
+				r.Use(s.cacheControl("dataset"))
+				r.Get("/export", api.ExportHandler)
+				r.With(s.cacheControl("zipcode")).Get("/zipcode/state/{state}.ndjson", api.GetByStateNDJSONHandler)
+				r.With(s.cacheControl("zipcode")).Get("/zipcode/state/{state}.csv", api.GetByStateCSVHandler)
+			})
+		})
 
 		// Admin API routes (Bearer token)
-		r.Route("/admin", func(r chi.Router) {
+		r.Route(strings.TrimPrefix(adminPaths.API, "/api/v1"), func(r chi.Router) {
 			r.Use(adminMw.RequireBearerToken)
-			r.Get("/", adminHandler.AdminInfoHandler)
-			r.Get("/settings", adminHandler.SettingsHandler)
-			r.Put("/settings", adminHandler.SettingsHandler)
-			r.Post("/reload", adminHandler.ReloadHandler)
-			r.Get("/stats", adminHandler.AdminStatsHandler)
+			r.Use(adminMw.Idempotent)
+			r.Use(adminMw.AuditWrites)
+
+			r.Group(func(r chi.Router) {
+				r.Use(timeout(requestTimeout))
+				r.Get("/", adminHandler.AdminInfoHandler)
+				r.Get("/settings", adminHandler.SettingsHandler)
+				r.Put("/settings", adminHandler.SettingsHandler)
+				r.Post("/reload", adminHandler.ReloadHandler)
+				r.Post("/cache/purge", adminHandler.PurgeCacheHandler)
+				r.Get("/tokens", adminHandler.TokensHandler)
+				r.Post("/tokens", adminHandler.TokensHandler)
+				r.Delete("/tokens/{id}", adminHandler.RevokeTokenHandler)
+				r.Get("/stats", adminHandler.AdminStatsHandler)
+				r.Get("/metrics", s.metricsHandler)
+				r.Get("/history/top", adminHandler.TopLookupsHandler)
+				r.Get("/backup", s.backupHandler)
+				r.Post("/geoip/reload", s.geoipReloadHandler)
+				r.Get("/logs", adminHandler.LogsAPIHandler)
+			})
+
+			// Stats and log streams stay open until the client disconnects,
+			// so they run without the request timeout
+			r.Get("/stats/stream", s.statsStreamHandler)
+			r.Get("/logs/stream", adminHandler.LogsStreamHandler)
 		})
 	})
 
-	// API health endpoint (public)
-	s.router.Get("/api/v1/health", s.healthCheckHandler)
+	// API health and version endpoints (public)
+	s.router.Group(func(r chi.Router) {
+		r.Use(timeout(requestTimeout))
+		r.Get("/api/v1/health", s.healthCheckHandler)
+		r.Get("/api/v1/version", s.versionHandler)
+		r.Get("/api/v1/version.txt", s.versionTextHandler)
+		r.Get("/api/v1/attribution", s.attributionHandler)
+	})
+}
+
+// ReloadDataset loads a new zipcode dataset into the database and serves it
+// from the raw JSON endpoint
+func (s *Server) ReloadDataset(data []byte) error {
+	if err := s.db.LoadFromJSON(data); err != nil {
+		return err
+	}
+	api.SetZipcodesJSON(data)
+	return nil
+}
+
+// selectDataset routes ?dataset=candidate requests to the candidate dataset
+// and marks them with X-Dataset: candidate. dataset=primary (the default)
+// uses the primary dataset.
+func (s *Server) selectDataset(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("dataset") {
+		case "", "primary":
+			next.ServeHTTP(w, r)
+		case "candidate":
+			if !api.HasCandidate() {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"success":false,"error":{"code":"NOT_FOUND","message":"no candidate dataset is loaded"}}`))
+				return
+			}
+			w.Header().Set("X-Dataset", "candidate")
+			next.ServeHTTP(w, api.UseCandidate(r))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"success":false,"error":{"code":"INVALID_PARAMETER","message":"dataset must be primary or candidate"}}`))
+		}
+	})
+}
+
+// datasetVersionHeader sets X-Dataset-Version to the loaded dataset's version
+func (s *Server) datasetVersionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := api.Dataset(r).DatasetVersion(); v != "" {
+			w.Header().Set("X-Dataset-Version", v)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP resolves the trusted client IP once, honoring the proxy settings,
+// and stores it for utils.ClientIP. Nothing downstream should read proxy
+// headers or RemoteAddr for the caller's address itself.
+func (s *Server) clientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, utils.WithClientIP(r, utils.GetClientIP(r, s.settings.ProxyConfig())))
+	})
+}
+
+// requireAPIEnabled returns 503 for public API routes when features.api_enabled is off
+func (s *Server) requireAPIEnabled(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.settings.GetBool("features.api_enabled", true) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"success":false,"error":{"code":"API_DISABLED","message":"the public API is disabled"}}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireGeoIPAuth requires a valid bearer token on GeoIP routes when
+// features.geoip_require_auth is on; the zipcode routes stay public
+func (s *Server) requireGeoIPAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.settings.GetBool("features.geoip_require_auth", false) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !database.VerifyAPIToken(s.db.GetConn(), strings.TrimSpace(token)) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="geoip"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"success":false,"error":{"code":"UNAUTHORIZED","message":"a valid bearer token is required for GeoIP endpoints"}}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // indexHandler serves the main page
@@ -172,30 +455,132 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// healthCheckHandler provides health status
-func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	_, err := s.db.GetStats()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// notFoundHandler serves the themed 404 page to browsers and the JSON error
+// envelope to API paths and non-HTML clients
+func (s *Server) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"success":false,"error":{"code":"NOT_FOUND","message":"resource not found"}}`))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	data, err := templateFiles.ReadFile("templates/404.html")
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
 
-	// Simple JSON response
-	fmt.Fprintf(w, `{"status":"healthy","timestamp":"%s","database":{"status":"connected","type":"sqlite"},"features":{"zipcode_lookup":true,"geoip_lookup":%t,"api_enabled":true}}`,
-		time.Now().Format(time.RFC3339),
-		geoip.GetInstance() != nil,
-	)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(data)
 }
 
-// Start starts the HTTP server
+// Start starts the HTTP server, over HTTPS when setupTLS finds a certificate
 func (s *Server) Start(displayAddr, bindAddr string) error {
-	addr := fmt.Sprintf("%s:%s", bindAddr, s.port)
+	addr := net.JoinHostPort(bindAddr, s.port)
+	setup := s.setupTLS()
+	scheme := "http"
+	if setup != nil {
+		scheme = "https"
+	}
 
-	log.Printf("Listening on %s\n", addr)
-	log.Printf("Access at http://%s:%s\n", displayAddr, s.port)
+	if !s.config.Quiet {
+		log.Printf("Listening on %s\n", addr)
+		log.Printf("Access at %s://%s:%s\n", scheme, displayAddr, s.port)
+	}
 
-	return http.ListenAndServe(addr, s.router)
+	s.httpServer.Addr = addr
+	if setup != nil {
+		// HTTP/2 is negotiated over TLS by ServeTLS; h2c is cleartext only
+		s.httpServer.TLSConfig = setup.config
+	} else if err := s.enableH2C(); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	_, boundPort, _ := net.SplitHostPort(ln.Addr().String())
+	if s.config.PortFile != "" {
+		if err := writeFileAtomic(s.config.PortFile, []byte(boundPort+"\n")); err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to write port file: %w", err)
+		}
+	}
+	if setup != nil {
+		if err := s.startRedirect(bindAddr, boundPort, setup); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	if s.config.RuntimeFile != "" {
+		if err := writeRuntimeFile(s.config.RuntimeFile, bindAddr, boundPort, setup != nil); err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to write runtime file: %w", err)
+		}
+	}
+
+	if s.config.Quiet {
+		log.Printf("Server ready on %s (%s://%s:%s)\n", addr, scheme, displayAddr, s.port)
+	}
+
+	if setup != nil {
+		return s.httpServer.ServeTLS(ln, "", "")
+	}
+	return s.httpServer.Serve(ln)
+}
+
+// enableH2C serves HTTP/2 without TLS (h2c) alongside HTTP/1.1 when
+// server.h2c_enabled is on, for internal deployments behind an h2c-capable
+// proxy. Both prior-knowledge and Upgrade: h2c connections are accepted.
+// Registering the HTTP/2 server with httpServer lets Shutdown drain HTTP/2
+// connections as well.
+func (s *Server) enableH2C() error {
+	if !s.settings.GetBool("server.h2c_enabled", false) {
+		return nil
+	}
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(s.httpServer, h2s); err != nil {
+		return fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+	s.httpServer.Handler = h2c.NewHandler(s.router, h2s)
+	if !s.config.Quiet {
+		log.Printf("HTTP/2 cleartext (h2c) enabled\n")
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path via a temp file and rename, so readers
+// never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Shutdown gracefully stops the HTTP server, waiting for in-flight requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.config.PortFile != "" {
+		os.Remove(s.config.PortFile)
+	}
+	if s.config.RuntimeFile != "" {
+		os.Remove(s.config.RuntimeFile)
+	}
+	if s.redirectServer != nil {
+		s.redirectServer.Shutdown(ctx)
+	}
+	return s.httpServer.Shutdown(ctx)
 }
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/admin"
+	"github.com/apimgr/zipcodes/src/database"
+)
+
+// testAdminToken is the admin API token of servers built by newTestServer
+const testAdminToken = "test-admin-token"
+
+// newTestServer builds a Server on a fresh database in a temp directory and
+// serves it over httptest. The admin API accepts testAdminToken.
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	t.Setenv("ADMIN_PASSWORD", "test-admin-password")
+
+	dir := t.TempDir()
+	db, err := database.NewAppDB(filepath.Join(dir, "zipcodes.db"))
+	if err != nil {
+		t.Fatalf("NewAppDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	logsDir := filepath.Join(dir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(db, &Config{DataDir: dir, LogsDir: logsDir, Quiet: true})
+	ts := httptest.NewServer(s.router)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// testZipcodes is a small dataset for tests that need records to look up
+const testZipcodes = `[
+	{"state": "MA", "city": "Agawam", "county": "Hampden", "zip_code": 1001, "latitude": "42.0702", "longitude": "-72.6227"},
+	{"state": "NY", "city": "Holtsville", "county": "Suffolk", "zip_code": 501, "latitude": "40.8154", "longitude": "-73.0451"},
+	{"state": "MA", "city": "Boston", "county": "Suffolk", "zip_code": 2101, "latitude": "42.3706", "longitude": "-71.0270"}
+]`
+
+// loadTestZipcodes loads testZipcodes into the server's database
+func loadTestZipcodes(t *testing.T, s *Server) {
+	t.Helper()
+	if err := s.db.LoadFromJSON([]byte(testZipcodes)); err != nil {
+		t.Fatalf("LoadFromJSON: %v", err)
+	}
+}
+
+// setSetting changes a setting in the server's database and drops the cached
+// settings so the next request sees it
+func setSetting(t *testing.T, s *Server, key, value string) {
+	t.Helper()
+	if _, err := s.db.GetConn().Exec("UPDATE settings SET value = ? WHERE key = ?", value, key); err != nil {
+		t.Fatalf("set %s: %v", key, err)
+	}
+	s.settings.Invalidate()
+}
+
+// shortRequestTimeout lowers requestTimeout for servers built during the test
+func shortRequestTimeout(t *testing.T, d time.Duration) {
+	t.Helper()
+	old := requestTimeout
+	requestTimeout = d
+	t.Cleanup(func() { requestTimeout = old })
+}
+
+// openStream starts an authenticated admin API GET and returns its body
+// reader once the 200 response headers arrive
+func openStream(t *testing.T, ts *httptest.Server, path string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d, want 200", path, resp.StatusCode)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readUntil reads lines from r until one contains want, failing if the
+// stream ends or nothing matches within wait
+func readUntil(t *testing.T, r *bufio.Reader, want string, wait time.Duration) {
+	t.Helper()
+	found := make(chan error, 1)
+	go func() {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				found <- err
+				return
+			}
+			if strings.Contains(line, want) {
+				found <- nil
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-found:
+		if err != nil {
+			t.Fatalf("stream ended before %q: %v", want, err)
+		}
+	case <-time.After(wait):
+		t.Fatalf("no %q within %s", want, wait)
+	}
+}
+
+func TestLogsStreamOutlivesRequestTimeout(t *testing.T) {
+	shortRequestTimeout(t, 200*time.Millisecond)
+	s, ts := newTestServer(t)
+
+	body := openStream(t, ts, "/api/v1/admin/logs/stream")
+
+	// Well past the request timeout, a new log line must still arrive
+	time.Sleep(3 * requestTimeout)
+	f, err := os.OpenFile(filepath.Join(s.config.LogsDir, admin.AccessLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("after-the-deadline\n")
+	f.Close()
+
+	readUntil(t, body, "data: after-the-deadline", 5*time.Second)
+}
+
+func TestStatsStreamOutlivesRequestTimeout(t *testing.T) {
+	shortRequestTimeout(t, 200*time.Millisecond)
+	_, ts := newTestServer(t)
+
+	body := openStream(t, ts, "/api/v1/admin/stats/stream")
+
+	// The first event is sent at once; the second comes statsStreamInterval
+	// later, well past the request timeout
+	readUntil(t, body, "event: stats", 5*time.Second)
+	readUntil(t, body, "event: stats", statsStreamInterval+5*time.Second)
+}
+
+func TestExportOutlivesRequestTimeout(t *testing.T) {
+	// Any query run under the request timeout would already be cancelled
+	shortRequestTimeout(t, time.Nanosecond)
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/v1/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(body), "]}\n") {
+		t.Fatalf("export was cut short: %q", body)
+	}
+}
+
+func TestExportGzipIsDownloadNotEncoding(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/export?compress=gzip", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the transport from asking for, and undoing, its own gzip
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/gzip" {
+		t.Errorf("Content-Type = %q, want application/gzip", got)
+	}
+	if got := resp.Header.Get("Content-Disposition"); !strings.Contains(got, `filename="zipcodes.geojson.gz"`) {
+		t.Errorf("Content-Disposition = %q, want a .gz filename", got)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(body), `{"type":"FeatureCollection"`) {
+		t.Errorf("decompressed body = %q", body)
+	}
+}
+
+func TestStateNDJSONOutlivesRequestTimeout(t *testing.T) {
+	shortRequestTimeout(t, time.Nanosecond)
+	s, ts := newTestServer(t)
+	loadTestZipcodes(t, s)
+
+	resp, err := http.Get(ts.URL + "/api/v1/zipcode/state/MA.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(body), "\n"); lines != 2 {
+		t.Fatalf("got %d records, want 2: %q", lines, body)
+	}
+}
+
+func TestStateCSVOutlivesRequestTimeout(t *testing.T) {
+	shortRequestTimeout(t, time.Nanosecond)
+	s, ts := newTestServer(t)
+	loadTestZipcodes(t, s)
+
+	resp, err := http.Get(ts.URL + "/api/v1/zipcode/state/MA.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header row plus both MA records
+	if lines := strings.Count(string(body), "\n"); lines != 3 {
+		t.Fatalf("got %d lines, want 3: %q", lines, body)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// putSettings sends an authenticated settings update from the admin API and
+// decodes its JSON response
+func putSettings(t *testing.T, ts *httptest.Server, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/settings", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT settings: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("Content-Type = %q, want JSON", ct)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestSettingsAPIRejectsStaleVersion(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	status, body := putSettings(t, ts, url.Values{"features.max_batch_size": {"500"}})
+	if status != http.StatusOK {
+		t.Fatalf("first save: status %d, want 200: %v", status, body)
+	}
+	version, _ := body["updated_at"].(string)
+	if version == "" {
+		t.Fatalf("first save returned no updated_at: %v", body)
+	}
+
+	// A save based on the returned version goes through
+	status, body = putSettings(t, ts, url.Values{"updated_at": {version}, "features.max_batch_size": {"600"}})
+	if status != http.StatusOK {
+		t.Fatalf("second save: status %d, want 200: %v", status, body)
+	}
+	current, _ := body["updated_at"].(string)
+
+	// Reusing the first version is now stale
+	status, body = putSettings(t, ts, url.Values{"updated_at": {version}, "features.max_batch_size": {"700"}})
+	if status != http.StatusConflict {
+		t.Fatalf("stale save: status %d, want 409: %v", status, body)
+	}
+	errBody, _ := body["error"].(map[string]interface{})
+	if code := errBody["code"]; code != "SETTINGS_CHANGED" {
+		t.Errorf("error code = %v, want SETTINGS_CHANGED", code)
+	}
+	if got := body["updated_at"]; got != current {
+		t.Errorf("updated_at = %v, want the current version %q", got, current)
+	}
+}
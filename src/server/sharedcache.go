@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/api"
+	"github.com/apimgr/zipcodes/src/database"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// defaultSharedCacheTTL is the entry lifetime when
+	// features.shared_cache_ttl is unset or not positive (seconds)
+	defaultSharedCacheTTL = 300
+
+	// maxSharedCacheBody is the largest response stored; bigger responses
+	// (zipcodes.json, NDJSON exports) are served but not cached
+	maxSharedCacheBody = 1 << 20
+
+	// sharedCachePruneInterval is how often a cache write also deletes
+	// expired entries
+	sharedCachePruneInterval = time.Minute
+)
+
+// sharedCache serves repeated GET requests from the response_cache table when
+// features.shared_cache is on, so instances sharing a database share a warm
+// cache. Entries are keyed by dataset version, response format (JSON and XML
+// share URIs, see api.ResponseFormat) and request URI, so a dataset
+// reload starts a fresh cache. Only 200 responses up to maxSharedCacheBody are
+// stored, with the headers set by the handlers below (see cachedHeaders), so
+// a HIT carries the same Content-Disposition, Vary and so on as the original.
+// Responses carry X-Cache: HIT or MISS; a request with Cache-Control:
+// no-cache skips the lookup but refreshes the entry.
+func (s *Server) sharedCache(next http.Handler) http.Handler {
+	var pruneMu sync.Mutex
+	var lastPrune time.Time
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !s.settings.GetBool("features.shared_cache", false) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := s.db.DatasetVersion() + " " + api.ResponseFormat(r) + " " + r.URL.RequestURI()
+		if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+			cached, err := s.db.GetCachedResponse(r.Context(), key)
+			if err != nil {
+				log.Printf("Shared cache lookup failed: %v", err)
+			} else if cached != nil {
+				for name, values := range cached.Header {
+					if name == "Vary" {
+						w.Header()[name] = appendMissing(w.Header()[name], values)
+					} else {
+						w.Header()[name] = values
+					}
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(cached.Status)
+				w.Write(cached.Body)
+				return
+			}
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		before := w.Header().Clone()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		body := &cappedBuffer{limit: maxSharedCacheBody}
+		ww.Tee(body)
+		next.ServeHTTP(ww, r)
+
+		if ww.Status() != http.StatusOK || body.overflow || r.Context().Err() != nil {
+			return
+		}
+
+		ttl := s.settings.GetInt("features.shared_cache_ttl", defaultSharedCacheTTL)
+		if ttl <= 0 {
+			ttl = defaultSharedCacheTTL
+		}
+		entry := &database.CachedResponse{
+			Status:    ww.Status(),
+			Header:    cachedHeaders(before, w.Header()),
+			Body:      body.Bytes(),
+			ExpiresAt: time.Now().Add(time.Duration(ttl) * time.Second),
+		}
+
+		// The response is already sent; don't tie the write to the client
+		ctx := context.WithoutCancel(r.Context())
+		if err := s.db.PutCachedResponse(ctx, key, entry); err != nil {
+			log.Printf("Shared cache store failed: %v", err)
+			return
+		}
+
+		pruneMu.Lock()
+		due := time.Since(lastPrune) >= sharedCachePruneInterval
+		if due {
+			lastPrune = time.Now()
+		}
+		pruneMu.Unlock()
+		if due {
+			if _, err := s.db.PruneResponseCache(ctx); err != nil {
+				log.Printf("Shared cache prune failed: %v", err)
+			}
+		}
+	})
+}
+
+// uncachedHeaders are never stored with a cached response: hop-by-hop
+// headers, and those the server sets per connection or per client
+// (compression applies its own Content-Encoding and Content-Length).
+var uncachedHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Encoding":    true,
+	"Content-Length":      true,
+	"Date":                true,
+	"Set-Cookie":          true,
+}
+
+// cachedHeaders returns the response headers the handlers below sharedCache
+// set, i.e. those in after that differ from before. Headers set earlier in
+// the chain (CORS, rate limits, X-Cache) are set again on every request, so
+// they are left out. For Vary only the added values are kept, since a HIT
+// merges them into what the earlier middleware set, and Accept-Encoding is
+// dropped because compression adds it to every response it writes.
+func cachedHeaders(before, after http.Header) http.Header {
+	header := make(http.Header)
+	for name, values := range after {
+		if uncachedHeaders[name] || slices.Equal(before[name], values) {
+			continue
+		}
+		if name == "Vary" {
+			values = appendMissing(nil, slices.DeleteFunc(slices.Clone(values), func(v string) bool {
+				return v == "Accept-Encoding" || slices.Contains(before[name], v)
+			}))
+		}
+		header[name] = slices.Clone(values)
+	}
+	return header
+}
+
+// appendMissing appends the values not already in dst
+func appendMissing(dst, values []string) []string {
+	for _, v := range values {
+		if !slices.Contains(dst, v) {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+// cappedBuffer collects up to limit bytes and then records that it overflowed
+type cappedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflow || b.Len()+len(p) > b.limit {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// cachedGet sends a GET with the given headers and returns the response with
+// its body read
+func cachedGet(t *testing.T, ts *httptest.Server, path string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d, want 200", path, resp.StatusCode)
+	}
+	return resp, string(body)
+}
+
+func TestSharedCacheHitReplaysHeaders(t *testing.T) {
+	s, ts := newTestServer(t)
+	loadTestZipcodes(t, s)
+	setSetting(t, s, "features.shared_cache", "true")
+
+	miss, missBody := cachedGet(t, ts, "/api/v1/zipcode/city/Boston?format=csv", nil)
+	hit, hitBody := cachedGet(t, ts, "/api/v1/zipcode/city/Boston?format=csv", nil)
+
+	if got := hit.Header.Get("X-Cache"); got != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", got)
+	}
+	if hitBody != missBody {
+		t.Errorf("HIT body differs from MISS body")
+	}
+	for _, name := range []string{"Content-Type", "Content-Disposition"} {
+		if got, want := hit.Header.Get(name), miss.Header.Get(name); got != want || want == "" {
+			t.Errorf("HIT %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSharedCacheHitKeepsVary(t *testing.T) {
+	s, ts := newTestServer(t)
+	loadTestZipcodes(t, s)
+	setSetting(t, s, "features.shared_cache", "true")
+
+	cachedGet(t, ts, "/api/v1/zipcode/01001", nil)
+	hit, _ := cachedGet(t, ts, "/api/v1/zipcode/01001", nil)
+
+	if got := hit.Header.Get("X-Cache"); got != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", got)
+	}
+	vary := strings.Split(strings.Join(hit.Header.Values("Vary"), ","), ",")
+	for i := range vary {
+		vary[i] = strings.TrimSpace(vary[i])
+	}
+	if !slices.Contains(vary, "Accept") {
+		t.Errorf("HIT Vary = %q, want it to include Accept", hit.Header.Values("Vary"))
+	}
+	if n := strings.Count(strings.Join(vary, ","), "Accept-Encoding"); n > 1 {
+		t.Errorf("HIT Vary repeats Accept-Encoding: %q", hit.Header.Values("Vary"))
+	}
+}
+
+func TestSharedCacheKeyedByNegotiatedFormat(t *testing.T) {
+	s, ts := newTestServer(t)
+	loadTestZipcodes(t, s)
+	setSetting(t, s, "features.shared_cache", "true")
+
+	// Each Accept variant must get its own format back, whichever was cached
+	// first
+	variants := []struct {
+		accept      string
+		contentType string
+	}{
+		{"application/xml", "application/xml"},
+		{"", "application/json"},
+		{"text/xml", "application/xml"},
+		{"application/json", "application/json"},
+		{"application/xml;q=0.5, application/json", "application/json"},
+		{"application/json;q=0.5, text/xml", "application/xml"},
+		{"*/*", "application/json"},
+	}
+	for round := 0; round < 2; round++ {
+		for _, v := range variants {
+			resp, _ := cachedGet(t, ts, "/api/v1/zipcode/01001", map[string]string{"Accept": v.accept})
+			if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, v.contentType) {
+				t.Errorf("Accept %q (X-Cache %s): Content-Type %q, want %s",
+					v.accept, resp.Header.Get("X-Cache"), got, v.contentType)
+			}
+		}
+	}
+}
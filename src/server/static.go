@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// staticCacheControl applies to every static asset. Asset names aren't
+// versioned, so clients revalidate with the ETag after a day.
+const staticCacheControl = "public, max-age=86400"
+
+// staticAsset is an embedded file served under /static/
+type staticAsset struct {
+	data        []byte
+	etag        string
+	contentType string
+}
+
+// staticHandler serves the files of fsys from a fixed index built at startup.
+// Only names in the index are served: directories, traversal attempts
+// ("../templates/base.html", encoded or not) and anything else get the
+// standard 404, so a request can never leave the static subtree.
+func (s *Server) staticHandler(fsys fs.FS) (http.Handler, error) {
+	assets := make(map[string]staticAsset)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		assets[name] = staticAsset{
+			data:        data,
+			etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+			contentType: contentType,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// r.URL.Path is already percent-decoded, so %2e%2e arrives as ".."
+		name := strings.TrimPrefix(r.URL.Path, "/static/")
+		asset, ok := assets[name]
+		if !ok || !fs.ValidPath(name) || strings.Contains(name, "\\") {
+			s.notFoundHandler(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", asset.contentType)
+		w.Header().Set("Cache-Control", staticCacheControl)
+		w.Header().Set("ETag", asset.etag)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(asset.data))
+	}), nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticHandlerStaysInRoot(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// The static root is a subtree, with files beside it that must stay out
+	// of reach, as with the embedded static directory
+	root := fstest.MapFS{
+		"static/css/app.css":  {Data: []byte("body{}")},
+		"templates/base.html": {Data: []byte("SECRET TEMPLATE")},
+		"zipcodes.db":         {Data: []byte("SECRET DATABASE")},
+	}
+	sub, err := fs.Sub(root, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := s.staticHandler(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/css/app.css", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "body{}" {
+		t.Fatalf("app.css: status %d body %q, want 200 body{}", rec.Code, rec.Body.String())
+	}
+
+	for _, target := range []string{
+		"/static/../templates/base.html",
+		"/static/../zipcodes.db",
+		"/static/css/../../templates/base.html",
+		"/static/%2e%2e/templates/base.html",
+		"/static/%2E%2E%2Ftemplates%2Fbase.html",
+		"/static/css/%2e%2e/%2e%2e/zipcodes.db",
+		"/static/..%5ctemplates%5cbase.html",
+		"/static//templates/base.html",
+		"/static//etc/passwd",
+		"/static/%2fetc%2fpasswd",
+		"/static/",
+		"/static/css",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", target, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "SECRET") {
+			t.Errorf("%s: served a file outside the static root", target)
+		}
+	}
+}
+
+func TestStaticRouteStaysInRoot(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/static/css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("main.css: status %d, want 200", resp.StatusCode)
+	}
+
+	// Sent as-is over the wire, so neither the client nor the router gets a
+	// chance to clean the path first
+	for _, target := range []string{
+		"/static/../templates/base.html",
+		"/static/%2e%2e/templates/base.html",
+		"/static/%2e%2e%2f%2e%2e%2fmain.go",
+		"/static//etc/passwd",
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.URL.Opaque = target
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", target, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/apimgr/zipcodes/src/utils"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestTimeout bounds how long a handler may take before the client gets a
+// 504. A variable so tests can shorten it before building a Server.
+var requestTimeout = 60 * time.Second
+
+// timeout cancels the request context after d, whether or not the handler
+// has started writing. If the handler gives up without writing a response,
+// the client gets the standard JSON error with code GATEWAY_TIMEOUT and the
+// request ID, and the request is logged. It is applied per route group, so
+// long-lived responses (SSE streams, /export) are registered outside it.
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if ctx.Err() != context.DeadlineExceeded || ww.Status() != 0 || ww.BytesWritten() != 0 {
+				return
+			}
+
+			requestID := middleware.GetReqID(r.Context())
+			log.Printf("Request timed out after %s: %s %s (request_id=%s)",
+				time.Since(start).Round(time.Millisecond), r.Method, r.URL.RequestURI(), utils.SanitizeText(requestID))
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error": map[string]string{
+					"code":       "GATEWAY_TIMEOUT",
+					"message":    "the request took too long to process",
+					"request_id": requestID,
+				},
+			})
+		})
+	}
+}
+
+// queryTimeout bounds the request context, and with it every database query
+// the handlers make, to db.query_timeout seconds (0 leaves only client
+// disconnects and the server's request timeout to cancel them)
+func (s *Server) queryTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secs := s.settings.GetInt("db.query_timeout", 10); secs > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(secs)*time.Second)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
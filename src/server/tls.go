@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// redirectReadHeaderTimeout bounds the plain HTTP redirect listener, which
+// only ever reads request headers
+const redirectReadHeaderTimeout = 10 * time.Second
+
+// tlsSetup is the TLS configuration chosen at startup, and the autocert
+// manager when certificates come from Let's Encrypt
+type tlsSetup struct {
+	config  *tls.Config
+	manager *autocert.Manager
+}
+
+// setupTLS decides how the main listener serves HTTPS. A certificate passed
+// with --tls-cert/--tls-key (or TLS_CERT/TLS_KEY) turns HTTPS on by itself;
+// otherwise server.https_enabled needs server.tls_domains for Let's Encrypt.
+// When HTTPS is wanted but no usable certificate is configured, it logs a
+// warning and returns nil, so the server falls back to plain HTTP rather
+// than not starting.
+func (s *Server) setupTLS() *tlsSetup {
+	certFile, keyFile := s.config.TLSCert, s.config.TLSKey
+	enabled := s.settings.GetBool("server.https_enabled", false)
+
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			log.Printf("Warning: --tls-cert and --tls-key must be given together; serving plain HTTP")
+			return nil
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Printf("Warning: failed to load TLS certificate: %v; serving plain HTTP", err)
+			return nil
+		}
+		return &tlsSetup{config: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}}
+
+	case !enabled:
+		return nil
+	}
+
+	domains := splitDomains(s.settings.GetString("server.tls_domains", ""))
+	if len(domains) == 0 {
+		log.Printf("Warning: server.https_enabled is on but no certificate is configured (--tls-cert/--tls-key or server.tls_domains); serving plain HTTP")
+		return nil
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(filepath.Join(s.config.DataDir, "certs")),
+		Email:      s.settings.GetString("server.acme_email", ""),
+	}
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return &tlsSetup{config: config, manager: manager}
+}
+
+// splitDomains parses the comma-separated server.tls_domains setting
+func splitDomains(value string) []string {
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// startRedirect listens on server.https_redirect_port, when set, and
+// redirects every request to the HTTPS listener on httpsPort. With autocert
+// the listener also answers ACME HTTP-01 challenges, which Let's Encrypt
+// sends to port 80.
+func (s *Server) startRedirect(bindAddr, httpsPort string, setup *tlsSetup) error {
+	port := s.settings.GetInt("server.https_redirect_port", 0)
+	if port <= 0 {
+		return nil
+	}
+
+	var handler http.Handler = httpsRedirect(httpsPort)
+	if setup.manager != nil {
+		handler = setup.manager.HTTPHandler(handler)
+	}
+
+	addr := net.JoinHostPort(bindAddr, strconv.Itoa(port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for HTTPS redirects: %w", err)
+	}
+
+	s.redirectServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: redirectReadHeaderTimeout,
+	}
+	go func() {
+		if err := s.redirectServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTPS redirect listener stopped: %v", err)
+		}
+	}()
+
+	if !s.config.Quiet {
+		log.Printf("Redirecting HTTP on %s to HTTPS\n", addr)
+	}
+	return nil
+}
+
+// httpsRedirect permanently redirects to the same host and URI over HTTPS on
+// httpsPort (omitted when it is 443)
+func httpsRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// BuildInfo is the body of /version and /api/v1/version
+type BuildInfo struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	BuildDate      string `json:"build_date"`
+	GoVersion      string `json:"go_version"`
+	DatasetVersion string `json:"dataset_version,omitempty"`
+}
+
+// buildInfo collects the build info set at link time and the loaded dataset
+func (s *Server) buildInfo() BuildInfo {
+	return BuildInfo{
+		Version:        s.config.Version,
+		Commit:         s.config.Commit,
+		BuildDate:      s.config.BuildDate,
+		GoVersion:      runtime.Version(),
+		DatasetVersion: s.db.DatasetVersion(),
+	}
+}
+
+// versionHandler serves the build info as JSON
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.buildInfo())
+}
+
+// versionTextHandler serves the build info as plain text, one field per line
+func (s *Server) versionTextHandler(w http.ResponseWriter, r *http.Request) {
+	info := s.buildInfo()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Version: %s\n", info.Version)
+	fmt.Fprintf(w, "Commit: %s\n", info.Commit)
+	fmt.Fprintf(w, "Build Date: %s\n", info.BuildDate)
+	fmt.Fprintf(w, "Go Version: %s\n", info.GoVersion)
+	if info.DatasetVersion != "" {
+		fmt.Fprintf(w, "Dataset Version: %s\n", info.DatasetVersion)
+	}
+}
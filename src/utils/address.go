@@ -1,11 +1,26 @@
 package utils
 
 import (
+	"fmt"
 	"net"
 	"os"
 	"strings"
 )
 
+// CheckBindAddress verifies that a listener can be opened on address:port
+// The listener is closed immediately; this only catches misconfiguration early
+func CheckBindAddress(address, port string) error {
+	addr := net.JoinHostPort(address, port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		if ip := net.ParseIP(address); ip == nil && address != "" {
+			return fmt.Errorf("cannot listen on %s: %q is not an IP address or resolvable hostname: %w", addr, address, err)
+		}
+		return fmt.Errorf("cannot listen on %s (is the address assigned to this host and the port free?): %w", addr, err)
+	}
+	return ln.Close()
+}
+
 // GetDisplayAddress returns the most appropriate address to display to users
 // Priority: FQDN > specific bind address > external IP > hostname > fallback
 // NEVER returns localhost, 127.0.0.1, or 0.0.0.0 per SPEC.md
@@ -24,7 +39,7 @@ func GetDisplayAddress(bindAddr string) string {
 	}
 
 	// Try to get outbound IP (most likely accessible IP)
-	if externalIP := getOutboundIP(); externalIP != "" {
+	if externalIP := GetOutboundIP(); externalIP != "" {
 		return externalIP
 	}
 
@@ -42,8 +57,9 @@ func GetDisplayAddress(bindAddr string) string {
 	return "<your-host>"
 }
 
-// getOutboundIP gets the preferred outbound IP of this machine
-func getOutboundIP() string {
+// GetOutboundIP gets the preferred outbound IP of this machine
+// No packets are sent; the UDP dial only asks the kernel for a route
+func GetOutboundIP() string {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
 		return ""
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ProxyConfig controls which request headers are trusted for the client IP
+type ProxyConfig struct {
+	// TrustHeaders enables reading the client IP from proxy headers
+	TrustHeaders bool
+	// ClientIPHeaders are extra headers (e.g. CF-Connecting-IP) checked in order
+	// before X-Forwarded-For and X-Real-IP
+	ClientIPHeaders []string
+	// AllowedHosts are the public hostnames accepted from X-Forwarded-Host and
+	// Forwarded; "*.example.com" matches any subdomain. Empty ignores both headers.
+	AllowedHosts []string
+}
+
+// GetClientIP extracts the real client IP from the request
+// Proxy headers are only honored when the proxy is trusted
+func GetClientIP(r *http.Request, proxy ProxyConfig) string {
+	if proxy.TrustHeaders {
+		// Check configured headers in order
+		for _, name := range proxy.ClientIPHeaders {
+			if value := strings.TrimSpace(r.Header.Get(name)); value != "" {
+				return strings.TrimSpace(strings.Split(value, ",")[0])
+			}
+		}
+
+		// Check X-Forwarded-For header
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			ips := strings.Split(xff, ",")
+			if len(ips) > 0 {
+				return strings.TrimSpace(ips[0])
+			}
+		}
+
+		// Check X-Real-IP header
+		if xri := r.Header.Get("X-Real-IP"); xri != "" {
+			return strings.TrimSpace(xri)
+		}
+	}
+
+	// Use RemoteAddr
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// clientIPKey is the request context key holding the resolved client IP
+type clientIPKey struct{}
+
+// WithClientIP returns r carrying ip as its client IP for ClientIP
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+}
+
+// ClientIP returns the client IP resolved once per request by the server's
+// client IP middleware, so rate limiting, GeoIP and the audit log all agree
+// on the caller. Outside that middleware it falls back to RemoteAddr and
+// never trusts proxy headers.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return GetClientIP(r, ProxyConfig{})
+}
+
+// RequestScheme returns "https" or "http" for the request as the client sent it
+// X-Forwarded-Proto and Forwarded are only honored when the proxy is trusted
+func RequestScheme(r *http.Request, proxy ProxyConfig) string {
+	if proxy.TrustHeaders {
+		proto := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]))
+		if proto == "" {
+			proto = strings.ToLower(forwardedParam(r, "proto"))
+		}
+		if proto == "https" || proto == "http" {
+			return proto
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// ParseHeaderList splits a comma-separated list of header names
+func ParseHeaderList(value string) []string {
+	var headers []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			headers = append(headers, name)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequestHost returns the host (with any port) the client used to reach the
+// server, for building external URLs. When the proxy is trusted, the host
+// from X-Forwarded-Host or Forwarded is used if it is in proxy.AllowedHosts;
+// otherwise the Host header. Returns "" when neither is usable, in which case
+// callers fall back to GetDisplayAddress.
+func RequestHost(r *http.Request, proxy ProxyConfig) string {
+	if proxy.TrustHeaders && len(proxy.AllowedHosts) > 0 {
+		forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0])
+		if forwarded == "" {
+			forwarded = forwardedParam(r, "host")
+		}
+		if forwarded != "" && HostAllowed(forwarded, proxy.AllowedHosts) {
+			return strings.ToLower(forwarded)
+		}
+	}
+	if validHost(r.Host) {
+		return r.Host
+	}
+	return ""
+}
+
+// ExternalURL builds an absolute URL for path as the client sees the server
+// (see RequestScheme and RequestHost)
+func ExternalURL(r *http.Request, proxy ProxyConfig, path string) string {
+	host := RequestHost(r, proxy)
+	if host == "" {
+		host = GetDisplayAddress("")
+	}
+	return RequestScheme(r, proxy) + "://" + host + path
+}
+
+// HostAllowed reports whether host (optionally with a port) is a valid
+// hostname matching one of allowed. Entries are compared case-insensitively;
+// "*.example.com" matches subdomains of example.com but not example.com itself.
+func HostAllowed(host string, allowed []string) bool {
+	if !validHost(host) {
+		return false
+	}
+	name := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = strings.Trim(h, "[]")
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok {
+			if strings.HasPrefix(suffix, ".") && strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if name == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// validHost reports whether host is a plausible host[:port]: letters, digits,
+// dots, hyphens, and the brackets and colons of an IPv6 literal. This keeps
+// injected paths, credentials and whitespace out of generated URLs.
+func validHost(host string) bool {
+	if host == "" || len(host) > 255 {
+		return false
+	}
+	for _, c := range host {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == ':', c == '[', c == ']':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// forwardedParam returns a parameter (host, proto) from the first element of
+// the RFC 7239 Forwarded header, unquoted
+func forwardedParam(r *http.Request, name string) string {
+	first := strings.Split(r.Header.Get("Forwarded"), ",")[0]
+	for _, pair := range strings.Split(first, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(key, name) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
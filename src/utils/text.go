@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SanitizeText escapes control characters so a value can be written into a
+// line-oriented text response or log line without breaking the format.
+// Newlines become \n, other control characters and the Unicode line/paragraph
+// separators use Go escapes (\x1b, \u2028), and invalid UTF-8 is replaced
+// with U+FFFD. Clean values are returned unchanged.
+func SanitizeText(s string) string {
+	if !needsSanitizing(s) {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s) + 8)
+	for _, r := range strings.ToValidUTF8(s, string(utf8.RuneError)) {
+		if isUnsafeRune(r) {
+			quoted := strconv.QuoteRuneToASCII(r)
+			sb.WriteString(quoted[1 : len(quoted)-1])
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// needsSanitizing reports whether s has anything SanitizeText would change
+func needsSanitizing(s string) bool {
+	if !utf8.ValidString(s) {
+		return true
+	}
+	for _, r := range s {
+		if isUnsafeRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnsafeRune reports whether r could break a line or inject terminal escapes
+func isUnsafeRune(r rune) bool {
+	return unicode.IsControl(r) || r == '\u2028' || r == '\u2029'
+}